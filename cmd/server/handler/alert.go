@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vincentconace/api-gin/internal/alert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+type AlertHandler struct {
+	alertService   alert.Service
+	productService product.Service
+}
+
+func NewAlertHandler(alertService alert.Service, productService product.Service) *AlertHandler {
+	return &AlertHandler{alertService: alertService, productService: productService}
+}
+
+func (h *AlertHandler) GetSetting() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		setting, err := h.alertService.GetSetting(c, productID)
+		if err != nil {
+			alertError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, setting)
+	}
+}
+
+// ReorderRequest is the body of SaveSetting
+type ReorderRequest struct {
+	ReorderPoint    *int `json:"reorder_point"`
+	ReorderQuantity *int `json:"reorder_quantity"`
+}
+
+func (h *AlertHandler) SaveSetting() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		var req ReorderRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "unprocesable request")
+			return
+		}
+		if req.ReorderPoint == nil || req.ReorderQuantity == nil {
+			web.Error(c, http.StatusUnprocessableEntity, "required fields: reorder_point, reorder_quantity")
+			return
+		}
+		if _, err := h.productService.GetById(c, productID); err != nil {
+			web.Error(c, http.StatusNotFound, "product not found")
+			return
+		}
+
+		setting, err := h.alertService.SaveSetting(c, domain.ReorderSetting{
+			ProductID:       productID,
+			ReorderPoint:    *req.ReorderPoint,
+			ReorderQuantity: *req.ReorderQuantity,
+		})
+		if err != nil {
+			alertError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, setting)
+	}
+}
+
+func (h *AlertHandler) List() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		alerts, err := h.alertService.List(c, c.Query("status"))
+		if err != nil {
+			alertError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, alerts)
+	}
+}
+
+func alertError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, alert.ErrSettingNotFound), errors.Is(err, alert.ErrNotFound):
+		web.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, alert.ErrInvalidSetting), errors.Is(err, alert.ErrInvalidStatus):
+		web.Error(c, http.StatusUnprocessableEntity, err.Error())
+	default:
+		web.Error(c, http.StatusInternalServerError, ErrInternal.Error())
+	}
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vincentconace/api-gin/internal/apikey"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+type APIKeyHandler struct {
+	apiKeyService apikey.Service
+}
+
+func NewAPIKeyHandler(apiKeyService apikey.Service) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService}
+}
+
+func (h *APIKeyHandler) Get() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := h.apiKeyService.Get(c)
+		if err != nil {
+			apiKeyError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, keys)
+	}
+}
+
+func (h *APIKeyHandler) GetById() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		k, err := h.apiKeyService.GetById(c, id)
+		if err != nil {
+			apiKeyError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, k)
+	}
+}
+
+// APIKeyRequest is the body of Create
+type APIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Create answers with the generated key, which can't be read again
+func (h *APIKeyHandler) Create() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req APIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid request")
+			return
+		}
+		creator, _ := auth.FromContext(c)
+
+		k, err := h.apiKeyService.Create(c, creator, domain.APIKey{Name: req.Name, Scopes: req.Scopes, ExpiresAt: req.ExpiresAt})
+		if err != nil {
+			apiKeyError(c, err)
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		web.Success(c, http.StatusCreated, k)
+	}
+}
+
+func (h *APIKeyHandler) Revoke() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		if err := h.apiKeyService.Revoke(c, id); err != nil {
+			apiKeyError(c, err)
+			return
+		}
+		web.Success(c, http.StatusNoContent, "")
+	}
+}
+
+func apiKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, apikey.ErrNotFound):
+		web.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, apikey.ErrAlreadyRevoked):
+		web.Error(c, http.StatusConflict, err.Error())
+	case errors.Is(err, apikey.ErrScopeNotGranted):
+		web.Error(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, apikey.ErrNameRequired), errors.Is(err, apikey.ErrScopesRequired), errors.Is(err, apikey.ErrExpired):
+		web.Error(c, http.StatusUnprocessableEntity, err.Error())
+	default:
+		web.Error(c, http.StatusInternalServerError, ErrInternal.Error())
+	}
+}
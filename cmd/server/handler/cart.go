@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/vincentconace/api-gin/internal/cart"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+type CartHandler struct {
+	cartService cart.Service
+	redis       *redis.Client
+}
+
+func NewCartHandler(cartService cart.Service, rd *redis.Client) *CartHandler {
+	return &CartHandler{cartService: cartService, redis: rd}
+}
+
+func (h *CartHandler) Create() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ct, err := h.cartService.Create(c)
+		if err != nil {
+			cartError(c, err)
+			return
+		}
+		web.Success(c, http.StatusCreated, ct)
+	}
+}
+
+func (h *CartHandler) Get() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ct, err := h.cartService.Get(c, caller(c), c.Param("id"))
+		if err != nil {
+			cartError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, ct)
+	}
+}
+
+func (h *CartHandler) SetItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.Atoi(c.Param("productId"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid product id")
+			return
+		}
+		var req QuantityRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.Quantity == nil {
+			web.Error(c, http.StatusUnprocessableEntity, "required fields: quantity")
+			return
+		}
+
+		ct, err := h.cartService.SetItem(c, caller(c), c.Param("id"), productID, *req.Quantity)
+		if err != nil {
+			cartError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, ct)
+	}
+}
+
+func (h *CartHandler) RemoveItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.Atoi(c.Param("productId"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid product id")
+			return
+		}
+		ct, err := h.cartService.RemoveItem(c, caller(c), c.Param("id"), productID)
+		if err != nil {
+			cartError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, ct)
+	}
+}
+
+// CartMergeRequest is the body of Merge
+type CartMergeRequest struct {
+	From string `json:"from"`
+}
+
+func (h *CartHandler) Merge() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CartMergeRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.From == "" {
+			web.Error(c, http.StatusUnprocessableEntity, "required fields: from")
+			return
+		}
+		ct, err := h.cartService.Merge(c, caller(c), req.From, c.Param("id"))
+		if err != nil {
+			cartError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, ct)
+	}
+}
+
+func (h *CartHandler) Checkout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		o, err := h.cartService.Checkout(c, caller(c), c.Param("id"))
+		if err != nil {
+			cartError(c, err)
+			return
+		}
+
+		// Drop the cached products so reads see the new stock
+		for _, item := range o.Items {
+			h.redis.Del(c, productKey(c, item.ProductID))
+		}
+		web.Success(c, http.StatusCreated, o)
+	}
+}
+
+// caller is the subject of the request, empty when anonymous
+func caller(c *gin.Context) string {
+	p, _ := auth.FromContext(c)
+	return p.Subject
+}
+
+func cartError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, cart.ErrNotFound), errors.Is(err, cart.ErrProductNotFound):
+		web.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, cart.ErrOutOfStock), errors.Is(err, cart.ErrInvalidCart), errors.Is(err, cart.ErrEmptyCart):
+		web.Error(c, http.StatusConflict, err.Error())
+	case errors.Is(err, cart.ErrInvalidQuantity):
+		web.Error(c, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, cart.ErrAnonymous):
+		web.Error(c, http.StatusUnauthorized, err.Error())
+	default:
+		// Checkout surfaces order errors as they are
+		orderError(c, err)
+	}
+}
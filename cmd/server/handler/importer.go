@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/vincentconace/api-gin/internal/importer"
+	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+type ImportHandler struct {
+	importService importer.Service
+	redis         *redis.Client
+}
+
+func NewImportHandler(importService importer.Service, rd *redis.Client) *ImportHandler {
+	return &ImportHandler{importService: importService, redis: rd}
+}
+
+func (h *ImportHandler) Import() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		opts := importer.Options{Mode: c.DefaultQuery("mode", product.BatchAtomic)}
+		dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid dry_run")
+			return
+		}
+		async, err := strconv.ParseBool(c.DefaultQuery("async", "false"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid async")
+			return
+		}
+		opts.DryRun = dryRun
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, importer.MaxSize+1<<20)
+		fh, err := c.FormFile("file")
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "required fields: file")
+			return
+		}
+		if fh.Size > importer.MaxSize {
+			web.Error(c, http.StatusRequestEntityTooLarge, importer.ErrTooLarge.Error())
+			return
+		}
+		if mapping := c.PostForm("mapping"); mapping != "" {
+			if err := json.Unmarshal([]byte(mapping), &opts.Mapping); err != nil {
+				web.Error(c, http.StatusBadRequest, "mapping must be a JSON object of header to field")
+				return
+			}
+		}
+
+		f, err := fh.Open()
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid file %s", fh.Filename)
+			return
+		}
+		defer f.Close()
+
+		if async {
+			j, err := h.importService.Enqueue(c, fh.Filename, f, opts)
+			if err != nil {
+				importError(c, err)
+				return
+			}
+			web.Success(c, http.StatusAccepted, j)
+			return
+		}
+
+		result, err := h.importService.Import(c, fh.Filename, f, opts)
+		if err != nil {
+			importError(c, err)
+			return
+		}
+
+		var keys []string
+		for _, line := range result.Rows {
+			if line.Status == product.StatusUpdated {
+				keys = append(keys, productKey(c, *line.ID))
+			}
+		}
+		if len(keys) > 0 {
+			h.redis.Del(c, keys...)
+		}
+
+		status := http.StatusOK
+		if result.Failed > 0 {
+			status = http.StatusMultiStatus
+			if result.Mode == product.BatchAtomic && !result.DryRun {
+				status = http.StatusUnprocessableEntity
+			}
+		}
+		web.Success(c, status, result)
+	}
+}
+
+func importError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, importer.ErrTooLarge):
+		web.Error(c, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, importer.ErrUnsupportedFormat):
+		web.Error(c, http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, importer.ErrInvalidFile), errors.Is(err, importer.ErrEmptyFile),
+		errors.Is(err, importer.ErrInvalidMapping), errors.Is(err, importer.ErrMissingCodeColumn),
+		errors.Is(err, product.ErrInvalidBatchMode), errors.Is(err, product.ErrBatchTooLarge):
+		web.Error(c, http.StatusUnprocessableEntity, err.Error())
+	default:
+		web.Error(c, http.StatusInternalServerError, ErrInternal.Error())
+	}
+}
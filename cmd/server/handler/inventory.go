@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/vincentconace/api-gin/internal/inventory"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+type InventoryHandler struct {
+	inventoryService inventory.Service
+	redis            *redis.Client
+}
+
+func NewInventoryHandler(inventoryService inventory.Service, rd *redis.Client) *InventoryHandler {
+	return &InventoryHandler{inventoryService: inventoryService, redis: rd}
+}
+
+// StockAdjustRequest is the body of Adjust
+type StockAdjustRequest struct {
+	Delta       *int   `json:"delta"`
+	WarehouseID int    `json:"warehouse_id,omitempty"`
+	Reason      string `json:"reason"`
+	Reference   string `json:"reference,omitempty"`
+}
+
+func (h *InventoryHandler) Adjust() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		var req StockAdjustRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "unprocesable request")
+			return
+		}
+		if req.Delta == nil || req.Reason == "" {
+			web.Error(c, http.StatusUnprocessableEntity, "required fields: delta, reason")
+			return
+		}
+
+		movement, err := h.inventoryService.Adjust(c, productID, req.WarehouseID, *req.Delta, req.Reason, req.Reference)
+		if err != nil {
+			inventoryError(c, err)
+			return
+		}
+
+		h.invalidate(c, productID)
+		web.Success(c, http.StatusOK, movement)
+	}
+}
+
+func (h *InventoryHandler) Ledger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		movements, err := h.inventoryService.Ledger(c, productID)
+		if err != nil {
+			inventoryError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, movements)
+	}
+}
+
+// ReservationRequest is the body of Reserve
+type ReservationRequest struct {
+	Quantity   int    `json:"quantity"`
+	TTLSeconds int    `json:"ttl_seconds,omitempty"`
+	Reference  string `json:"reference,omitempty"`
+}
+
+func (h *InventoryHandler) Reserve() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		var req ReservationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "unprocesable request")
+			return
+		}
+
+		ttl := time.Duration(req.TTLSeconds) * time.Second
+		reservation, err := h.inventoryService.Reserve(c, productID, req.Quantity, ttl, req.Reference)
+		if err != nil {
+			inventoryError(c, err)
+			return
+		}
+
+		h.invalidate(c, productID)
+		web.Success(c, http.StatusCreated, reservation)
+	}
+}
+
+func (h *InventoryHandler) GetReservation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		reservation, err := h.inventoryService.GetReservation(c, id)
+		if err != nil {
+			inventoryError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, reservation)
+	}
+}
+
+func (h *InventoryHandler) Commit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		reservation, err := h.inventoryService.Commit(c, id)
+		if err != nil {
+			inventoryError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, reservation)
+	}
+}
+
+func (h *InventoryHandler) Release() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		reservation, err := h.inventoryService.Release(c, id)
+		if err != nil {
+			inventoryError(c, err)
+			return
+		}
+
+		h.invalidate(c, reservation.ProductID)
+		web.Success(c, http.StatusOK, reservation)
+	}
+}
+
+// invalidate drops the cached product so the next read sees the new stock
+func (h *InventoryHandler) invalidate(c *gin.Context, productID int) {
+	h.redis.Del(c, productKey(c, productID))
+}
+
+func inventoryError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrProductNotFound), errors.Is(err, inventory.ErrReservationNotFound):
+		web.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, inventory.ErrWarehouseNotFound):
+		web.Error(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, inventory.ErrInsufficientStock), errors.Is(err, inventory.ErrReservationClosed):
+		web.Error(c, http.StatusConflict, err.Error())
+	case errors.Is(err, inventory.ErrInvalidDelta), errors.Is(err, inventory.ErrInvalidQuantity),
+		errors.Is(err, inventory.ErrInvalidReason), errors.Is(err, inventory.ErrInvalidTTL):
+		web.Error(c, http.StatusUnprocessableEntity, err.Error())
+	default:
+		web.Error(c, http.StatusInternalServerError, ErrInternal.Error())
+	}
+}
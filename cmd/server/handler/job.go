@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vincentconace/api-gin/internal/job"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+type JobHandler struct {
+	jobService job.Service
+}
+
+func NewJobHandler(jobService job.Service) *JobHandler {
+	return &JobHandler{jobService: jobService}
+}
+
+func (h *JobHandler) GetById() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		j, err := h.jobService.Get(c, c.Param("id"))
+		if err != nil {
+			jobError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, j)
+	}
+}
+
+func (h *JobHandler) Cancel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		j, err := h.jobService.Cancel(c, c.Param("id"))
+		if err != nil {
+			jobError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, j)
+	}
+}
+
+func jobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, job.ErrNotFound):
+		web.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, job.ErrNotCancellable):
+		web.Error(c, http.StatusConflict, err.Error())
+	default:
+		web.Error(c, http.StatusInternalServerError, ErrInternal.Error())
+	}
+}
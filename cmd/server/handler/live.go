@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/vincentconace/api-gin/internal/live"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+// Comments sent while idle keep proxies from closing the stream
+const heartbeatInterval = 15 * time.Second
+
+// Handshakes are authenticated by token rather than cookies, so any
+// origin may connect
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+type LiveHandler struct {
+	liveService live.Service
+	auth        live.Authenticator
+}
+
+func NewLiveHandler(liveService live.Service, auth live.Authenticator) *LiveHandler {
+	return &LiveHandler{liveService: liveService, auth: auth}
+}
+
+// Stream pushes product and stock events as Server-Sent Events. Browsers
+// resume with the Last-Event-ID header, other clients can pass
+// ?last_event_id instead.
+func (h *LiveHandler) Stream() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("category") != "" {
+			web.Error(c, http.StatusBadRequest, "products have no category to filter by")
+			return
+		}
+		filter, err := parseFilter(c.Query("product_ids"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid product_ids")
+			return
+		}
+		lastEventID, err := parseLastEventID(c)
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid last event id")
+			return
+		}
+
+		ctx := c.Request.Context()
+		events := h.liveService.Subscribe(ctx, lastEventID, filter)
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				c.Render(-1, sse.Event{Id: strconv.FormatInt(e.ID, 10), Event: e.Type, Data: e})
+			case <-heartbeat.C:
+				c.Writer.WriteString(": heartbeat\n\n")
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// Socket upgrades to a WebSocket on which clients subscribe to products and
+// receive their stock and price changes. The token goes in the
+// Authorization header or, for clients that can't set it, ?access_token.
+func (h *LiveHandler) Socket() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			token = c.Query("access_token")
+		}
+		tenantID, ok := h.auth.Authenticate(token)
+		if !ok {
+			web.Error(c, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// The upgrader already answered with the error
+			return
+		}
+		h.liveService.ServeSocket(tenant.WithID(c.Request.Context(), tenantID), conn)
+	}
+}
+
+// parseFilter reads a comma separated list of product ids
+func parseFilter(ids string) (live.Filter, error) {
+	filter := live.Filter{ProductIDs: map[int]bool{}}
+	if ids == "" {
+		return filter, nil
+	}
+	for _, s := range strings.Split(ids, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return filter, err
+		}
+		filter.ProductIDs[id] = true
+	}
+	return filter, nil
+}
+
+func parseLastEventID(c *gin.Context) (int64, error) {
+	id := c.GetHeader("Last-Event-ID")
+	if id == "" {
+		id = c.Query("last_event_id")
+	}
+	if id == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(id, 10, 64)
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vincentconace/api-gin/pkg/logging"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+// LogLevelRequest is the body of Set
+type LogLevelRequest struct {
+	Level string `json:"level" binding:"required"`
+}
+
+// LogLevelResponse is the log level in effect
+type LogLevelResponse struct {
+	Level string `json:"level"`
+}
+
+// LogLevelHandler reads and changes the log level of the running process
+type LogLevelHandler struct {
+	level *slog.LevelVar
+	log   *slog.Logger
+}
+
+func NewLogLevelHandler(level *slog.LevelVar, log *slog.Logger) *LogLevelHandler {
+	return &LogLevelHandler{level: level, log: log}
+}
+
+func (h *LogLevelHandler) Get() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		web.Success(c, http.StatusOK, LogLevelResponse{Level: strings.ToLower(h.level.Level().String())})
+	}
+}
+
+func (h *LogLevelHandler) Set() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LogLevelRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid request")
+			return
+		}
+		level, err := logging.ParseLevel(req.Level)
+		if err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid level, use debug, info, warn or error")
+			return
+		}
+		previous := h.level.Level()
+		h.level.Set(level)
+		h.log.InfoContext(c, "log level changed", "from", previous.String(), "to", level.String())
+		web.Success(c, http.StatusOK, LogLevelResponse{Level: strings.ToLower(level.String())})
+	}
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/media"
+	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+// Maximum number of files accepted in a single upload request
+const maxUploadFiles = 10
+
+type MediaHandler struct {
+	mediaService media.Service
+	redis        *redis.Client
+}
+
+func NewMediaHandler(mediaService media.Service, rd *redis.Client) *MediaHandler {
+	return &MediaHandler{mediaService: mediaService, redis: rd}
+}
+
+func (h *MediaHandler) Upload() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadFiles*(media.MaxSize+1<<10))
+		form, err := c.MultipartForm()
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid multipart form")
+			return
+		}
+		files := form.File["file"]
+		if len(files) == 0 {
+			web.Error(c, http.StatusBadRequest, "required fields: file")
+			return
+		}
+		if len(files) > maxUploadFiles {
+			web.Error(c, http.StatusBadRequest, "at most %d files per request", maxUploadFiles)
+			return
+		}
+
+		uploaded := make([]domain.Media, 0, len(files))
+		for _, fh := range files {
+			if fh.Size > media.MaxSize {
+				web.Error(c, http.StatusRequestEntityTooLarge, "%s: %s", fh.Filename, media.ErrTooLarge)
+				return
+			}
+			f, err := fh.Open()
+			if err != nil {
+				web.Error(c, http.StatusBadRequest, "invalid file %s", fh.Filename)
+				return
+			}
+			m, err := h.mediaService.Upload(c, productID, fh.Filename, f)
+			f.Close()
+			if err != nil {
+				mediaError(c, err)
+				return
+			}
+			uploaded = append(uploaded, m)
+		}
+
+		h.invalidate(c, productID)
+		web.Success(c, http.StatusCreated, uploaded)
+	}
+}
+
+func (h *MediaHandler) List() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		list, err := h.mediaService.List(c, productID)
+		if err != nil {
+			mediaError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, list)
+	}
+}
+
+// MediaRequest is the body of Update
+type MediaRequest struct {
+	Position  *int  `json:"position"`
+	IsPrimary *bool `json:"is_primary"`
+}
+
+func (h *MediaHandler) Update() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		mediaID, err := strconv.Atoi(c.Param("mediaId"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid media id")
+			return
+		}
+		var req MediaRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "unprocesable request")
+			return
+		}
+
+		m, err := h.mediaService.Update(c, productID, mediaID, req.Position, req.IsPrimary)
+		if err != nil {
+			mediaError(c, err)
+			return
+		}
+
+		h.invalidate(c, productID)
+		web.Success(c, http.StatusOK, m)
+	}
+}
+
+func (h *MediaHandler) Delete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		mediaID, err := strconv.Atoi(c.Param("mediaId"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid media id")
+			return
+		}
+
+		if err := h.mediaService.Delete(c, productID, mediaID); err != nil {
+			mediaError(c, err)
+			return
+		}
+
+		h.invalidate(c, productID)
+		web.Success(c, http.StatusNoContent, "")
+	}
+}
+
+// invalidate drops the cached product so the next read picks up media changes
+func (h *MediaHandler) invalidate(c *gin.Context, productID int) {
+	h.redis.Del(c, productKey(c, productID))
+}
+
+func mediaError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, product.ErrNotFound), errors.Is(err, media.ErrNotFound):
+		web.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, media.ErrTooLarge):
+		web.Error(c, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, media.ErrUnsupportedMediaType), errors.Is(err, media.ErrInvalidImage):
+		web.Error(c, http.StatusUnsupportedMediaType, err.Error())
+	default:
+		web.Error(c, http.StatusInternalServerError, ErrInternal.Error())
+	}
+}
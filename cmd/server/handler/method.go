@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+// CustomMethods serves routes registered as "/<resource>:method", such as
+// POST /products:batch, dispatching on the name after the colon. Gin reads
+// the whole suffix as a single param, so custom methods of a resource
+// share one route.
+func CustomMethods(methods map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handler, ok := methods[strings.TrimPrefix(c.Param("method"), ":")]
+		if !ok {
+			web.Error(c, http.StatusNotFound, "route not found")
+			return
+		}
+		handler(c)
+	}
+}
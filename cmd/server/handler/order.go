@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/order"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+type OrderHandler struct {
+	orderService order.Service
+	redis        *redis.Client
+}
+
+func NewOrderHandler(orderService order.Service, rd *redis.Client) *OrderHandler {
+	return &OrderHandler{orderService: orderService, redis: rd}
+}
+
+func (h *OrderHandler) Get() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orders, err := h.orderService.Get(c)
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, orders)
+	}
+}
+
+func (h *OrderHandler) GetById() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		o, err := h.orderService.GetById(c, id)
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, o)
+	}
+}
+
+// OrderRequest is the body of Create
+type OrderRequest struct {
+	Reference string `json:"reference,omitempty"`
+	Items     []struct {
+		ProductID int `json:"product_id"`
+		Quantity  int `json:"quantity"`
+	} `json:"items"`
+}
+
+func (h *OrderHandler) Create() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req OrderRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid request")
+			return
+		}
+
+		items := make([]domain.OrderItem, len(req.Items))
+		for i, item := range req.Items {
+			items[i] = domain.OrderItem{ProductID: item.ProductID, Quantity: item.Quantity}
+		}
+
+		o, err := h.orderService.Create(c, req.Reference, items)
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		h.invalidate(c, o)
+		web.Success(c, http.StatusCreated, o)
+	}
+}
+
+// OrderStatusRequest is the body of UpdateStatus
+type OrderStatusRequest struct {
+	Status string `json:"status"`
+}
+
+func (h *OrderHandler) UpdateStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		var req OrderStatusRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.Status == "" {
+			web.Error(c, http.StatusUnprocessableEntity, "required fields: status")
+			return
+		}
+
+		o, err := h.orderService.UpdateStatus(c, id, req.Status)
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		if o.Status == order.StatusCancelled {
+			h.invalidate(c, o)
+		}
+		web.Success(c, http.StatusOK, o)
+	}
+}
+
+// invalidate drops the cached products of the order so reads see the new stock
+func (h *OrderHandler) invalidate(c *gin.Context, o domain.Order) {
+	for _, item := range o.Items {
+		h.redis.Del(c, productKey(c, item.ProductID))
+	}
+}
+
+func orderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, order.ErrNotFound), errors.Is(err, order.ErrProductNotFound):
+		web.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, order.ErrInsufficientStock), errors.Is(err, order.ErrInvalidTransition):
+		web.Error(c, http.StatusConflict, err.Error())
+	case errors.Is(err, order.ErrEmptyOrder), errors.Is(err, order.ErrInvalidQuantity), errors.Is(err, order.ErrInvalidStatus):
+		web.Error(c, http.StatusUnprocessableEntity, err.Error())
+	default:
+		web.Error(c, http.StatusInternalServerError, ErrInternal.Error())
+	}
+}
@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"reflect"
 	"strconv"
@@ -13,7 +16,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/exporter"
+	"github.com/vincentconace/api-gin/internal/job"
+	"github.com/vincentconace/api-gin/internal/media"
 	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/pkg/metrics"
+	"github.com/vincentconace/api-gin/pkg/tenant"
 	"github.com/vincentconace/api-gin/pkg/web"
 )
 
@@ -21,13 +29,19 @@ var (
 	ErrInternal = errors.New("internal error")
 )
 
+// Name of the product cache in metrics
+const productCache = "product"
+
 type ProductHandler struct {
 	productService product.Service
+	mediaService   media.Service
+	jobService     job.Service
 	redis          *redis.Client
+	log            *slog.Logger
 }
 
-func NewProductHandler(productService product.Service, rd *redis.Client) *ProductHandler {
-	return &ProductHandler{productService: productService, redis: rd}
+func NewProductHandler(productService product.Service, mediaService media.Service, jobService job.Service, rd *redis.Client, log *slog.Logger) *ProductHandler {
+	return &ProductHandler{productService: productService, mediaService: mediaService, jobService: jobService, redis: rd, log: log}
 }
 
 func (h *ProductHandler) Get() gin.HandlerFunc {
@@ -37,6 +51,13 @@ func (h *ProductHandler) Get() gin.HandlerFunc {
 			web.Error(c, http.StatusNotFound, "product not found")
 			return
 		}
+		refs := make([]*domain.Product, len(products))
+		for i := range products {
+			refs[i] = &products[i]
+		}
+		if err := h.mediaService.Attach(c, refs...); err != nil {
+			h.log.ErrorContext(c, "attach product media", "error", err)
+		}
 		web.Success(c, http.StatusOK, products)
 	}
 }
@@ -48,18 +69,27 @@ func (h *ProductHandler) GetById() gin.HandlerFunc {
 		if err != nil {
 			web.Error(c, http.StatusBadRequest, "invalid id")
 		}
-		key := fmt.Sprintf("product[%d]", idConv)
+		key := productKey(c, idConv)
 		productRedis, err := h.redis.Get(c, key).Result()
-		if err != nil {
-			fmt.Println(err)
+		switch {
+		case err == redis.Nil:
+			metrics.CacheResult(productCache, metrics.CacheMiss)
+		case err != nil:
+			metrics.CacheResult(productCache, metrics.CacheError)
+			h.log.WarnContext(c, "read product cache", "product_id", idConv, "error", err)
+		default:
+			metrics.CacheResult(productCache, metrics.CacheHit)
 		}
 		if productRedis != "" {
 			var product domain.Product
 			err = json.Unmarshal([]byte(productRedis), &product)
 			if err != nil {
-				fmt.Println(err)
+				h.log.ErrorContext(c, "decode cached product", "product_id", idConv, "error", err)
+			}
+			h.log.DebugContext(c, "product served from cache", "product_id", idConv)
+			if err := h.mediaService.Attach(c, &product); err != nil {
+				h.log.ErrorContext(c, "attach product media", "product_id", idConv, "error", err)
 			}
-			fmt.Println("Devolvio desde redis")
 			web.Success(c, http.StatusOK, product)
 			return
 		}
@@ -68,6 +98,9 @@ func (h *ProductHandler) GetById() gin.HandlerFunc {
 			web.Error(c, http.StatusNotFound, "product not found")
 			return
 		}
+		if err := h.mediaService.Attach(c, &product); err != nil {
+			h.log.ErrorContext(c, "attach product media", "product_id", idConv, "error", err)
+		}
 
 		web.Success(c, http.StatusOK, product)
 	}
@@ -84,7 +117,7 @@ func (h *ProductHandler) Create() gin.HandlerFunc {
 		productReflect := reflect.ValueOf(p)
 		var valuesNil []string
 		for i := 0; i < productReflect.NumField(); i++ {
-			if e := productReflect.Field(i); e.IsNil() &&
+			if e := productReflect.Field(i); e.Kind() == reflect.Ptr && e.IsNil() &&
 				productReflect.Type().Field(i).Name != "ID" {
 				valuesNil = append(valuesNil, productReflect.Type().Field(i).Name)
 			}
@@ -94,6 +127,8 @@ func (h *ProductHandler) Create() gin.HandlerFunc {
 			web.Error(c, 422, "required fields: %s", strings.Join(valuesNil, ", "))
 			return
 		}
+		// Media is managed through its own endpoints
+		p.Media = nil
 
 		product, err := h.productService.Create(c, p)
 		if err != nil {
@@ -103,13 +138,15 @@ func (h *ProductHandler) Create() gin.HandlerFunc {
 
 		dataByte, err := json.Marshal(product)
 		if err != nil {
-			fmt.Println(err)
+			h.log.ErrorContext(c, "encode product for cache", "product_id", *product.ID, "error", err)
 		}
 
-		key := fmt.Sprintf("product[%d]", *product.ID)
-		productRedis, _ := h.redis.Set(c, key, string(dataByte), 24*time.Hour).Result()
-		if productRedis != "" {
-			fmt.Println("El producto se guardo correctamente", productRedis)
+		key := productKey(c, *product.ID)
+		if err := h.redis.Set(c, key, string(dataByte), 24*time.Hour).Err(); err != nil {
+			metrics.CacheResult(productCache, metrics.CacheError)
+			h.log.WarnContext(c, "cache product", "product_id", *product.ID, "error", err)
+		} else {
+			h.log.DebugContext(c, "product cached", "product_id", *product.ID)
 		}
 
 		web.Success(c, http.StatusOK, product)
@@ -155,12 +192,154 @@ func (h *ProductHandler) Delete() gin.HandlerFunc {
 			return
 		}
 
-		key := fmt.Sprintf("product[%d]", idConv)
-		result, _ := h.redis.Del(c, key).Result()
-		if result > 0 {
-			fmt.Println("El producto se elimino correctamente")
+		key := productKey(c, idConv)
+		result, err := h.redis.Del(c, key).Result()
+		if err != nil {
+			metrics.CacheResult(productCache, metrics.CacheError)
+			h.log.WarnContext(c, "evict product from cache", "product_id", idConv, "error", err)
+		} else if result > 0 {
+			h.log.DebugContext(c, "product evicted from cache", "product_id", idConv)
 		}
 
 		web.Success(c, http.StatusNoContent, "")
 	}
 }
+
+// BatchRequest is the body of Batch
+type BatchRequest struct {
+	Mode       string                         `json:"mode,omitempty"`
+	Operations []domain.ProductBatchOperation `json:"operations" binding:"required"`
+}
+
+func (h *ProductHandler) Batch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req BatchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid request")
+			return
+		}
+		if req.Mode == "" {
+			req.Mode = product.BatchAtomic
+		}
+
+		results, err := h.productService.Batch(c, req.Mode, req.Operations)
+		if err != nil {
+			switch {
+			case errors.Is(err, product.ErrInvalidBatchMode), errors.Is(err, product.ErrEmptyBatch), errors.Is(err, product.ErrBatchTooLarge):
+				web.Error(c, http.StatusUnprocessableEntity, err.Error())
+			default:
+				web.Error(c, http.StatusInternalServerError, ErrInternal.Error())
+			}
+			return
+		}
+
+		status := http.StatusOK
+		var keys []string
+		for _, res := range results {
+			switch res.Status {
+			case product.StatusUpdated, product.StatusDeleted:
+				keys = append(keys, productKey(c, *res.ID))
+			case product.StatusFailed, product.StatusSkipped:
+				status = http.StatusMultiStatus
+			}
+		}
+		if len(keys) > 0 {
+			h.redis.Del(c, keys...)
+		}
+		if req.Mode == product.BatchAtomic && status != http.StatusOK {
+			status = http.StatusUnprocessableEntity
+		}
+
+		web.Success(c, status, results)
+	}
+}
+
+func (h *ProductHandler) Export() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.DefaultQuery("format", exporter.FormatCSV)
+		format, ok := exporter.Formats[name]
+		if !ok {
+			web.Error(c, http.StatusBadRequest, exporter.ErrUnsupportedFormat.Error())
+			return
+		}
+
+		// The response starts with the first row, so a failing query can
+		// still be reported as a regular error
+		var out exporter.Writer
+		var gz *gzip.Writer
+		open := func() error {
+			c.Header("Content-Type", format.ContentType)
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="products-%s%s"`, time.Now().UTC().Format("20060102-150405"), format.Extension))
+			var w io.Writer = c.Writer
+			if format.Compressible && strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+				c.Header("Content-Encoding", "gzip")
+				c.Header("Vary", "Accept-Encoding")
+				gz = gzip.NewWriter(c.Writer)
+				w = gz
+			}
+			var err error
+			out, err = exporter.NewWriter(name, w)
+			return err
+		}
+
+		err := h.productService.Stream(c, func(p domain.Product) error {
+			if out == nil {
+				if err := open(); err != nil {
+					return err
+				}
+			}
+			return out.Write(p)
+		})
+		if err == nil && out == nil {
+			err = open()
+		}
+		if err != nil {
+			if !c.Writer.Written() {
+				for _, header := range []string{"Content-Type", "Content-Disposition", "Content-Encoding"} {
+					c.Writer.Header().Del(header)
+				}
+				web.Error(c, http.StatusInternalServerError, ErrInternal.Error())
+				return
+			}
+			// Headers are sent, leave the output truncated so the client
+			// sees an incomplete download
+			h.log.ErrorContext(c, "export products", "error", err)
+			c.Abort()
+			return
+		}
+
+		if err := out.Close(); err != nil {
+			h.log.ErrorContext(c, "finish product export", "error", err)
+			return
+		}
+		if gz != nil {
+			if err := gz.Close(); err != nil {
+				h.log.ErrorContext(c, "finish product export", "error", err)
+			}
+		}
+	}
+}
+
+// ExportAsync runs the export as a background job whose result links the
+// stored file.
+func (h *ProductHandler) ExportAsync() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.DefaultQuery("format", exporter.FormatCSV)
+		if _, ok := exporter.Formats[format]; !ok {
+			web.Error(c, http.StatusBadRequest, exporter.ErrUnsupportedFormat.Error())
+			return
+		}
+		j, err := h.jobService.Enqueue(c, exporter.JobType, exporter.JobPayload{Format: format})
+		if err != nil {
+			jobError(c, err)
+			return
+		}
+		web.Success(c, http.StatusAccepted, j)
+	}
+}
+
+// productKey is the cache key of a product, per tenant since ids alone
+// don't say whose product it is
+func productKey(c *gin.Context, id int) string {
+	return tenant.Key(c, fmt.Sprintf("product[%d]", id))
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/user"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+type UserHandler struct {
+	userService user.Service
+}
+
+func NewUserHandler(userService user.Service) *UserHandler {
+	return &UserHandler{userService: userService}
+}
+
+// RegisterRequest is the body of Register
+type RegisterRequest struct {
+	Email    string `json:"email"`
+	Name     string `json:"name,omitempty"`
+	Password string `json:"password"`
+}
+
+func (h *UserHandler) Register() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RegisterRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid request")
+			return
+		}
+		if req.Email == "" || req.Password == "" {
+			web.Error(c, http.StatusUnprocessableEntity, "required fields: email, password")
+			return
+		}
+
+		u, err := h.userService.Register(c, domain.User{Email: req.Email, Name: req.Name}, req.Password)
+		if err != nil {
+			userError(c, err)
+			return
+		}
+		web.Success(c, http.StatusCreated, u)
+	}
+}
+
+// LoginRequest is the body of Login
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (h *UserHandler) Login() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid request")
+			return
+		}
+
+		tokens, err := h.userService.Login(c, req.Email, req.Password)
+		if err != nil {
+			userError(c, err)
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		web.Success(c, http.StatusOK, tokens)
+	}
+}
+
+func (h *UserHandler) Refresh() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := refreshToken(c)
+		if !ok {
+			return
+		}
+		tokens, err := h.userService.Refresh(c, token)
+		if err != nil {
+			userError(c, err)
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		web.Success(c, http.StatusOK, tokens)
+	}
+}
+
+func (h *UserHandler) Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := refreshToken(c)
+		if !ok {
+			return
+		}
+		if err := h.userService.Logout(c, token); err != nil {
+			userError(c, err)
+			return
+		}
+		web.Success(c, http.StatusNoContent, "")
+	}
+}
+
+// PasswordResetRequest is the body of RequestPasswordReset
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// RequestPasswordReset answers 202 whether or not the email is known
+func (h *UserHandler) RequestPasswordReset() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req PasswordResetRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid request")
+			return
+		}
+		if err := h.userService.RequestPasswordReset(c, req.Email); err != nil {
+			userError(c, err)
+			return
+		}
+		web.Success(c, http.StatusAccepted, "")
+	}
+}
+
+// PasswordResetConfirmRequest is the body of ResetPassword
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (h *UserHandler) ResetPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req PasswordResetConfirmRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid request")
+			return
+		}
+		if req.Token == "" || req.Password == "" {
+			web.Error(c, http.StatusUnprocessableEntity, "required fields: token, password")
+			return
+		}
+		if err := h.userService.ResetPassword(c, req.Token, req.Password); err != nil {
+			userError(c, err)
+			return
+		}
+		web.Success(c, http.StatusNoContent, "")
+	}
+}
+
+// Me returns the user behind the access token
+func (h *UserHandler) Me() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, _ := auth.FromContext(c)
+		id, ok := user.UserID(p)
+		if !ok {
+			web.Error(c, http.StatusForbidden, "caller is not a user")
+			return
+		}
+		u, err := h.userService.GetById(c, id)
+		if err != nil {
+			userError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, u)
+	}
+}
+
+func (h *UserHandler) GetById() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		u, err := h.userService.GetById(c, id)
+		if err != nil {
+			userError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, u)
+	}
+}
+
+// RolesRequest is the body of SetRoles
+type RolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+func (h *UserHandler) SetRoles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		var req RolesRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid request")
+			return
+		}
+		u, err := h.userService.SetRoles(c, id, req.Roles)
+		if err != nil {
+			userError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, u)
+	}
+}
+
+// RefreshRequest is the body of Refresh and Logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refreshToken reads the refresh token of the body, answering the request
+// when there is none
+func refreshToken(c *gin.Context) (string, bool) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		web.Error(c, http.StatusUnprocessableEntity, "required fields: refresh_token")
+		return "", false
+	}
+	return req.RefreshToken, true
+}
+
+func userError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, user.ErrNotFound):
+		web.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, user.ErrEmailTaken):
+		web.Error(c, http.StatusConflict, err.Error())
+	case errors.Is(err, user.ErrInvalidEmail), errors.Is(err, user.ErrWeakPassword),
+		errors.Is(err, user.ErrPasswordTooLong), errors.Is(err, user.ErrInvalidResetToken):
+		web.Error(c, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, user.ErrInvalidCredentials), errors.Is(err, user.ErrInvalidRefreshToken),
+		errors.Is(err, user.ErrRefreshTokenReused):
+		web.Error(c, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, user.ErrLocked):
+		web.Error(c, http.StatusLocked, err.Error())
+	default:
+		web.Error(c, http.StatusInternalServerError, ErrInternal.Error())
+	}
+}
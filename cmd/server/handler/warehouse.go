@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/internal/warehouse"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+type WarehouseHandler struct {
+	warehouseService warehouse.Service
+	productService   product.Service
+	redis            *redis.Client
+}
+
+func NewWarehouseHandler(warehouseService warehouse.Service, productService product.Service, rd *redis.Client) *WarehouseHandler {
+	return &WarehouseHandler{warehouseService: warehouseService, productService: productService, redis: rd}
+}
+
+func (h *WarehouseHandler) Get() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		warehouses, err := h.warehouseService.Get(c)
+		if err != nil {
+			warehouseError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, warehouses)
+	}
+}
+
+func (h *WarehouseHandler) GetById() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		w, err := h.warehouseService.GetById(c, id)
+		if err != nil {
+			warehouseError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, w)
+	}
+}
+
+func (h *WarehouseHandler) Create() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var w domain.Warehouse
+		if err := c.ShouldBindJSON(&w); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid request")
+			return
+		}
+		if w.Code == "" || w.Name == "" {
+			web.Error(c, http.StatusUnprocessableEntity, "required fields: code, name")
+			return
+		}
+
+		w, err := h.warehouseService.Create(c, w)
+		if err != nil {
+			warehouseError(c, err)
+			return
+		}
+		web.Success(c, http.StatusCreated, w)
+	}
+}
+
+func (h *WarehouseHandler) Update() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		var w domain.Warehouse
+		if err := c.ShouldBindJSON(&w); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "unprocesable request")
+			return
+		}
+		if w.Code == "" || w.Name == "" {
+			web.Error(c, http.StatusUnprocessableEntity, "required fields: code, name")
+			return
+		}
+
+		w, err = h.warehouseService.Update(c, id, w)
+		if err != nil {
+			warehouseError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, w)
+	}
+}
+
+func (h *WarehouseHandler) Delete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		if err := h.warehouseService.Delete(c, id); err != nil {
+			warehouseError(c, err)
+			return
+		}
+		web.Success(c, http.StatusNoContent, "")
+	}
+}
+
+// QuantityRequest is the body of SetStock and of CartHandler.SetItem
+type QuantityRequest struct {
+	Quantity *int `json:"quantity"`
+}
+
+func (h *WarehouseHandler) SetStock() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		warehouseID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		productID, err := strconv.Atoi(c.Param("productId"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid product id")
+			return
+		}
+		var req QuantityRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.Quantity == nil {
+			web.Error(c, http.StatusUnprocessableEntity, "required fields: quantity")
+			return
+		}
+
+		if err := h.warehouseService.SetStock(c, warehouseID, productID, *req.Quantity); err != nil {
+			warehouseError(c, err)
+			return
+		}
+
+		h.invalidate(c, productID)
+		inv, err := h.warehouseService.ProductInventory(c, productID)
+		if err != nil {
+			warehouseError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, inv)
+	}
+}
+
+func (h *WarehouseHandler) Transfer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var t domain.Transfer
+		if err := c.ShouldBindJSON(&t); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid request")
+			return
+		}
+		if t.ProductID == 0 || t.FromWarehouseID == 0 || t.ToWarehouseID == 0 {
+			web.Error(c, http.StatusUnprocessableEntity, "required fields: product_id, from_warehouse_id, to_warehouse_id, quantity")
+			return
+		}
+
+		t, err := h.warehouseService.Transfer(c, t)
+		if err != nil {
+			warehouseError(c, err)
+			return
+		}
+		web.Success(c, http.StatusCreated, t)
+	}
+}
+
+func (h *WarehouseHandler) ProductInventory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		if _, err := h.productService.GetById(c, productID); err != nil {
+			web.Error(c, http.StatusNotFound, "product not found")
+			return
+		}
+
+		inv, err := h.warehouseService.ProductInventory(c, productID)
+		if err != nil {
+			warehouseError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, inv)
+	}
+}
+
+// invalidate drops the cached product so the next read sees the new stock
+func (h *WarehouseHandler) invalidate(c *gin.Context, productID int) {
+	h.redis.Del(c, productKey(c, productID))
+}
+
+func warehouseError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, warehouse.ErrNotFound), errors.Is(err, warehouse.ErrProductNotFound):
+		web.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, warehouse.ErrWarehouseAlredyExist), errors.Is(err, warehouse.ErrWarehouseNotEmpty),
+		errors.Is(err, warehouse.ErrInsufficientStock):
+		web.Error(c, http.StatusConflict, err.Error())
+	case errors.Is(err, warehouse.ErrInvalidQuantity), errors.Is(err, warehouse.ErrSameWarehouse):
+		web.Error(c, http.StatusUnprocessableEntity, err.Error())
+	default:
+		web.Error(c, http.StatusInternalServerError, ErrInternal.Error())
+	}
+}
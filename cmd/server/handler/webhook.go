@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/webhook"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+type WebhookHandler struct {
+	webhookService webhook.Service
+}
+
+func NewWebhookHandler(webhookService webhook.Service) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+func (h *WebhookHandler) Get() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhooks, err := h.webhookService.Get(c)
+		if err != nil {
+			webhookError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, webhooks)
+	}
+}
+
+func (h *WebhookHandler) GetById() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		w, err := h.webhookService.GetById(c, id)
+		if err != nil {
+			webhookError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, w)
+	}
+}
+
+// WebhookRequest is the body of Create
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+func (h *WebhookHandler) Create() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req WebhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			web.Error(c, http.StatusUnprocessableEntity, "invalid request")
+			return
+		}
+		if req.URL == "" {
+			web.Error(c, http.StatusUnprocessableEntity, "required fields: url")
+			return
+		}
+
+		w, err := h.webhookService.Create(c, domain.Webhook{URL: req.URL, Events: req.Events, Secret: req.Secret})
+		if err != nil {
+			webhookError(c, err)
+			return
+		}
+		web.Success(c, http.StatusCreated, w)
+	}
+}
+
+func (h *WebhookHandler) Delete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		if err := h.webhookService.Delete(c, id); err != nil {
+			webhookError(c, err)
+			return
+		}
+		web.Success(c, http.StatusNoContent, "")
+	}
+}
+
+func (h *WebhookHandler) Deliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		deliveries, err := h.webhookService.Deliveries(c, id)
+		if err != nil {
+			webhookError(c, err)
+			return
+		}
+		web.Success(c, http.StatusOK, deliveries)
+	}
+}
+
+func (h *WebhookHandler) Redeliver() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid id")
+			return
+		}
+		deliveryID, err := strconv.Atoi(c.Param("deliveryId"))
+		if err != nil {
+			web.Error(c, http.StatusBadRequest, "invalid delivery id")
+			return
+		}
+		j, err := h.webhookService.Redeliver(c, id, deliveryID)
+		if err != nil {
+			webhookError(c, err)
+			return
+		}
+		web.Success(c, http.StatusAccepted, j)
+	}
+}
+
+func webhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, webhook.ErrNotFound), errors.Is(err, webhook.ErrDeliveryNotFound):
+		web.Error(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, webhook.ErrInvalidURL), errors.Is(err, webhook.ErrPrivateURL), errors.Is(err, webhook.ErrInvalidEvent):
+		web.Error(c, http.StatusUnprocessableEntity, err.Error())
+	default:
+		web.Error(c, http.StatusInternalServerError, ErrInternal.Error())
+	}
+}
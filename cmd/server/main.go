@@ -1,36 +1,160 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/vincentconace/api-gin/cmd/server/router"
+	"github.com/vincentconace/api-gin/internal/job"
+	"github.com/vincentconace/api-gin/internal/live"
+	"github.com/vincentconace/api-gin/internal/outbox"
+	"github.com/vincentconace/api-gin/internal/webhook"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/blob"
 	"github.com/vincentconace/api-gin/pkg/db"
+	"github.com/vincentconace/api-gin/pkg/logging"
+	"github.com/vincentconace/api-gin/pkg/metrics"
 	"github.com/vincentconace/api-gin/pkg/redis"
+	"github.com/vincentconace/api-gin/pkg/tracing"
 )
 
 func main() {
+	// Init logger, LOG_LEVEL sets the starting level
+	lg, lv := logging.Init()
+	slog.SetDefault(lg)
+
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		fatal(lg, "load .env file", err)
 	}
 	// Init database connection
 	db, err := db.Init()
 	if err != nil {
-		panic(err)
+		fatal(lg, "connect database", err)
 	}
 	defer db.Close()
-	r := gin.Default()
+	lg.Info("database connected", "host", os.Getenv("HOST"), "database", os.Getenv("DB_NAME"))
+	if err := metrics.RegisterDB(db, os.Getenv("DB_NAME")); err != nil {
+		fatal(lg, "register database metrics", err)
+	}
+
+	// Init tracing, OTEL_TRACES_EXPORTER picks where spans go
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		fatal(lg, "init tracing", err)
+	}
+
+	// Every request gets a span, an ID, an access log line and a latency
+	// sample. Handlers pass the gin context on, which must reach the span
+	// of the request.
+	r := gin.New()
+	r.ContextWithFallback = true
+	// Only these proxies may name the client IP in X-Forwarded-For, rate
+	// limits and idempotency keys of anonymous callers rely on it
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		fatal(lg, "set trusted proxies", err)
+	}
+	r.Use(tracing.Middleware(), logging.Middleware(lg), metrics.Middleware(), logging.Recovery(lg))
 
 	// Init redis connection
 	rd := redis.RedisClient()
 
-	// Run server
-	router := router.NewRouter(r, db, rd)
+	// Init media storage
+	bs, err := blob.Init()
+	if err != nil {
+		fatal(lg, "init media storage", err)
+	}
+	if os.Getenv("BLOB_DRIVER") != "s3" {
+		r.Static("/media", blob.LocalDir())
+	}
+
+	// Init token verification for protected routes
+	verifier, err := auth.Init()
+	if err != nil {
+		fatal(lg, "init token verification", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Init background jobs, handlers are registered by the router
+	jobs := job.NewService(job.NewRepository(rd), lg)
+
+	// Live event streams share one Redis subscription per replica
+	hub := live.NewHub(lg)
+	go hub.Run(ctx, rd)
+
+	router := router.NewRouter(r, db, rd, bs, jobs, hub, verifier, lg, lv)
 	router.MapaRuter()
+	router.Run(ctx)
+
+	workers, err := strconv.Atoi(os.Getenv("JOB_WORKERS"))
+	if err != nil || workers < 1 {
+		workers = 2
+	}
+	workersDone := make(chan struct{})
+	go func() {
+		jobs.Run(ctx, workers, 30*time.Second)
+		close(workersDone)
+	}()
+
+	// Relay product events written to the outbox to the stream, live
+	// subscribers and webhooks
+	stream := os.Getenv("EVENTS_STREAM")
+	if stream == "" {
+		stream = "product-events"
+	}
+	publisher := outbox.NewFanoutPublisher(
+		outbox.NewRedisStreamPublisher(rd, stream, 100000),
+		outbox.NewRedisPubSubPublisher(rd, live.Channel),
+		webhook.NewService(webhook.NewRepository(db), jobs, lg),
+	)
+	relay := outbox.NewRelay(outbox.NewRepository(db), publisher, time.Second, 100, lg)
+	go relay.Run(ctx)
 
-	if err := r.Run(":8080"); err != nil {
-		panic(err)
+	// Run server until interrupted, then let requests and jobs finish
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		lg.Info("server listening", "addr", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal(lg, "serve", err)
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	lg.Info("shutting down")
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		lg.Error("shut down server", "error", err)
+	}
+	<-workersDone
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		lg.Error("flush traces", "error", err)
 	}
 }
+
+// trustedProxies reads the comma separated TRUSTED_PROXIES, none by default
+func trustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+func fatal(lg *slog.Logger, msg string, err error) {
+	lg.Error(msg, "error", err)
+	os.Exit(1)
+}
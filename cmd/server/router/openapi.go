@@ -0,0 +1,517 @@
+package router
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vincentconace/api-gin/cmd/server/handler"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/exporter"
+	"github.com/vincentconace/api-gin/internal/user"
+	"github.com/vincentconace/api-gin/pkg/idempotency"
+	"github.com/vincentconace/api-gin/pkg/openapi"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+// Paths of the API documentation
+const (
+	specPath = "/openapi.json"
+	docsPath = "/docs/"
+)
+
+// operation documents a registered route. Successes wrap data in the
+// web.Response envelope and errors are a web.ErrorResponse, unless the
+// route is raw.
+type operation struct {
+	method  string
+	path    string // as registered in gin
+	tag     string
+	summary string
+	// role is the policy the route requires, auth marks routes open to
+	// any authenticated caller
+	role       string
+	auth       bool
+	idempotent bool
+	// stringParams are path params that aren't integers
+	stringParams []string
+	params       []openapi.Parameter
+	// body is the JSON request body, request documents other encodings
+	body    interface{}
+	request *openapi.RequestBody
+	// status is the success status, data what it returns in the envelope.
+	// also lists other statuses returning the same envelope.
+	status int
+	data   interface{}
+	also   []int
+	// accepted is what runs moved to a background job return with 202
+	accepted interface{}
+	errors   []int
+	// responses documents successes outside the envelope
+	responses map[int]*openapi.Response
+	// raw routes skip the API middleware: no auth, rate limit or envelopes
+	raw bool
+}
+
+// oneOf is data that takes one of several shapes
+type oneOf []interface{}
+
+// operations lists every route of the API. A test fails when a route is
+// registered without being listed here.
+var operations = []operation{
+	// Products
+	{method: http.MethodPost, path: "/api/v1/products", tag: "products", summary: "Create a product",
+		role: productsWrite, idempotent: true, body: domain.Product{},
+		status: http.StatusOK, data: domain.Product{}, errors: []int{http.StatusBadRequest, http.StatusUnprocessableEntity}},
+	{method: http.MethodGet, path: "/api/v1/products", tag: "products", summary: "List products",
+		status: http.StatusOK, data: []domain.Product{}, errors: []int{http.StatusNotFound}},
+	{method: http.MethodGet, path: "/api/v1/products/export", tag: "products", summary: "Export the catalog as a file",
+		params:    []openapi.Parameter{formatParam()},
+		responses: map[int]*openapi.Response{http.StatusOK: exportResponse()},
+		errors:    []int{http.StatusBadRequest}},
+	{method: http.MethodPost, path: "/api/v1/products/export", tag: "products", summary: "Export the catalog in a background job",
+		role: productsWrite, idempotent: true, params: []openapi.Parameter{formatParam()},
+		status: http.StatusAccepted, data: domain.Job{}, errors: []int{http.StatusBadRequest}},
+	{method: http.MethodGet, path: "/api/v1/products/:id", tag: "products", summary: "Get a product",
+		status: http.StatusOK, data: domain.Product{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodPatch, path: "/api/v1/products/:id", tag: "products", summary: "Update the fields sent of a product",
+		role: productsWrite, body: domain.Product{},
+		status: http.StatusOK, data: domain.Product{}, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity}},
+	{method: http.MethodDelete, path: "/api/v1/products/:id", tag: "products", summary: "Delete a product",
+		role: productsWrite, status: http.StatusNoContent, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodPost, path: "/api/v1/products:method", tag: "products", summary: "Run a custom method on products",
+		role: productsWrite, idempotent: true, params: []openapi.Parameter{importParam("mode", "Import mode, atomic by default"),
+			importParam("dry_run", "Validate the import without saving it"), importParam("async", "Import in a background job")},
+		body: handler.BatchRequest{}, request: importRequest(),
+		status: http.StatusOK, data: oneOf{[]domain.ProductBatchResult{}, domain.ProductImport{}},
+		also: []int{http.StatusMultiStatus, http.StatusUnprocessableEntity}, accepted: domain.Job{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge,
+			http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity}},
+
+	// Product media
+	{method: http.MethodPost, path: "/api/v1/products/:id/media", tag: "media", summary: "Upload product images",
+		role: productsWrite, idempotent: true, request: uploadRequest(),
+		status: http.StatusCreated, data: []domain.Media{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType}},
+	{method: http.MethodGet, path: "/api/v1/products/:id/media", tag: "media", summary: "List the images of a product",
+		status: http.StatusOK, data: []domain.Media{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodPatch, path: "/api/v1/products/:id/media/:mediaId", tag: "media", summary: "Reorder an image or make it the primary one",
+		role: productsWrite, body: handler.MediaRequest{},
+		status: http.StatusOK, data: domain.Media{}, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity}},
+	{method: http.MethodDelete, path: "/api/v1/products/:id/media/:mediaId", tag: "media", summary: "Delete an image",
+		role: productsWrite, status: http.StatusNoContent, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+
+	// Inventory
+	{method: http.MethodPost, path: "/api/v1/products/:id/stock/adjust", tag: "inventory", summary: "Adjust the stock of a product",
+		role: inventoryWrite, idempotent: true, body: handler.StockAdjustRequest{},
+		status: http.StatusOK, data: domain.StockMovement{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity}},
+	{method: http.MethodGet, path: "/api/v1/products/:id/stock/ledger", tag: "inventory", summary: "List the stock movements of a product",
+		status: http.StatusOK, data: []domain.StockMovement{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodPost, path: "/api/v1/products/:id/reservations", tag: "inventory", summary: "Reserve stock of a product",
+		role: inventoryWrite, idempotent: true, body: handler.ReservationRequest{},
+		status: http.StatusCreated, data: domain.Reservation{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity}},
+	{method: http.MethodGet, path: "/api/v1/reservations/:id", tag: "inventory", summary: "Get a reservation",
+		status: http.StatusOK, data: domain.Reservation{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodPost, path: "/api/v1/reservations/:id/commit", tag: "inventory", summary: "Commit a reservation",
+		role: inventoryWrite, idempotent: true, status: http.StatusOK, data: domain.Reservation{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{method: http.MethodDelete, path: "/api/v1/reservations/:id", tag: "inventory", summary: "Release a reservation",
+		role: inventoryWrite, status: http.StatusOK, data: domain.Reservation{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+
+	// Warehouses
+	{method: http.MethodPost, path: "/api/v1/warehouses", tag: "warehouses", summary: "Create a warehouse",
+		role: inventoryWrite, idempotent: true, body: domain.Warehouse{},
+		status: http.StatusCreated, data: domain.Warehouse{}, errors: []int{http.StatusConflict, http.StatusUnprocessableEntity}},
+	{method: http.MethodGet, path: "/api/v1/warehouses", tag: "warehouses", summary: "List warehouses",
+		status: http.StatusOK, data: []domain.Warehouse{}},
+	{method: http.MethodGet, path: "/api/v1/warehouses/:id", tag: "warehouses", summary: "Get a warehouse",
+		status: http.StatusOK, data: domain.Warehouse{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodPatch, path: "/api/v1/warehouses/:id", tag: "warehouses", summary: "Update a warehouse",
+		role: inventoryWrite, body: domain.Warehouse{},
+		status: http.StatusOK, data: domain.Warehouse{}, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity}},
+	{method: http.MethodDelete, path: "/api/v1/warehouses/:id", tag: "warehouses", summary: "Delete a warehouse",
+		role: inventoryWrite, status: http.StatusNoContent, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{method: http.MethodPut, path: "/api/v1/warehouses/:id/stock/:productId", tag: "warehouses", summary: "Set the stock of a product in a warehouse",
+		role: inventoryWrite, body: handler.QuantityRequest{},
+		status: http.StatusOK, data: domain.ProductInventory{}, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity}},
+	{method: http.MethodPost, path: "/api/v1/warehouse-transfers", tag: "warehouses", summary: "Move stock between warehouses",
+		role: inventoryWrite, idempotent: true, body: domain.Transfer{},
+		status: http.StatusCreated, data: domain.Transfer{}, errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity}},
+	{method: http.MethodGet, path: "/api/v1/products/:id/inventory", tag: "warehouses", summary: "Get the stock of a product per warehouse",
+		status: http.StatusOK, data: domain.ProductInventory{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+
+	// Alerts
+	{method: http.MethodGet, path: "/api/v1/products/:id/reorder", tag: "alerts", summary: "Get the reorder setting of a product",
+		role: inventoryRead, status: http.StatusOK, data: domain.ReorderSetting{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodPut, path: "/api/v1/products/:id/reorder", tag: "alerts", summary: "Save the reorder setting of a product",
+		role: inventoryWrite, body: handler.ReorderRequest{},
+		status: http.StatusOK, data: domain.ReorderSetting{}, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity}},
+	{method: http.MethodGet, path: "/api/v1/alerts", tag: "alerts", summary: "List low-stock alerts",
+		role: inventoryRead, params: []openapi.Parameter{query("status", "Only alerts with this status", &openapi.Schema{Type: "string"})},
+		status: http.StatusOK, data: []domain.StockAlert{}, errors: []int{http.StatusUnprocessableEntity}},
+
+	// Orders
+	{method: http.MethodPost, path: "/api/v1/orders", tag: "orders", summary: "Place an order",
+		role: ordersWrite, idempotent: true, body: handler.OrderRequest{},
+		status: http.StatusCreated, data: domain.Order{}, errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity}},
+	{method: http.MethodGet, path: "/api/v1/orders", tag: "orders", summary: "List orders",
+		role: ordersRead, status: http.StatusOK, data: []domain.Order{}},
+	{method: http.MethodGet, path: "/api/v1/orders/:id", tag: "orders", summary: "Get an order",
+		role: ordersRead, status: http.StatusOK, data: domain.Order{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodPatch, path: "/api/v1/orders/:id/status", tag: "orders", summary: "Move an order to another status",
+		role: ordersWrite, body: handler.OrderStatusRequest{},
+		status: http.StatusOK, data: domain.Order{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity}},
+
+	// Carts
+	{method: http.MethodPost, path: "/api/v1/carts", tag: "carts", summary: "Create a cart",
+		idempotent: true, status: http.StatusCreated, data: domain.Cart{}},
+	{method: http.MethodGet, path: "/api/v1/carts/:id", tag: "carts", summary: "Get a cart",
+		stringParams: []string{"id"}, status: http.StatusOK, data: domain.Cart{}, errors: []int{http.StatusNotFound}},
+	{method: http.MethodPut, path: "/api/v1/carts/:id/items/:productId", tag: "carts", summary: "Set the quantity of a product in a cart",
+		stringParams: []string{"id"}, body: handler.QuantityRequest{},
+		status: http.StatusOK, data: domain.Cart{}, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity}},
+	{method: http.MethodDelete, path: "/api/v1/carts/:id/items/:productId", tag: "carts", summary: "Remove a product from a cart",
+		stringParams: []string{"id"}, status: http.StatusOK, data: domain.Cart{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodPost, path: "/api/v1/carts/:id/merge", tag: "carts", summary: "Merge an anonymous cart into the cart of the caller",
+		auth: true, idempotent: true, stringParams: []string{"id"}, body: handler.CartMergeRequest{},
+		status: http.StatusOK, data: domain.Cart{}, errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity}},
+	{method: http.MethodPost, path: "/api/v1/carts/:id/checkout", tag: "carts", summary: "Turn a cart into an order",
+		role: ordersWrite, stringParams: []string{"id"}, idempotent: true,
+		status: http.StatusCreated, data: domain.Order{}, errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity}},
+
+	// Jobs
+	{method: http.MethodGet, path: "/api/v1/jobs/:id", tag: "jobs", summary: "Get a background job",
+		stringParams: []string{"id"}, status: http.StatusOK, data: domain.Job{}, errors: []int{http.StatusNotFound}},
+	{method: http.MethodPost, path: "/api/v1/jobs/:id/cancel", tag: "jobs", summary: "Cancel a background job",
+		role: jobsWrite, idempotent: true, stringParams: []string{"id"},
+		status: http.StatusOK, data: domain.Job{}, errors: []int{http.StatusNotFound, http.StatusConflict}},
+
+	// Webhooks
+	{method: http.MethodPost, path: "/api/v1/webhooks", tag: "webhooks", summary: "Subscribe a webhook",
+		role: webhooksAdmin, idempotent: true, body: handler.WebhookRequest{},
+		status: http.StatusCreated, data: domain.Webhook{}, errors: []int{http.StatusUnprocessableEntity}},
+	{method: http.MethodGet, path: "/api/v1/webhooks", tag: "webhooks", summary: "List webhooks",
+		role: webhooksAdmin, status: http.StatusOK, data: []domain.Webhook{}},
+	{method: http.MethodGet, path: "/api/v1/webhooks/:id", tag: "webhooks", summary: "Get a webhook",
+		role: webhooksAdmin, status: http.StatusOK, data: domain.Webhook{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodDelete, path: "/api/v1/webhooks/:id", tag: "webhooks", summary: "Delete a webhook",
+		role: webhooksAdmin, status: http.StatusNoContent, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodGet, path: "/api/v1/webhooks/:id/deliveries", tag: "webhooks", summary: "List the deliveries of a webhook",
+		role: webhooksAdmin, status: http.StatusOK, data: []domain.WebhookDelivery{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodPost, path: "/api/v1/webhooks/:id/deliveries/:deliveryId/redeliver", tag: "webhooks", summary: "Send a delivery again",
+		role: webhooksAdmin, idempotent: true, status: http.StatusAccepted, data: domain.Job{},
+		errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity}},
+
+	// API keys
+	{method: http.MethodPost, path: "/api/v1/api-keys", tag: "api-keys", summary: "Create an API key, the key is only returned here",
+		role: apiKeysAdmin, idempotent: true, body: handler.APIKeyRequest{},
+		status: http.StatusCreated, data: domain.APIKey{}, errors: []int{http.StatusUnprocessableEntity}},
+	{method: http.MethodGet, path: "/api/v1/api-keys", tag: "api-keys", summary: "List API keys",
+		role: apiKeysAdmin, status: http.StatusOK, data: []domain.APIKey{}},
+	{method: http.MethodGet, path: "/api/v1/api-keys/:id", tag: "api-keys", summary: "Get an API key",
+		role: apiKeysAdmin, status: http.StatusOK, data: domain.APIKey{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodDelete, path: "/api/v1/api-keys/:id", tag: "api-keys", summary: "Revoke an API key",
+		role: apiKeysAdmin, status: http.StatusNoContent, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+
+	// Auth
+	{method: http.MethodPost, path: "/api/v1/auth/register", tag: "auth", summary: "Register a user",
+		idempotent: true, body: handler.RegisterRequest{}, status: http.StatusCreated, data: domain.User{}, errors: []int{http.StatusConflict, http.StatusUnprocessableEntity}},
+	{method: http.MethodPost, path: "/api/v1/auth/login", tag: "auth", summary: "Log in with email and password",
+		body: handler.LoginRequest{}, status: http.StatusOK, data: user.Tokens{},
+		errors: []int{http.StatusUnauthorized, http.StatusLocked, http.StatusUnprocessableEntity}},
+	{method: http.MethodPost, path: "/api/v1/auth/refresh", tag: "auth", summary: "Trade a refresh token for new tokens",
+		body: handler.RefreshRequest{}, status: http.StatusOK, data: user.Tokens{}, errors: []int{http.StatusUnauthorized, http.StatusUnprocessableEntity}},
+	{method: http.MethodPost, path: "/api/v1/auth/logout", tag: "auth", summary: "End the session of a refresh token",
+		body: handler.RefreshRequest{}, status: http.StatusNoContent, errors: []int{http.StatusUnprocessableEntity}},
+	{method: http.MethodPost, path: "/api/v1/auth/password-reset", tag: "auth", summary: "Mail a password reset token",
+		body: handler.PasswordResetRequest{}, status: http.StatusAccepted, data: "", errors: []int{http.StatusUnprocessableEntity}},
+	{method: http.MethodPost, path: "/api/v1/auth/password-reset/confirm", tag: "auth", summary: "Set a new password with a reset token",
+		body: handler.PasswordResetConfirmRequest{}, status: http.StatusNoContent, errors: []int{http.StatusUnprocessableEntity}},
+
+	// Users
+	{method: http.MethodGet, path: "/api/v1/users/me", tag: "users", summary: "Get the calling user",
+		auth: true, status: http.StatusOK, data: domain.User{}},
+	{method: http.MethodGet, path: "/api/v1/users/:id", tag: "users", summary: "Get a user",
+		role: usersAdmin, status: http.StatusOK, data: domain.User{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{method: http.MethodPut, path: "/api/v1/users/:id/roles", tag: "users", summary: "Replace the roles of a user",
+		role: usersAdmin, body: handler.RolesRequest{},
+		status: http.StatusOK, data: domain.User{}, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity}},
+
+	// Live updates
+	{method: http.MethodGet, path: "/api/v1/products/stream", tag: "live", summary: "Stream product and stock events",
+		params: []openapi.Parameter{
+			query("product_ids", "Comma separated IDs of the products to follow", &openapi.Schema{Type: "string"}),
+			query("last_event_id", "Resume after this event, for clients that can't send Last-Event-ID", &openapi.Schema{Type: "integer"}),
+			{Name: "Last-Event-ID", In: "header", Description: "Resume after this event", Schema: &openapi.Schema{Type: "integer"}},
+		},
+		responses: map[int]*openapi.Response{http.StatusOK: {
+			Description: "Server-Sent Events, one per product or stock change",
+			Content:     map[string]openapi.MediaType{"text/event-stream": {Schema: &openapi.Schema{Type: "string"}}},
+		}},
+		errors: []int{http.StatusBadRequest}},
+	{method: http.MethodGet, path: "/api/v1/inventory/socket", tag: "live", summary: "Open a WebSocket of stock events",
+		raw: true,
+		params: []openapi.Parameter{
+			query("access_token", "Token of clients that can't send the Authorization header", &openapi.Schema{Type: "string"}),
+		},
+		responses: map[int]*openapi.Response{
+			http.StatusSwitchingProtocols: {Description: "WebSocket upgraded"},
+			http.StatusUnauthorized:       errorResponse(http.StatusUnauthorized),
+		}},
+
+	// Operations
+	{method: http.MethodGet, path: "/api/v1/log-level", tag: "operations", summary: "Get the log level",
+		role: logsAdmin, status: http.StatusOK, data: handler.LogLevelResponse{}},
+	{method: http.MethodPut, path: "/api/v1/log-level", tag: "operations", summary: "Change the log level until the process restarts",
+		role: logsAdmin, body: handler.LogLevelRequest{}, status: http.StatusOK, data: handler.LogLevelResponse{}, errors: []int{http.StatusUnprocessableEntity}},
+	{method: http.MethodGet, path: "/metrics", tag: "operations", summary: "Prometheus metrics",
+		raw: true, responses: map[int]*openapi.Response{http.StatusOK: {
+			Description: "Metrics in the Prometheus text format",
+			Content:     map[string]openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: "string"}}},
+		}}},
+	{method: http.MethodGet, path: specPath, tag: "operations", summary: "This OpenAPI document",
+		raw: true, responses: map[int]*openapi.Response{http.StatusOK: {
+			Description: "OpenAPI document",
+			Content:     map[string]openapi.MediaType{"application/json": {}},
+		}}},
+	{method: http.MethodGet, path: docsPath + "*any", tag: "operations", summary: "Swagger UI of this document",
+		raw: true, stringParams: []string{"any"}, responses: map[int]*openapi.Response{http.StatusOK: {
+			Description: "Swagger UI page or asset",
+			Content:     map[string]openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}},
+		}}},
+}
+
+// spec builds the OpenAPI document of operations
+func spec() *openapi.Document {
+	doc := openapi.New("api-gin", "1.0.0", "Product catalog, inventory and orders API. "+
+		"Requests are bound to the tenant of their credentials, anonymous ones to the "+tenant.Header+" header.")
+	doc.Components.SecuritySchemes["bearer"] = &openapi.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+	doc.Components.SecuritySchemes["apiKey"] = &openapi.SecurityScheme{Type: "apiKey", In: "header", Name: "X-API-Key"}
+	// Envelopes every response refers to
+	doc.Schema(web.Response{})
+	doc.Schema(web.ErrorResponse{})
+
+	for _, op := range operations {
+		doc.Add(op.method, specPathOf(op.path), op.build(doc))
+	}
+	return doc
+}
+
+func (op operation) build(doc *openapi.Document) *openapi.Operation {
+	o := &openapi.Operation{
+		Tags:        []string{op.tag},
+		Summary:     op.summary,
+		OperationID: operationID(op.method, op.path),
+		Parameters:  append(op.pathParams(), op.params...),
+		Responses:   map[string]*openapi.Response{},
+	}
+	if op.role != "" || op.auth {
+		o.Security = []map[string][]string{{"bearer": {}}, {"apiKey": {}}}
+	}
+	if op.role != "" {
+		o.Description = "Requires the " + op.role + " role."
+	}
+	if op.idempotent {
+		o.Parameters = append(o.Parameters, openapi.Parameter{
+			Name: idempotency.Header, In: "header", Schema: &openapi.Schema{Type: "string"},
+			Description: "Retries with the same key replay the first response",
+		})
+	}
+
+	if op.body != nil || op.request != nil {
+		o.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{}}
+		if op.request != nil {
+			o.RequestBody = op.request
+		}
+		if op.body != nil {
+			o.RequestBody.Content["application/json"] = openapi.MediaType{Schema: doc.Schema(op.body)}
+		}
+	}
+
+	if op.status != 0 {
+		o.Responses[strconv.Itoa(op.status)] = envelope(doc, op.status, op.data)
+		for _, status := range op.also {
+			o.Responses[strconv.Itoa(status)] = envelope(doc, status, op.data)
+		}
+	}
+	if op.accepted != nil {
+		o.Responses[strconv.Itoa(http.StatusAccepted)] = envelope(doc, http.StatusAccepted, op.accepted)
+	}
+	for status, res := range op.responses {
+		o.Responses[strconv.Itoa(status)] = res
+	}
+
+	errors := append([]int{}, op.errors...)
+	if !op.raw {
+		errors = append(errors, http.StatusBadRequest, http.StatusTooManyRequests, http.StatusInternalServerError)
+		if op.role != "" || op.auth {
+			errors = append(errors, http.StatusUnauthorized, http.StatusForbidden)
+		}
+		if op.idempotent {
+			errors = append(errors, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity)
+		}
+	}
+	merged := map[string]bool{}
+	for _, status := range errors {
+		key := strconv.Itoa(status)
+		res, ok := o.Responses[key]
+		switch {
+		case !ok:
+			o.Responses[key] = errorResponse(status)
+		case res.Content != nil && !merged[key]:
+			// Statuses returning data on some failures and errors on others
+			data := res.Content["application/json"].Schema
+			res.Content["application/json"] = openapi.MediaType{Schema: &openapi.Schema{OneOf: []*openapi.Schema{data, errorSchema()}}}
+			res.Description += " or an error"
+			merged[key] = true
+		}
+	}
+	return o
+}
+
+// pathParams documents the params of a gin path, integers unless listed
+// in stringParams
+func (op operation) pathParams() []openapi.Parameter {
+	var params []openapi.Parameter
+	for _, m := range ginParam.FindAllStringSubmatch(op.path, -1) {
+		schema := &openapi.Schema{Type: "integer"}
+		for _, name := range op.stringParams {
+			if name == m[1] {
+				schema = &openapi.Schema{Type: "string"}
+			}
+		}
+		// Custom methods read the suffix after the colon
+		if m[0] == ":method" {
+			schema = &openapi.Schema{Type: "string", Enum: []string{"batch", "import"}}
+		}
+		params = append(params, openapi.Parameter{Name: m[1], In: "path", Required: true, Schema: schema})
+	}
+	return params
+}
+
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z]+)`)
+
+// specPathOf turns a gin path into an OpenAPI one: /products/:id becomes
+// /products/{id}. The colon of custom methods stays, /products:method
+// becomes /products:{method}.
+func specPathOf(path string) string {
+	return ginParam.ReplaceAllStringFunc(path, func(p string) string {
+		if p == ":method" {
+			return ":{method}"
+		}
+		return "{" + p[1:] + "}"
+	})
+}
+
+// operationID names an operation after its method and path, like
+// get-api-v1-products-id
+func operationID(method, path string) string {
+	id := strings.ToLower(method) + strings.NewReplacer("/", "-", ":", "-", "*", "").Replace(path)
+	return strings.Trim(strings.ReplaceAll(id, "--", "-"), "-")
+}
+
+// envelope documents a web.Response carrying data, or no body for 204
+func envelope(doc *openapi.Document, status int, data interface{}) *openapi.Response {
+	res := &openapi.Response{Description: http.StatusText(status)}
+	if status == http.StatusNoContent {
+		return res
+	}
+
+	schema := &openapi.Schema{Ref: "#/components/schemas/Response"}
+	if data != nil {
+		var dataSchema *openapi.Schema
+		if alternatives, ok := data.(oneOf); ok {
+			dataSchema = &openapi.Schema{}
+			for _, alt := range alternatives {
+				dataSchema.OneOf = append(dataSchema.OneOf, doc.Schema(alt))
+			}
+		} else {
+			dataSchema = doc.Schema(data)
+		}
+		schema = &openapi.Schema{AllOf: []*openapi.Schema{schema, {
+			Type:       "object",
+			Properties: map[string]*openapi.Schema{"data": dataSchema},
+		}}}
+	}
+	res.Content = map[string]openapi.MediaType{"application/json": {Schema: schema}}
+	return res
+}
+
+func errorSchema() *openapi.Schema {
+	return &openapi.Schema{Ref: "#/components/schemas/ErrorResponse"}
+}
+
+func errorResponse(status int) *openapi.Response {
+	return &openapi.Response{
+		Description: http.StatusText(status),
+		Content:     map[string]openapi.MediaType{"application/json": {Schema: errorSchema()}},
+	}
+}
+
+func query(name, description string, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func formatParam() openapi.Parameter {
+	formats := make([]string, 0, len(exporter.Formats))
+	for name := range exporter.Formats {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return query("format", "File format, csv by default", &openapi.Schema{Type: "string", Enum: formats})
+}
+
+// exportResponse documents the export file in each format
+func exportResponse() *openapi.Response {
+	res := &openapi.Response{
+		Description: "Catalog file, gzipped when accepted and the format compresses",
+		Content:     map[string]openapi.MediaType{},
+	}
+	for _, format := range exporter.Formats {
+		res.Content[strings.Split(format.ContentType, ";")[0]] = openapi.MediaType{Schema: &openapi.Schema{Type: "string", Format: "binary"}}
+	}
+	return res
+}
+
+// importParam documents the query params of products:import
+func importParam(name, description string) openapi.Parameter {
+	schema := &openapi.Schema{Type: "boolean"}
+	if name == "mode" {
+		schema = &openapi.Schema{Type: "string"}
+	}
+	return query(name, description+", import only", schema)
+}
+
+// importRequest is the multipart body of products:import, batch takes
+// JSON instead
+func importRequest() *openapi.RequestBody {
+	return &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+		"multipart/form-data": {Schema: &openapi.Schema{
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"file":    {Type: "string", Format: "binary", Description: "CSV, JSONL or XLSX file of products"},
+				"mapping": {Type: "string", Description: "JSON object of file header to product field"},
+			},
+			Required: []string{"file"},
+		}},
+	}}
+}
+
+func uploadRequest() *openapi.RequestBody {
+	return &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+		"multipart/form-data": {Schema: &openapi.Schema{
+			Type: "object",
+			Properties: map[string]*openapi.Schema{
+				"file": {Type: "array", Items: &openapi.Schema{Type: "string", Format: "binary"}},
+			},
+			Required: []string{"file"},
+		}},
+	}}
+}
@@ -0,0 +1,76 @@
+package router
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vincentconace/api-gin/internal/job"
+	"github.com/vincentconace/api-gin/internal/live"
+	"github.com/vincentconace/api-gin/pkg/logging"
+)
+
+func newTestEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	js := job.NewService(job.NewMemoryRepository(), logging.Discard())
+	NewRouter(r, nil, nil, nil, js, live.NewHub(logging.Discard()), nil, logging.Discard(), new(slog.LevelVar)).MapaRuter()
+	return r
+}
+
+func TestSpecCoversRoutesOk(t *testing.T) {
+	r := newTestEngine()
+	doc := spec()
+
+	registered := map[string]bool{}
+	for _, ri := range r.Routes() {
+		registered[ri.Method+" "+ri.Path] = true
+		assert.True(t, doc.Has(ri.Method, specPathOf(ri.Path)), "route %s %s is missing from the OpenAPI document", ri.Method, ri.Path)
+	}
+	// Documented routes must still exist
+	for _, op := range operations {
+		assert.True(t, registered[op.method+" "+op.path], "documented route %s %s isn't registered", op.method, op.path)
+	}
+}
+
+func TestSpecOk(t *testing.T) {
+	doc := spec()
+
+	op := doc.Paths["/api/v1/products/{id}"]["patch"]
+	require.NotNil(t, op)
+	assert.Equal(t, "#/components/schemas/Product", op.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, "integer", op.Parameters[0].Schema.Type)
+	assert.Contains(t, op.Responses, "200")
+	assert.Contains(t, op.Responses, "401")
+	assert.Contains(t, op.Responses, "403")
+	assert.Equal(t, "#/components/schemas/ErrorResponse", op.Responses["404"].Content["application/json"].Schema.Ref)
+	assert.Contains(t, doc.Components.Schemas, "Response")
+	assert.Contains(t, doc.Components.Schemas["ErrorResponse"].Properties, "error")
+	assert.NotContains(t, doc.Components.Schemas["ErrorResponse"].Properties, "Status")
+
+	// Custom methods keep their colon
+	assert.True(t, doc.Has(http.MethodPost, "/api/v1/products:{method}"))
+	assert.Equal(t, "string", doc.Paths["/api/v1/carts/{id}"]["get"].Parameters[0].Schema.Type)
+	assert.Empty(t, doc.Paths["/api/v1/products"]["get"].Security)
+}
+
+func TestDocsRoutesOk(t *testing.T) {
+	r := newTestEngine()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, specPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.1.0", doc["openapi"])
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, docsPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), specPath)
+}
@@ -1,16 +1,67 @@
 package router
 
 import (
+	"context"
 	"database/sql"
+	"log/slog"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/vincentconace/api-gin/cmd/server/handler"
+	"github.com/vincentconace/api-gin/internal/alert"
+	"github.com/vincentconace/api-gin/internal/apikey"
+	"github.com/vincentconace/api-gin/internal/cart"
+	"github.com/vincentconace/api-gin/internal/exporter"
+	"github.com/vincentconace/api-gin/internal/importer"
+	"github.com/vincentconace/api-gin/internal/inventory"
+	"github.com/vincentconace/api-gin/internal/job"
+	"github.com/vincentconace/api-gin/internal/live"
+	"github.com/vincentconace/api-gin/internal/media"
+	"github.com/vincentconace/api-gin/internal/order"
+	"github.com/vincentconace/api-gin/internal/outbox"
 	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/internal/user"
+	"github.com/vincentconace/api-gin/internal/warehouse"
+	"github.com/vincentconace/api-gin/internal/webhook"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/blob"
+	"github.com/vincentconace/api-gin/pkg/idempotency"
+	"github.com/vincentconace/api-gin/pkg/metrics"
+	"github.com/vincentconace/api-gin/pkg/notify"
+	"github.com/vincentconace/api-gin/pkg/openapi"
+	"github.com/vincentconace/api-gin/pkg/ratelimit"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+// Route policies, the role a token needs to call a route. Routes without
+// one are public.
+const (
+	productsWrite  = "products:write"
+	inventoryRead  = "inventory:read"
+	inventoryWrite = "inventory:write"
+	ordersRead     = "orders:read"
+	ordersWrite    = "orders:write"
+	jobsWrite      = "jobs:write"
+	webhooksAdmin  = "webhooks:admin"
+	apiKeysAdmin   = "apikeys:admin"
+	usersAdmin     = "users:admin"
+	logsAdmin      = "logs:admin"
+)
+
+// Default rate limits of route groups, RATE_LIMIT_<GROUP> overrides them
+var (
+	defaultLimit  = ratelimit.Limit{Requests: 300, Window: time.Minute}
+	productsLimit = ratelimit.Limit{Requests: 120, Window: time.Minute}
+	exportLimit   = ratelimit.Limit{Requests: 10, Window: time.Minute}
+	authLimit     = ratelimit.Limit{Requests: 10, Window: time.Minute}
+	ipLimit       = ratelimit.Limit{Requests: 600, Window: time.Minute}
 )
 
 type Router interface {
 	MapaRuter()
+	// Run does the background work of the routes until ctx is done
+	Run(ctx context.Context)
 }
 
 type router struct {
@@ -18,33 +69,304 @@ type router struct {
 	rg *gin.RouterGroup
 	db *sql.DB
 	rd *redis.Client
+	bs blob.Store
+	js job.Service
+	hb *live.Hub
+	av auth.Verifier
+	lg *slog.Logger
+	lv *slog.LevelVar
+	ks apikey.Service
+	rl ratelimit.Limiter
+	as alert.Service
+	ev *alert.Evaluator
+	is inventory.Service
+	ps product.Service
+	os order.Service
+
+	// idempotent lets clients retry the POST routes it guards safely, it
+	// guards every POST route that writes but the sessions of /auth
+	idempotent gin.HandlerFunc
 }
 
-func NewRouter(r *gin.Engine, db *sql.DB, rd *redis.Client) Router {
-	return &router{r: r, db: db, rd: rd}
+func NewRouter(r *gin.Engine, db *sql.DB, rd *redis.Client, bs blob.Store, js job.Service, hb *live.Hub, av auth.Verifier, lg *slog.Logger, lv *slog.LevelVar) Router {
+	return &router{r: r, db: db, rd: rd, bs: bs, js: js, hb: hb, av: av, lg: lg, lv: lv}
 }
 
 func (r *router) MapaRuter() {
 	r.setGroup()
+	r.setAlerts()
 
 	r.buildProductRoutes()
+	r.buildInventoryRoutes()
+	r.buildWarehouseRoutes()
+	r.buildAlertRoutes()
+	r.buildOrderRoutes()
+	r.buildCartRoutes()
+	r.buildJobRoutes()
+	r.buildWebhookRoutes()
+	r.buildAPIKeyRoutes()
+	r.buildUserRoutes()
+	r.buildLiveRoutes()
+	r.buildLoggingRoutes()
+	r.buildMetricsRoutes()
+	r.buildDocsRoutes()
+}
+
+func (r *router) Run(ctx context.Context) {
+	// Release expired reservations and evaluate low stock
+	go inventory.RunExpirer(ctx, r.is, time.Minute, r.lg)
+	go r.ev.Run(ctx)
 }
 
 func (r *router) setGroup() {
-	// General routes
+	// General routes, client IPs are limited before any credential is
+	// checked, callers sending a token or API key are identified for the
+	// policies below and every request is bound to a tenant
+	r.ks = apikey.NewService(apikey.NewRepository(r.db), apikey.NewRedisCache(r.rd), r.lg)
+	r.rl = ratelimit.NewFallbackLimiter(ratelimit.NewRedisLimiter(r.rd), ratelimit.NewMemoryLimiter(), r.lg)
+	r.idempotent = idempotency.Middleware(idempotency.NewRedisStore(r.rd), r.lg)
 	r.rg = r.r.Group("/api/v1")
+	r.rg.Use(
+		ratelimit.IPMiddleware(r.rl, "ip", ratelimit.FromEnv("ip", ipLimit, r.lg)),
+		auth.Authenticate(r.av, r.ks),
+		tenant.Init(),
+		r.limit("default", defaultLimit),
+	)
+}
+
+// limit applies the rate limit of a route group on top of the default one
+func (r *router) limit(group string, def ratelimit.Limit) gin.HandlerFunc {
+	return ratelimit.Middleware(r.rl, group, ratelimit.FromEnv(group, def, r.lg))
+}
+
+func (r *router) setAlerts() {
+	// Low-stock evaluation runs in the background for the whole app
+	r.as = alert.NewService(alert.NewRepository(r.db), notify.Init(r.lg))
+	r.ev = alert.NewEvaluator(r.as, 5*time.Minute, r.lg)
 }
 
 func (r *router) buildProductRoutes() {
 	// Repository, service and handler
 	repository := product.NewRepository(r.db)
-	service := product.NewService(repository)
-	handler := handler.NewProductHandler(service, r.rd)
+	service := alert.ObserveProducts(product.Traced(product.NewService(repository)), r.ev)
+	mediaService := media.NewService(media.NewRepository(r.db), repository, r.bs)
+	mediaHandler := handler.NewMediaHandler(mediaService, r.rd)
+	importService := importer.NewService(service, repository, r.bs, r.js)
+	importHandler := handler.NewImportHandler(importService, r.rd)
+	productHandler := handler.NewProductHandler(service, mediaService, r.js, r.rd, r.lg)
+	r.ps = service
+
+	// Catalog gauges, counted when metrics are scraped
+	if err := metrics.Register(product.NewCollector(repository)); err != nil {
+		r.lg.Warn("register product metrics", "error", err)
+	}
+
+	// Background jobs
+	r.js.Register(importer.JobType, importer.JobHandler(importService, r.bs))
+	r.js.Register(exporter.JobType, exporter.JobHandler(service, r.bs))
 
 	// Product routes
-	r.rg.POST("/products", handler.Create())
-	r.rg.GET("/products", handler.Get())
-	r.rg.GET("/products/:id", handler.GetById())
-	r.rg.PATCH("/products/:id", handler.Update())
-	r.rg.DELETE("/products/:id", handler.Delete())
+	r.rg.POST("/products", auth.Require(productsWrite), r.idempotent, productHandler.Create())
+	r.rg.GET("/products", r.limit("products", productsLimit), productHandler.Get())
+	r.rg.GET("/products/export", r.limit("export", exportLimit), productHandler.Export())
+	r.rg.POST("/products/export", auth.Require(productsWrite), r.limit("export", exportLimit), r.idempotent, productHandler.ExportAsync())
+	r.rg.GET("/products/:id", productHandler.GetById())
+	r.rg.PATCH("/products/:id", auth.Require(productsWrite), productHandler.Update())
+	r.rg.DELETE("/products/:id", auth.Require(productsWrite), productHandler.Delete())
+	r.rg.POST("/products:method", auth.Require(productsWrite), r.idempotent, handler.CustomMethods(map[string]gin.HandlerFunc{
+		"batch":  productHandler.Batch(),
+		"import": importHandler.Import(),
+	}))
+
+	// Product media routes
+	r.rg.POST("/products/:id/media", auth.Require(productsWrite), r.idempotent, mediaHandler.Upload())
+	r.rg.GET("/products/:id/media", mediaHandler.List())
+	r.rg.PATCH("/products/:id/media/:mediaId", auth.Require(productsWrite), mediaHandler.Update())
+	r.rg.DELETE("/products/:id/media/:mediaId", auth.Require(productsWrite), mediaHandler.Delete())
+}
+
+func (r *router) buildInventoryRoutes() {
+	// Repository, service and handler
+	repository := inventory.NewRepository(r.db)
+	service := inventory.NewService(repository)
+	handler := handler.NewInventoryHandler(service, r.rd)
+	r.is = service
+
+	// Inventory routes
+	r.rg.POST("/products/:id/stock/adjust", auth.Require(inventoryWrite), r.idempotent, handler.Adjust())
+	r.rg.GET("/products/:id/stock/ledger", handler.Ledger())
+	r.rg.POST("/products/:id/reservations", auth.Require(inventoryWrite), r.idempotent, handler.Reserve())
+	r.rg.GET("/reservations/:id", handler.GetReservation())
+	r.rg.POST("/reservations/:id/commit", auth.Require(inventoryWrite), r.idempotent, handler.Commit())
+	r.rg.DELETE("/reservations/:id", auth.Require(inventoryWrite), handler.Release())
+}
+
+func (r *router) buildWarehouseRoutes() {
+	// Repository, service and handler
+	repository := warehouse.NewRepository(r.db)
+	service := warehouse.NewService(repository)
+	productService := product.Traced(product.NewService(product.NewRepository(r.db)))
+	handler := handler.NewWarehouseHandler(service, productService, r.rd)
+
+	// Warehouse routes
+	r.rg.POST("/warehouses", auth.Require(inventoryWrite), r.idempotent, handler.Create())
+	r.rg.GET("/warehouses", handler.Get())
+	r.rg.GET("/warehouses/:id", handler.GetById())
+	r.rg.PATCH("/warehouses/:id", auth.Require(inventoryWrite), handler.Update())
+	r.rg.DELETE("/warehouses/:id", auth.Require(inventoryWrite), handler.Delete())
+	r.rg.PUT("/warehouses/:id/stock/:productId", auth.Require(inventoryWrite), handler.SetStock())
+	r.rg.POST("/warehouse-transfers", auth.Require(inventoryWrite), r.idempotent, handler.Transfer())
+	r.rg.GET("/products/:id/inventory", handler.ProductInventory())
+}
+
+func (r *router) buildAlertRoutes() {
+	// Service and handler
+	productService := product.Traced(product.NewService(product.NewRepository(r.db)))
+	handler := handler.NewAlertHandler(r.as, productService)
+
+	// Alert routes
+	r.rg.GET("/products/:id/reorder", auth.Require(inventoryRead), handler.GetSetting())
+	r.rg.PUT("/products/:id/reorder", auth.Require(inventoryWrite), handler.SaveSetting())
+	r.rg.GET("/alerts", auth.Require(inventoryRead), handler.List())
+}
+
+func (r *router) buildOrderRoutes() {
+	// Repository, service and handler
+	repository := order.NewRepository(r.db)
+	service := alert.ObserveOrders(order.NewService(repository), r.ev)
+	handler := handler.NewOrderHandler(service, r.rd)
+	r.os = service
+
+	// Order routes
+	r.rg.POST("/orders", auth.Require(ordersWrite), r.idempotent, handler.Create())
+	r.rg.GET("/orders", auth.Require(ordersRead), handler.Get())
+	r.rg.GET("/orders/:id", auth.Require(ordersRead), handler.GetById())
+	r.rg.PATCH("/orders/:id/status", auth.Require(ordersWrite), handler.UpdateStatus())
+}
+
+func (r *router) buildCartRoutes() {
+	// Repository, service and handler, checkout goes through the observed
+	// product and order services of their own routes
+	repository := cart.NewRepository(r.rd)
+	service := cart.NewService(repository, r.ps, r.os)
+	handler := handler.NewCartHandler(service, r.rd)
+
+	// Cart routes
+	r.rg.POST("/carts", r.idempotent, handler.Create())
+	r.rg.GET("/carts/:id", handler.Get())
+	r.rg.PUT("/carts/:id/items/:productId", handler.SetItem())
+	r.rg.DELETE("/carts/:id/items/:productId", handler.RemoveItem())
+	r.rg.POST("/carts/:id/merge", auth.Authenticated(), r.idempotent, handler.Merge())
+	r.rg.POST("/carts/:id/checkout", auth.Require(ordersWrite), r.idempotent, handler.Checkout())
+}
+
+func (r *router) buildJobRoutes() {
+	// Handler, job types are registered with the routes that enqueue them
+	handler := handler.NewJobHandler(r.js)
+
+	// Job routes
+	r.rg.GET("/jobs/:id", handler.GetById())
+	r.rg.POST("/jobs/:id/cancel", auth.Require(jobsWrite), r.idempotent, handler.Cancel())
+}
+
+func (r *router) buildWebhookRoutes() {
+	// Repository, service and handler
+	repository := webhook.NewRepository(r.db)
+	service := webhook.NewService(repository, r.js, r.lg)
+	handler := handler.NewWebhookHandler(service)
+
+	// Deliveries run as background jobs
+	r.js.Register(webhook.JobType, webhook.JobHandler(service))
+
+	// Webhook routes
+	r.rg.POST("/webhooks", auth.Require(webhooksAdmin), r.idempotent, handler.Create())
+	r.rg.GET("/webhooks", auth.Require(webhooksAdmin), handler.Get())
+	r.rg.GET("/webhooks/:id", auth.Require(webhooksAdmin), handler.GetById())
+	r.rg.DELETE("/webhooks/:id", auth.Require(webhooksAdmin), handler.Delete())
+	r.rg.GET("/webhooks/:id/deliveries", auth.Require(webhooksAdmin), handler.Deliveries())
+	r.rg.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", auth.Require(webhooksAdmin), r.idempotent, handler.Redeliver())
+}
+
+func (r *router) buildAPIKeyRoutes() {
+	// Handler, the service also backs authentication
+	handler := handler.NewAPIKeyHandler(r.ks)
+
+	// API key routes
+	r.rg.POST("/api-keys", auth.Require(apiKeysAdmin), r.idempotent, handler.Create())
+	r.rg.GET("/api-keys", auth.Require(apiKeysAdmin), handler.Get())
+	r.rg.GET("/api-keys/:id", auth.Require(apiKeysAdmin), handler.GetById())
+	r.rg.DELETE("/api-keys/:id", auth.Require(apiKeysAdmin), handler.Revoke())
+}
+
+func (r *router) buildUserRoutes() {
+	// Repository, service and handler, access tokens are signed with the
+	// JWT secret the verifier checks
+	repository := user.NewRepository(r.db)
+	service := user.NewService(repository, user.NewRedisSessions(r.rd), auth.InitIssuer(), notify.InitMail(r.lg))
+	handler := handler.NewUserHandler(service)
+
+	// Auth routes, limited harder against password guessing
+	authRoutes := r.rg.Group("/auth", r.limit("auth", authLimit))
+	authRoutes.POST("/register", r.idempotent, handler.Register())
+	// Session routes are left out, a replay would keep issued tokens and
+	// reset links in the idempotency store
+	authRoutes.POST("/login", handler.Login())
+	authRoutes.POST("/refresh", handler.Refresh())
+	authRoutes.POST("/logout", handler.Logout())
+	authRoutes.POST("/password-reset", handler.RequestPasswordReset())
+	authRoutes.POST("/password-reset/confirm", handler.ResetPassword())
+
+	// User routes
+	r.rg.GET("/users/me", auth.Authenticated(), handler.Me())
+	r.rg.GET("/users/:id", auth.Require(usersAdmin), handler.GetById())
+	r.rg.PUT("/users/:id/roles", auth.Require(usersAdmin), handler.SetRoles())
+}
+
+func (r *router) buildLiveRoutes() {
+	// Service and handler, events come from the outbox relay
+	service := live.NewService(r.hb, outbox.NewRepository(r.db), r.lg)
+	// Sockets accept device tokens, any valid JWT or any valid API key
+	socketAuth := live.AnyAuthenticator(live.NewTokenAuthenticator(), live.AuthenticatorFunc(func(token string) (string, bool) {
+		p, err := r.av.Verify(token)
+		return socketTenant(p), err == nil
+	}), live.AuthenticatorFunc(func(token string) (string, bool) {
+		p, err := r.ks.VerifyKey(context.Background(), token)
+		return socketTenant(p), err == nil
+	}))
+	handler := handler.NewLiveHandler(service, socketAuth)
+
+	// Live routes
+	r.rg.GET("/products/stream", handler.Stream())
+	// The socket checks its own tokens, which needn't be JWTs
+	r.r.GET("/api/v1/inventory/socket", handler.Socket())
+}
+
+// socketTenant is the tenant a socket client follows, tokens without one
+// act in the default tenant as they do on the other routes
+func socketTenant(p auth.Principal) string {
+	if p.Tenant == "" {
+		return tenant.Default
+	}
+	return p.Tenant
+}
+
+func (r *router) buildLoggingRoutes() {
+	handler := handler.NewLogLevelHandler(r.lv, r.lg)
+
+	// Log level routes, changes last until the process restarts
+	r.rg.GET("/log-level", auth.Require(logsAdmin), handler.Get())
+	r.rg.PUT("/log-level", auth.Require(logsAdmin), handler.Set())
+}
+
+func (r *router) buildMetricsRoutes() {
+	// Scraped by Prometheus outside the API, like the socket it skips the
+	// API middleware
+	r.r.GET("/metrics", metrics.Handler())
+}
+
+func (r *router) buildDocsRoutes() {
+	// OpenAPI document of the routes above and Swagger UI to browse it,
+	// public like the API it describes
+	r.r.GET(specPath, openapi.Handler(spec()))
+	r.r.GET(docsPath+"*any", openapi.UI("api-gin", specPath, docsPath))
 }
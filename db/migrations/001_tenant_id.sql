@@ -0,0 +1,11 @@
+-- Moves databases created before tenants to db/schema.sql. Products and
+-- warehouses that existed then belong to the default tenant, the tables
+-- added along with tenants are created by the schema.
+
+ALTER TABLE products
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD UNIQUE KEY uq_products_tenant_code (tenant_id, product_code);
+
+ALTER TABLE warehouses
+    ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default' AFTER id,
+    ADD UNIQUE KEY uq_warehouses_tenant_code (tenant_id, code);
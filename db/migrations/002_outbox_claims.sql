@@ -0,0 +1,3 @@
+-- Relays lease the events they publish instead of locking them
+ALTER TABLE outbox_events
+    ADD COLUMN claimed_until DATETIME(6) NULL AFTER published_at;
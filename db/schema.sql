@@ -0,0 +1,207 @@
+-- Schema of the API, for MySQL 8. Every table of tenant data carries the
+-- tenant_id the repositories filter on. Apply it with make build-database.
+
+CREATE TABLE IF NOT EXISTS products (
+    id           INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id    VARCHAR(64)   NOT NULL DEFAULT 'default',
+    product_code VARCHAR(64)   NULL,
+    name         VARCHAR(255)  NULL,
+    description  TEXT          NULL,
+    price        DECIMAL(12,2) NULL,
+    stock        INT           NOT NULL DEFAULT 0,
+    UNIQUE KEY uq_products_tenant_code (tenant_id, product_code)
+) ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS product_media (
+    id           INT AUTO_INCREMENT PRIMARY KEY,
+    product_id   INT          NOT NULL,
+    storage_key  VARCHAR(255) NOT NULL,
+    file_name    VARCHAR(255) NOT NULL,
+    content_type VARCHAR(128) NOT NULL,
+    size         BIGINT       NOT NULL,
+    position     INT          NOT NULL DEFAULT 0,
+    is_primary   BOOLEAN      NOT NULL DEFAULT FALSE,
+    KEY ix_product_media_product (product_id, position),
+    CONSTRAINT fk_product_media_product FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE
+) ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS warehouses (
+    id        INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id VARCHAR(64)  NOT NULL DEFAULT 'default',
+    code      VARCHAR(64)  NOT NULL,
+    name      VARCHAR(255) NOT NULL,
+    address   VARCHAR(512) NOT NULL DEFAULT '',
+    UNIQUE KEY uq_warehouses_tenant_code (tenant_id, code)
+) ENGINE=InnoDB;
+
+-- Levels of zero are kept, deleting an empty warehouse drops them
+CREATE TABLE IF NOT EXISTS warehouse_stock (
+    warehouse_id INT NOT NULL,
+    product_id   INT NOT NULL,
+    quantity     INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (warehouse_id, product_id),
+    KEY ix_warehouse_stock_product (product_id),
+    CONSTRAINT fk_warehouse_stock_warehouse FOREIGN KEY (warehouse_id) REFERENCES warehouses (id) ON DELETE CASCADE,
+    CONSTRAINT fk_warehouse_stock_product FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE
+) ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS warehouse_transfers (
+    id                INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id         VARCHAR(64) NOT NULL,
+    product_id        INT         NOT NULL,
+    from_warehouse_id INT         NOT NULL,
+    to_warehouse_id   INT         NOT NULL,
+    quantity          INT         NOT NULL,
+    created_at        DATETIME(6) NOT NULL,
+    KEY ix_warehouse_transfers_tenant_product (tenant_id, product_id)
+) ENGINE=InnoDB;
+
+-- The ledger outlives the products and warehouses it mentions
+CREATE TABLE IF NOT EXISTS inventory_ledger (
+    id           BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id    VARCHAR(64)  NOT NULL,
+    product_id   INT          NOT NULL,
+    warehouse_id INT          NULL,
+    delta        INT          NOT NULL,
+    reason       VARCHAR(32)  NOT NULL,
+    reference    VARCHAR(255) NOT NULL DEFAULT '',
+    stock_after  INT          NOT NULL,
+    created_at   DATETIME(6)  NOT NULL,
+    KEY ix_inventory_ledger_tenant_product (tenant_id, product_id, id)
+) ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id         INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id  VARCHAR(64)  NOT NULL,
+    product_id INT          NOT NULL,
+    quantity   INT          NOT NULL,
+    reference  VARCHAR(255) NOT NULL DEFAULT '',
+    status     VARCHAR(16)  NOT NULL,
+    expires_at DATETIME(6)  NOT NULL,
+    created_at DATETIME(6)  NOT NULL,
+    KEY ix_stock_reservations_product (product_id, status),
+    KEY ix_stock_reservations_expiry (status, expires_at)
+) ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS product_reorder_settings (
+    tenant_id        VARCHAR(64) NOT NULL,
+    product_id       INT         NOT NULL,
+    reorder_point    INT         NOT NULL,
+    reorder_quantity INT         NOT NULL,
+    PRIMARY KEY (tenant_id, product_id),
+    CONSTRAINT fk_product_reorder_settings_product FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE
+) ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS stock_alerts (
+    id               INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id        VARCHAR(64)  NOT NULL,
+    product_id       INT          NOT NULL,
+    product_code     VARCHAR(64)  NOT NULL DEFAULT '',
+    name             VARCHAR(255) NOT NULL DEFAULT '',
+    stock            INT          NOT NULL,
+    reorder_point    INT          NOT NULL,
+    reorder_quantity INT          NOT NULL,
+    status           VARCHAR(16)  NOT NULL,
+    created_at       DATETIME(6)  NOT NULL,
+    resolved_at      DATETIME(6)  NULL,
+    KEY ix_stock_alerts_tenant_product (tenant_id, product_id, status)
+) ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS orders (
+    id         INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id  VARCHAR(64)   NOT NULL,
+    reference  VARCHAR(255)  NOT NULL DEFAULT '',
+    status     VARCHAR(16)   NOT NULL,
+    total      DECIMAL(12,2) NOT NULL,
+    created_at DATETIME(6)   NOT NULL,
+    updated_at DATETIME(6)   NOT NULL,
+    KEY ix_orders_tenant (tenant_id, id)
+) ENGINE=InnoDB;
+
+-- Items keep a snapshot of the product, which may be deleted later
+CREATE TABLE IF NOT EXISTS order_items (
+    id           INT AUTO_INCREMENT PRIMARY KEY,
+    order_id     INT           NOT NULL,
+    product_id   INT           NOT NULL,
+    product_code VARCHAR(64)   NOT NULL DEFAULT '',
+    name         VARCHAR(255)  NOT NULL DEFAULT '',
+    unit_price   DECIMAL(12,2) NOT NULL,
+    quantity     INT           NOT NULL,
+    subtotal     DECIMAL(12,2) NOT NULL,
+    CONSTRAINT fk_order_items_order FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE
+) ENGINE=InnoDB;
+
+-- claimed_until is the lease of the relay publishing the event
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id             BIGINT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id      VARCHAR(64) NOT NULL,
+    aggregate_type VARCHAR(64) NOT NULL,
+    aggregate_id   INT         NOT NULL,
+    type           VARCHAR(64) NOT NULL,
+    payload        JSON        NOT NULL,
+    created_at     DATETIME(6) NOT NULL,
+    published_at   DATETIME(6) NULL,
+    claimed_until  DATETIME(6) NULL,
+    KEY ix_outbox_events_pending (published_at, id),
+    KEY ix_outbox_events_tenant (tenant_id, id)
+) ENGINE=InnoDB;
+
+-- events is a comma separated list of event types, empty for all
+CREATE TABLE IF NOT EXISTS webhooks (
+    id                   INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id            VARCHAR(64)   NOT NULL,
+    url                  VARCHAR(2048) NOT NULL,
+    events               TEXT          NOT NULL,
+    secret               VARCHAR(255)  NOT NULL,
+    active               BOOLEAN       NOT NULL DEFAULT TRUE,
+    consecutive_failures INT           NOT NULL DEFAULT 0,
+    disabled_at          DATETIME(6)   NULL,
+    created_at           DATETIME(6)   NOT NULL,
+    KEY ix_webhooks_tenant (tenant_id, active)
+) ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id          INT AUTO_INCREMENT PRIMARY KEY,
+    webhook_id  INT         NOT NULL,
+    event_id    BIGINT      NOT NULL,
+    event_type  VARCHAR(64) NOT NULL,
+    attempt     INT         NOT NULL,
+    status_code INT         NOT NULL DEFAULT 0,
+    error       TEXT        NOT NULL,
+    duration_ms BIGINT      NOT NULL,
+    payload     JSON        NOT NULL,
+    created_at  DATETIME(6) NOT NULL,
+    KEY ix_webhook_deliveries_webhook (webhook_id, id),
+    CONSTRAINT fk_webhook_deliveries_webhook FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE CASCADE
+) ENGINE=InnoDB;
+
+-- roles is a comma separated list of roles
+CREATE TABLE IF NOT EXISTS users (
+    id            INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id     VARCHAR(64)  NOT NULL,
+    email         VARCHAR(255) NOT NULL,
+    name          VARCHAR(255) NOT NULL DEFAULT '',
+    roles         TEXT         NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    failed_logins INT          NOT NULL DEFAULT 0,
+    locked_until  DATETIME(6)  NULL,
+    created_at    DATETIME(6)  NOT NULL,
+    UNIQUE KEY uq_users_tenant_email (tenant_id, email)
+) ENGINE=InnoDB;
+
+-- scopes is a comma separated list of scopes
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id    VARCHAR(64)  NOT NULL,
+    name         VARCHAR(255) NOT NULL,
+    prefix       VARCHAR(16)  NOT NULL,
+    key_hash     CHAR(64)     NOT NULL,
+    scopes       TEXT         NOT NULL,
+    created_by   VARCHAR(255) NOT NULL,
+    expires_at   DATETIME(6)  NULL,
+    last_used_at DATETIME(6)  NULL,
+    revoked_at   DATETIME(6)  NULL,
+    created_at   DATETIME(6)  NOT NULL,
+    UNIQUE KEY uq_api_keys_hash (key_hash),
+    KEY ix_api_keys_tenant (tenant_id, id)
+) ENGINE=InnoDB;
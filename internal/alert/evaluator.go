@@ -0,0 +1,131 @@
+package alert
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/order"
+	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+// Evaluator checks products for low stock in the background. Products
+// written through the observed product.Service are queued right away,
+// and a periodic sweep catches stock changed by other paths.
+type Evaluator struct {
+	service  Service
+	log      *slog.Logger
+	queue    chan queued
+	interval time.Duration
+}
+
+// queued is a product waiting for evaluation in the tenant that wrote it
+type queued struct {
+	tenant    string
+	productID int
+}
+
+func NewEvaluator(service Service, interval time.Duration, log *slog.Logger) *Evaluator {
+	return &Evaluator{service: service, log: log, queue: make(chan queued, 256), interval: interval}
+}
+
+// Enqueue schedules a product of the tenant of ctx for evaluation without
+// blocking the caller, if the queue is full the next sweep picks the
+// product up.
+func (e *Evaluator) Enqueue(ctx context.Context, productID int) {
+	select {
+	case e.queue <- queued{tenant: tenant.FromContext(ctx), productID: productID}:
+	default:
+	}
+}
+
+func (e *Evaluator) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case q := <-e.queue:
+			if err := e.service.Evaluate(tenant.WithID(ctx, q.tenant), q.productID); err != nil {
+				e.log.Error("evaluate low stock", "tenant", q.tenant, "product_id", q.productID, "error", err)
+			}
+		case <-ticker.C:
+			if err := e.service.Sweep(ctx); err != nil {
+				e.log.Error("sweep low stock", "error", err)
+			}
+		}
+	}
+}
+
+type observedProductService struct {
+	product.Service
+	evaluator *Evaluator
+}
+
+// ObserveProducts wraps a product.Service so every successful write
+// queues the product for low-stock evaluation.
+func ObserveProducts(next product.Service, evaluator *Evaluator) product.Service {
+	return &observedProductService{Service: next, evaluator: evaluator}
+}
+
+func (s *observedProductService) Create(ctx context.Context, p domain.Product) (domain.Product, error) {
+	p, err := s.Service.Create(ctx, p)
+	if err == nil && p.ID != nil {
+		s.evaluator.Enqueue(ctx, *p.ID)
+	}
+	return p, err
+}
+
+func (s *observedProductService) Update(ctx context.Context, id int, p domain.Product) (domain.Product, error) {
+	p, err := s.Service.Update(ctx, id, p)
+	if err == nil {
+		s.evaluator.Enqueue(ctx, id)
+	}
+	return p, err
+}
+
+func (s *observedProductService) Batch(ctx context.Context, mode string, ops []domain.ProductBatchOperation) ([]domain.ProductBatchResult, error) {
+	results, err := s.Service.Batch(ctx, mode, ops)
+	for _, res := range results {
+		if (res.Status == product.StatusCreated || res.Status == product.StatusUpdated) && res.ID != nil {
+			s.evaluator.Enqueue(ctx, *res.ID)
+		}
+	}
+	return results, err
+}
+
+type observedOrderService struct {
+	order.Service
+	evaluator *Evaluator
+}
+
+// ObserveOrders wraps an order.Service so the products of every order
+// created or cancelled are queued for low-stock evaluation.
+func ObserveOrders(next order.Service, evaluator *Evaluator) order.Service {
+	return &observedOrderService{Service: next, evaluator: evaluator}
+}
+
+func (s *observedOrderService) Create(ctx context.Context, reference string, items []domain.OrderItem) (domain.Order, error) {
+	o, err := s.Service.Create(ctx, reference, items)
+	if err == nil {
+		s.enqueue(ctx, o)
+	}
+	return o, err
+}
+
+func (s *observedOrderService) UpdateStatus(ctx context.Context, id int, status string) (domain.Order, error) {
+	o, err := s.Service.UpdateStatus(ctx, id, status)
+	if err == nil && o.Status == order.StatusCancelled {
+		s.enqueue(ctx, o)
+	}
+	return o, err
+}
+
+func (s *observedOrderService) enqueue(ctx context.Context, o domain.Order) {
+	for _, item := range o.Items {
+		s.evaluator.Enqueue(ctx, item.ProductID)
+	}
+}
@@ -0,0 +1,154 @@
+package alert
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/db"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+type Repository interface {
+	GetSetting(ctx context.Context, productID int) (domain.ReorderSetting, error)
+	SaveSetting(ctx context.Context, s domain.ReorderSetting) error
+	Level(ctx context.Context, productID int) (domain.StockAlert, error)
+	// Levels returns the levels of every tenant, each with its tenant set
+	Levels(ctx context.Context) ([]domain.StockAlert, error)
+	GetOpen(ctx context.Context, productID int) (domain.StockAlert, error)
+	Save(ctx context.Context, a domain.StockAlert) (int, error)
+	Resolve(ctx context.Context, id int, at time.Time) error
+	List(ctx context.Context, status string) ([]domain.StockAlert, error)
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// conn joins the transaction active in ctx, if any, labelling its
+// statements with the repository method op
+func (r *repository) conn(ctx context.Context, op string) db.Executor {
+	return db.Conn(ctx, r.db, "alert", op)
+}
+
+// Query all reorder settings and alerts. Every query is scoped to the
+// tenant of the context, whose id is their first argument.
+var (
+	getSettingQuery  = `SELECT product_id, reorder_point, reorder_quantity FROM product_reorder_settings WHERE tenant_id = ? AND product_id = ?`
+	saveSettingQuery = `INSERT INTO product_reorder_settings (tenant_id, product_id, reorder_point, reorder_quantity) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE reorder_point = VALUES(reorder_point), reorder_quantity = VALUES(reorder_quantity)`
+	// The only query across tenants, the sweep evaluates each level under
+	// its own tenant
+	levelsQuery = `SELECT p.tenant_id, p.id, COALESCE(p.product_code, ''), COALESCE(p.name, ''), COALESCE(p.stock, 0), s.reorder_point, s.reorder_quantity
+		FROM products p JOIN product_reorder_settings s ON s.tenant_id = p.tenant_id AND s.product_id = p.id`
+	levelByProductQuery = levelsQuery + ` WHERE p.tenant_id = ? AND p.id = ?`
+	alertColumns        = `id, product_id, product_code, name, stock, reorder_point, reorder_quantity, status, created_at, resolved_at`
+	getOpenAlertQuery   = `SELECT ` + alertColumns + ` FROM stock_alerts WHERE tenant_id = ? AND product_id = ? AND status = 'open' ORDER BY id DESC LIMIT 1`
+	listAlertsQuery     = `SELECT ` + alertColumns + ` FROM stock_alerts WHERE tenant_id = ? AND (? = '' OR status = ?) ORDER BY id DESC`
+	createAlertQuery    = `INSERT INTO stock_alerts (tenant_id, product_id, product_code, name, stock, reorder_point, reorder_quantity, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	resolveAlertQuery   = `UPDATE stock_alerts SET status = 'resolved', resolved_at = ? WHERE tenant_id = ? AND id = ? AND status = 'open'`
+)
+
+func (r *repository) GetSetting(ctx context.Context, productID int) (domain.ReorderSetting, error) {
+	var s domain.ReorderSetting
+	err := r.conn(ctx, "GetSetting").QueryRowContext(ctx, getSettingQuery, tenant.FromContext(ctx), productID).Scan(&s.ProductID, &s.ReorderPoint, &s.ReorderQuantity)
+	if err == sql.ErrNoRows {
+		return s, ErrSettingNotFound
+	}
+	return s, err
+}
+
+func (r *repository) SaveSetting(ctx context.Context, s domain.ReorderSetting) error {
+	_, err := r.conn(ctx, "SaveSetting").ExecContext(ctx, saveSettingQuery, tenant.FromContext(ctx), s.ProductID, s.ReorderPoint, s.ReorderQuantity)
+	return err
+}
+
+func (r *repository) Level(ctx context.Context, productID int) (domain.StockAlert, error) {
+	a, err := scanLevel(r.conn(ctx, "Level").QueryRowContext(ctx, levelByProductQuery, tenant.FromContext(ctx), productID))
+	if err == sql.ErrNoRows {
+		return a, ErrSettingNotFound
+	}
+	return a, err
+}
+
+func (r *repository) Levels(ctx context.Context) ([]domain.StockAlert, error) {
+	rows, err := r.conn(ctx, "Levels").QueryContext(ctx, levelsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var levels []domain.StockAlert
+	for rows.Next() {
+		a, err := scanLevel(rows)
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, a)
+	}
+	return levels, rows.Err()
+}
+
+func (r *repository) GetOpen(ctx context.Context, productID int) (domain.StockAlert, error) {
+	a, err := scanAlert(r.conn(ctx, "GetOpen").QueryRowContext(ctx, getOpenAlertQuery, tenant.FromContext(ctx), productID))
+	if err == sql.ErrNoRows {
+		return a, ErrNotFound
+	}
+	return a, err
+}
+
+func (r *repository) Save(ctx context.Context, a domain.StockAlert) (int, error) {
+	res, err := r.conn(ctx, "Save").ExecContext(ctx, createAlertQuery, tenant.FromContext(ctx), a.ProductID, a.ProductCode, a.Name, a.Stock, a.ReorderPoint, a.ReorderQuantity, a.Status, a.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *repository) Resolve(ctx context.Context, id int, at time.Time) error {
+	_, err := r.conn(ctx, "Resolve").ExecContext(ctx, resolveAlertQuery, at, tenant.FromContext(ctx), id)
+	return err
+}
+
+func (r *repository) List(ctx context.Context, status string) ([]domain.StockAlert, error) {
+	rows, err := r.conn(ctx, "List").QueryContext(ctx, listAlertsQuery, tenant.FromContext(ctx), status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []domain.StockAlert{}
+	for rows.Next() {
+		a, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLevel(s scanner) (domain.StockAlert, error) {
+	var a domain.StockAlert
+	err := s.Scan(&a.Tenant, &a.ProductID, &a.ProductCode, &a.Name, &a.Stock, &a.ReorderPoint, &a.ReorderQuantity)
+	return a, err
+}
+
+func scanAlert(s scanner) (domain.StockAlert, error) {
+	var a domain.StockAlert
+	err := s.Scan(&a.ID, &a.ProductID, &a.ProductCode, &a.Name, &a.Stock, &a.ReorderPoint, &a.ReorderQuantity, &a.Status, &a.CreatedAt, &a.ResolvedAt)
+	return a, err
+}
@@ -0,0 +1,120 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/notify"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+type Service interface {
+	GetSetting(ctx context.Context, productID int) (domain.ReorderSetting, error)
+	SaveSetting(ctx context.Context, s domain.ReorderSetting) (domain.ReorderSetting, error)
+	List(ctx context.Context, status string) ([]domain.StockAlert, error)
+	Evaluate(ctx context.Context, productID int) error
+	Sweep(ctx context.Context) error
+}
+
+// Alert statuses
+const (
+	StatusOpen     = "open"
+	StatusResolved = "resolved"
+)
+
+var (
+	ErrNotFound        = errors.New("alert not found")
+	ErrSettingNotFound = errors.New("reorder setting not found")
+	ErrInvalidSetting  = errors.New("reorder point and quantity must not be negative")
+	ErrInvalidStatus   = errors.New("invalid alert status")
+)
+
+type service struct {
+	repo     Repository
+	notifier notify.Notifier
+	now      func() time.Time
+}
+
+func NewService(repo Repository, notifier notify.Notifier) Service {
+	return &service{repo: repo, notifier: notifier, now: time.Now}
+}
+
+func (s *service) GetSetting(ctx context.Context, productID int) (domain.ReorderSetting, error) {
+	return s.repo.GetSetting(ctx, productID)
+}
+
+func (s *service) SaveSetting(ctx context.Context, setting domain.ReorderSetting) (domain.ReorderSetting, error) {
+	if setting.ReorderPoint < 0 || setting.ReorderQuantity < 0 {
+		return domain.ReorderSetting{}, ErrInvalidSetting
+	}
+	if err := s.repo.SaveSetting(ctx, setting); err != nil {
+		return domain.ReorderSetting{}, err
+	}
+	return setting, s.Evaluate(ctx, setting.ProductID)
+}
+
+func (s *service) List(ctx context.Context, status string) ([]domain.StockAlert, error) {
+	if status != "" && status != StatusOpen && status != StatusResolved {
+		return nil, ErrInvalidStatus
+	}
+	return s.repo.List(ctx, status)
+}
+
+// Evaluate opens an alert when the product stock is below its reorder
+// point and resolves it once stock recovers. Only one alert is open per
+// product at a time, so notifications are sent once per shortage.
+func (s *service) Evaluate(ctx context.Context, productID int) error {
+	level, err := s.repo.Level(ctx, productID)
+	if errors.Is(err, ErrSettingNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.evaluate(ctx, level)
+}
+
+func (s *service) Sweep(ctx context.Context) error {
+	levels, err := s.repo.Levels(ctx)
+	if err != nil {
+		return err
+	}
+	for _, level := range levels {
+		if err := s.evaluate(tenant.WithID(ctx, level.Tenant), level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) evaluate(ctx context.Context, level domain.StockAlert) error {
+	open, err := s.repo.GetOpen(ctx, level.ProductID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	hasOpen := err == nil
+	low := level.Stock < level.ReorderPoint
+
+	switch {
+	case low && !hasOpen:
+		level.Status = StatusOpen
+		level.CreatedAt = s.now().UTC()
+		id, err := s.repo.Save(ctx, level)
+		if err != nil {
+			return err
+		}
+		level.ID = id
+		return s.notifier.Notify(ctx, notify.Message{
+			Subject: fmt.Sprintf("Low stock: %s (%s)", level.Name, level.ProductCode),
+			Body: fmt.Sprintf("Stock is %d, below the reorder point of %d. Suggested reorder quantity: %d.",
+				level.Stock, level.ReorderPoint, level.ReorderQuantity),
+			Data: level,
+		})
+	case !low && hasOpen:
+		return s.repo.Resolve(ctx, open.ID, s.now().UTC())
+	}
+	return nil
+}
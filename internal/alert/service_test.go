@@ -0,0 +1,125 @@
+package alert
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/order"
+	"github.com/vincentconace/api-gin/pkg/logging"
+	"github.com/vincentconace/api-gin/pkg/notify"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+var ctx = context.Background()
+
+type repositoryStub struct {
+	Repository
+	level  domain.StockAlert
+	levels []domain.StockAlert
+	alerts []domain.StockAlert
+}
+
+func (r *repositoryStub) Levels(ctx context.Context) ([]domain.StockAlert, error) {
+	return r.levels, nil
+}
+
+func (r *repositoryStub) Level(ctx context.Context, productID int) (domain.StockAlert, error) {
+	return r.level, nil
+}
+
+func (r *repositoryStub) GetOpen(ctx context.Context, productID int) (domain.StockAlert, error) {
+	for _, a := range r.alerts {
+		if a.Tenant == tenant.FromContext(ctx) && a.ProductID == productID && a.Status == StatusOpen {
+			return a, nil
+		}
+	}
+	return domain.StockAlert{}, ErrNotFound
+}
+
+func (r *repositoryStub) Save(ctx context.Context, a domain.StockAlert) (int, error) {
+	a.Tenant = tenant.FromContext(ctx)
+	a.ID = len(r.alerts) + 1
+	r.alerts = append(r.alerts, a)
+	return a.ID, nil
+}
+
+func (r *repositoryStub) Resolve(ctx context.Context, id int, at time.Time) error {
+	r.alerts[id-1].Status = StatusResolved
+	return nil
+}
+
+type notifierStub struct {
+	messages []notify.Message
+}
+
+func (n *notifierStub) Notify(ctx context.Context, m notify.Message) error {
+	n.messages = append(n.messages, m)
+	return nil
+}
+
+func TestEvaluateOpensSingleAlert(t *testing.T) {
+	repo := &repositoryStub{level: domain.StockAlert{ProductID: 1, Name: "Product 1", Stock: 2, ReorderPoint: 5, ReorderQuantity: 20}}
+	notifier := &notifierStub{}
+	service := NewService(repo, notifier)
+
+	assert.NoError(t, service.Evaluate(ctx, 1))
+	assert.NoError(t, service.Evaluate(ctx, 1))
+
+	assert.Len(t, repo.alerts, 1)
+	assert.Equal(t, StatusOpen, repo.alerts[0].Status)
+	assert.Len(t, notifier.messages, 1)
+}
+
+func TestEvaluateResolvesRecoveredStock(t *testing.T) {
+	repo := &repositoryStub{level: domain.StockAlert{ProductID: 1, Stock: 2, ReorderPoint: 5}}
+	notifier := &notifierStub{}
+	service := NewService(repo, notifier)
+
+	assert.NoError(t, service.Evaluate(ctx, 1))
+	repo.level.Stock = 30
+	assert.NoError(t, service.Evaluate(ctx, 1))
+
+	assert.Equal(t, StatusResolved, repo.alerts[0].Status)
+
+	// A new shortage notifies again
+	repo.level.Stock = 1
+	assert.NoError(t, service.Evaluate(ctx, 1))
+	assert.Len(t, repo.alerts, 2)
+	assert.Len(t, notifier.messages, 2)
+}
+
+func TestSweepOkEvaluatesInTenantOfProduct(t *testing.T) {
+	repo := &repositoryStub{levels: []domain.StockAlert{
+		{Tenant: "acme", ProductID: 1, Stock: 2, ReorderPoint: 5},
+		{Tenant: "globex", ProductID: 1, Stock: 1, ReorderPoint: 5},
+	}}
+	service := NewService(repo, &notifierStub{})
+
+	assert.NoError(t, service.Sweep(ctx))
+
+	assert.Len(t, repo.alerts, 2)
+	assert.Equal(t, "acme", repo.alerts[0].Tenant)
+	assert.Equal(t, "globex", repo.alerts[1].Tenant)
+}
+
+type orderServiceStub struct {
+	order.Service
+}
+
+func (s *orderServiceStub) Create(ctx context.Context, reference string, items []domain.OrderItem) (domain.Order, error) {
+	return domain.Order{ID: 1, Items: items}, nil
+}
+
+func TestObserveOrdersOkQueuesProducts(t *testing.T) {
+	evaluator := NewEvaluator(NewService(&repositoryStub{}, &notifierStub{}), time.Minute, logging.Discard())
+	service := ObserveOrders(&orderServiceStub{}, evaluator)
+
+	_, err := service.Create(tenant.WithID(ctx, "acme"), "", []domain.OrderItem{{ProductID: 1}, {ProductID: 2}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, queued{tenant: "acme", productID: 1}, <-evaluator.queue)
+	assert.Equal(t, queued{tenant: "acme", productID: 2}, <-evaluator.queue)
+}
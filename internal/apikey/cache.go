@@ -0,0 +1,80 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vincentconace/api-gin/internal/domain"
+)
+
+const (
+	cacheTTL = 5 * time.Minute
+	// Unknown keys are remembered briefly so guessing doesn't hit the database
+	missTTL = 30 * time.Second
+	// last_used_at is written at most this often per key
+	touchInterval = time.Minute
+)
+
+// Cache keeps keys by hash for fast validation
+type Cache interface {
+	// Get reports whether hash is cached and, if so, whether it is a known key
+	Get(ctx context.Context, hash string) (k domain.APIKey, known, cached bool, err error)
+	Set(ctx context.Context, hash string, k domain.APIKey) error
+	SetUnknown(ctx context.Context, hash string) error
+	Delete(ctx context.Context, hash string) error
+	// ShouldTouch reports whether last use of id is due to be recorded
+	ShouldTouch(ctx context.Context, id int) bool
+}
+
+type redisCache struct {
+	rd *redis.Client
+}
+
+func NewRedisCache(rd *redis.Client) Cache {
+	return &redisCache{rd: rd}
+}
+
+func (c *redisCache) Get(ctx context.Context, hash string) (domain.APIKey, bool, bool, error) {
+	var k domain.APIKey
+	data, err := c.rd.Get(ctx, cacheKey(hash)).Bytes()
+	if err == redis.Nil {
+		return k, false, false, nil
+	}
+	if err != nil {
+		return k, false, false, err
+	}
+	if len(data) == 0 {
+		return k, false, true, nil
+	}
+	err = json.Unmarshal(data, &k)
+	k.Hash = hash
+	return k, err == nil, err == nil, err
+}
+
+func (c *redisCache) Set(ctx context.Context, hash string, k domain.APIKey) error {
+	data, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+	return c.rd.Set(ctx, cacheKey(hash), data, cacheTTL).Err()
+}
+
+func (c *redisCache) SetUnknown(ctx context.Context, hash string) error {
+	return c.rd.Set(ctx, cacheKey(hash), "", missTTL).Err()
+}
+
+func (c *redisCache) Delete(ctx context.Context, hash string) error {
+	return c.rd.Del(ctx, cacheKey(hash)).Err()
+}
+
+func (c *redisCache) ShouldTouch(ctx context.Context, id int) bool {
+	ok, err := c.rd.SetNX(ctx, "apikey:used["+strconv.Itoa(id)+"]", 1, touchInterval).Result()
+	return err == nil && ok
+}
+
+func cacheKey(hash string) string {
+	return "apikey[" + hash + "]"
+}
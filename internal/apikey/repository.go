@@ -0,0 +1,126 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/db"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+type Repository interface {
+	Get(ctx context.Context) ([]domain.APIKey, error)
+	GetById(ctx context.Context, id int) (domain.APIKey, error)
+	GetByHash(ctx context.Context, hash string) (domain.APIKey, error)
+	Save(ctx context.Context, k domain.APIKey) (int, error)
+	Revoke(ctx context.Context, id int, at time.Time) error
+	Touch(ctx context.Context, id int, at time.Time) error
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// conn joins the transaction active in ctx, if any, labelling its
+// statements with the repository method op
+func (r *repository) conn(ctx context.Context, op string) db.Executor {
+	return db.Conn(ctx, r.db, "apikey", op)
+}
+
+// Query all api keys
+var (
+	apiKeyColumns      = `id, name, prefix, key_hash, scopes, created_by, tenant_id, expires_at, last_used_at, revoked_at, created_at`
+	getAPIKeysQuery    = `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE tenant_id = ? ORDER BY id`
+	getAPIKeyByIdQuery = `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE tenant_id = ? AND id = ?`
+	getAPIKeyByHash    = `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = ?`
+	createAPIKeyQuery  = `INSERT INTO api_keys (name, prefix, key_hash, scopes, created_by, tenant_id, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	revokeAPIKeyQuery  = `UPDATE api_keys SET revoked_at = ? WHERE tenant_id = ? AND id = ? AND revoked_at IS NULL`
+	touchAPIKeyQuery   = `UPDATE api_keys SET last_used_at = ? WHERE id = ?`
+)
+
+func (r *repository) Get(ctx context.Context) ([]domain.APIKey, error) {
+	rows, err := r.conn(ctx, "Get").QueryContext(ctx, getAPIKeysQuery, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []domain.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *repository) GetById(ctx context.Context, id int) (domain.APIKey, error) {
+	k, err := scanAPIKey(r.conn(ctx, "GetById").QueryRowContext(ctx, getAPIKeyByIdQuery, tenant.FromContext(ctx), id))
+	if err == sql.ErrNoRows {
+		return k, ErrNotFound
+	}
+	return k, err
+}
+
+func (r *repository) GetByHash(ctx context.Context, hash string) (domain.APIKey, error) {
+	k, err := scanAPIKey(r.conn(ctx, "GetByHash").QueryRowContext(ctx, getAPIKeyByHash, hash))
+	if err == sql.ErrNoRows {
+		return k, ErrNotFound
+	}
+	return k, err
+}
+
+func (r *repository) Save(ctx context.Context, k domain.APIKey) (int, error) {
+	res, err := r.conn(ctx, "Save").ExecContext(ctx, createAPIKeyQuery, k.Name, k.Prefix, k.Hash, strings.Join(k.Scopes, ","), k.CreatedBy, k.Tenant, k.ExpiresAt, k.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *repository) Revoke(ctx context.Context, id int, at time.Time) error {
+	res, err := r.conn(ctx, "Revoke").ExecContext(ctx, revokeAPIKeyQuery, at, tenant.FromContext(ctx), id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows < 1 {
+		return ErrAlreadyRevoked
+	}
+	return nil
+}
+
+func (r *repository) Touch(ctx context.Context, id int, at time.Time) error {
+	_, err := r.conn(ctx, "Touch").ExecContext(ctx, touchAPIKeyQuery, at, id)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(s scanner) (domain.APIKey, error) {
+	var k domain.APIKey
+	var scopes string
+	err := s.Scan(&k.ID, &k.Name, &k.Prefix, &k.Hash, &scopes, &k.CreatedBy, &k.Tenant, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.CreatedAt)
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+	return k, err
+}
@@ -0,0 +1,163 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+type Service interface {
+	Get(ctx context.Context) ([]domain.APIKey, error)
+	GetById(ctx context.Context, id int) (domain.APIKey, error)
+	// Create generates a key for k.Scopes on behalf of creator, who must
+	// hold every scope granted. The key is only returned here.
+	Create(ctx context.Context, creator auth.Principal, k domain.APIKey) (domain.APIKey, error)
+	Revoke(ctx context.Context, id int) error
+	// VerifyKey identifies the caller presenting key, so the service can
+	// back auth.Authenticate
+	VerifyKey(ctx context.Context, key string) (auth.Principal, error)
+}
+
+const (
+	// Generated keys look like ak_<prefix>_<secret>
+	keyScheme    = "ak_"
+	prefixLength = 8
+	secretBytes  = 24
+	// Subject of the principal of a key is its id after this
+	SubjectPrefix = "apikey:"
+)
+
+var (
+	ErrNotFound        = errors.New("api key not found")
+	ErrAlreadyRevoked  = errors.New("api key already revoked")
+	ErrNameRequired    = errors.New("name is required")
+	ErrScopesRequired  = errors.New("at least one scope is required")
+	ErrScopeNotGranted = errors.New("scopes can't exceed the creator's roles")
+	ErrExpired         = errors.New("expires_at must be in the future")
+)
+
+type service struct {
+	repo  Repository
+	cache Cache
+	log   *slog.Logger
+}
+
+func NewService(repo Repository, cache Cache, log *slog.Logger) Service {
+	return &service{repo: repo, cache: cache, log: log}
+}
+
+func (s *service) Get(ctx context.Context) ([]domain.APIKey, error) {
+	return s.repo.Get(ctx)
+}
+
+func (s *service) GetById(ctx context.Context, id int) (domain.APIKey, error) {
+	return s.repo.GetById(ctx, id)
+}
+
+func (s *service) Create(ctx context.Context, creator auth.Principal, k domain.APIKey) (domain.APIKey, error) {
+	k.Name = strings.TrimSpace(k.Name)
+	if k.Name == "" {
+		return k, ErrNameRequired
+	}
+	if len(k.Scopes) == 0 {
+		return k, ErrScopesRequired
+	}
+	for _, scope := range k.Scopes {
+		if !creator.HasRole(scope) {
+			return k, fmt.Errorf("%w: %s", ErrScopeNotGranted, scope)
+		}
+	}
+	now := time.Now().UTC()
+	if k.ExpiresAt != nil && !k.ExpiresAt.After(now) {
+		return k, ErrExpired
+	}
+
+	k.Prefix, k.Key = newKey()
+	k.Hash = hashKey(k.Key)
+	k.CreatedBy = creator.Subject
+	k.Tenant = tenant.FromContext(ctx)
+	k.CreatedAt = now
+	id, err := s.repo.Save(ctx, k)
+	if err != nil {
+		return k, err
+	}
+	k.ID = id
+	return k, nil
+}
+
+func (s *service) Revoke(ctx context.Context, id int) error {
+	k, err := s.repo.GetById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Revoke(ctx, id, time.Now().UTC()); err != nil {
+		return err
+	}
+	return s.cache.Delete(ctx, k.Hash)
+}
+
+// VerifyKey looks keys up in the cache before the database. Revocation
+// drops the cached entry; expiry is checked on every use.
+func (s *service) VerifyKey(ctx context.Context, key string) (auth.Principal, error) {
+	if !strings.HasPrefix(key, keyScheme) {
+		return auth.Principal{}, auth.ErrInvalidKey
+	}
+	hash := hashKey(key)
+	k, known, cached, err := s.cache.Get(ctx, hash)
+	if err != nil {
+		// The database still answers when Redis doesn't
+		s.log.WarnContext(ctx, "api key cache unavailable", "error", err)
+	}
+	if !cached {
+		k, err = s.repo.GetByHash(ctx, hash)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			s.cache.SetUnknown(ctx, hash)
+			return auth.Principal{}, auth.ErrInvalidKey
+		case err != nil:
+			return auth.Principal{}, err
+		}
+		known = true
+		s.cache.Set(ctx, hash, k)
+	}
+	if !known || k.RevokedAt != nil {
+		return auth.Principal{}, auth.ErrInvalidKey
+	}
+	now := time.Now().UTC()
+	if k.ExpiresAt != nil && !k.ExpiresAt.After(now) {
+		return auth.Principal{}, auth.ErrInvalidKey
+	}
+
+	if s.cache.ShouldTouch(ctx, k.ID) {
+		if err := s.repo.Touch(ctx, k.ID, now); err != nil {
+			s.log.ErrorContext(ctx, "record api key use", "api_key_id", k.ID, "error", err)
+		}
+	}
+	return auth.Principal{Subject: SubjectPrefix + strconv.Itoa(k.ID), Roles: k.Scopes, Tenant: k.Tenant}, nil
+}
+
+// newKey returns the public prefix, used to tell keys apart in listings,
+// and the full key
+func newKey() (string, string) {
+	b := make([]byte, secretBytes)
+	rand.Read(b)
+	secret := hex.EncodeToString(b)
+	prefix := keyScheme + secret[:prefixLength]
+	return prefix, prefix + "_" + secret[prefixLength:]
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,205 @@
+package apikey
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/logging"
+)
+
+var ctx = context.Background()
+
+// repoStub keeps keys in memory and counts lookups by hash
+type repoStub struct {
+	keys    map[int]domain.APIKey
+	lookups int
+	touched int
+}
+
+func (r *repoStub) Get(ctx context.Context) ([]domain.APIKey, error) {
+	var keys []domain.APIKey
+	for id := 1; id <= len(r.keys); id++ {
+		keys = append(keys, r.keys[id])
+	}
+	return keys, nil
+}
+
+func (r *repoStub) GetById(ctx context.Context, id int) (domain.APIKey, error) {
+	k, ok := r.keys[id]
+	if !ok {
+		return k, ErrNotFound
+	}
+	return k, nil
+}
+
+func (r *repoStub) GetByHash(ctx context.Context, hash string) (domain.APIKey, error) {
+	r.lookups++
+	for _, k := range r.keys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+	return domain.APIKey{}, ErrNotFound
+}
+
+func (r *repoStub) Save(ctx context.Context, k domain.APIKey) (int, error) {
+	k.ID = len(r.keys) + 1
+	// Like the table, keep no trace of the key itself
+	k.Key = ""
+	r.keys[k.ID] = k
+	return k.ID, nil
+}
+
+func (r *repoStub) Revoke(ctx context.Context, id int, at time.Time) error {
+	k := r.keys[id]
+	if k.RevokedAt != nil {
+		return ErrAlreadyRevoked
+	}
+	k.RevokedAt = &at
+	r.keys[id] = k
+	return nil
+}
+
+func (r *repoStub) Touch(ctx context.Context, id int, at time.Time) error {
+	r.touched++
+	return nil
+}
+
+// cacheStub is an in-memory Cache; touches are always due
+type cacheStub struct {
+	entries map[string]*domain.APIKey
+}
+
+func (c *cacheStub) Get(ctx context.Context, hash string) (domain.APIKey, bool, bool, error) {
+	k, ok := c.entries[hash]
+	if !ok {
+		return domain.APIKey{}, false, false, nil
+	}
+	if k == nil {
+		return domain.APIKey{}, false, true, nil
+	}
+	return *k, true, true, nil
+}
+
+func (c *cacheStub) Set(ctx context.Context, hash string, k domain.APIKey) error {
+	c.entries[hash] = &k
+	return nil
+}
+
+func (c *cacheStub) SetUnknown(ctx context.Context, hash string) error {
+	c.entries[hash] = nil
+	return nil
+}
+
+func (c *cacheStub) Delete(ctx context.Context, hash string) error {
+	delete(c.entries, hash)
+	return nil
+}
+
+func (c *cacheStub) ShouldTouch(ctx context.Context, id int) bool {
+	return true
+}
+
+func newTestService() (Service, *repoStub, *cacheStub) {
+	repo := &repoStub{keys: map[int]domain.APIKey{}}
+	cache := &cacheStub{entries: map[string]*domain.APIKey{}}
+	return NewService(repo, cache, logging.Discard()), repo, cache
+}
+
+var admin = auth.Principal{Subject: "user-1", Roles: []string{auth.RoleAdmin}}
+
+func TestCreateOk(t *testing.T) {
+	s, repo, _ := newTestService()
+
+	k, err := s.Create(ctx, admin, domain.APIKey{Name: "erp sync", Scopes: []string{"products:write"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, k.ID)
+	assert.Contains(t, k.Key, k.Prefix+"_")
+	assert.Equal(t, "user-1", k.CreatedBy)
+	assert.Equal(t, hashKey(k.Key), repo.keys[1].Hash)
+}
+
+func TestCreateErrScopeNotGranted(t *testing.T) {
+	s, _, _ := newTestService()
+	creator := auth.Principal{Subject: "user-2", Roles: []string{"apikeys:admin", "orders:read"}}
+
+	_, err := s.Create(ctx, creator, domain.APIKey{Name: "erp", Scopes: []string{"orders:read", "products:write"}})
+
+	assert.ErrorIs(t, err, ErrScopeNotGranted)
+}
+
+func TestCreateErrInvalid(t *testing.T) {
+	s, _, _ := newTestService()
+	past := time.Now().Add(-time.Hour)
+
+	_, err := s.Create(ctx, admin, domain.APIKey{Scopes: []string{"orders:read"}})
+	assert.ErrorIs(t, err, ErrNameRequired)
+	_, err = s.Create(ctx, admin, domain.APIKey{Name: "erp"})
+	assert.ErrorIs(t, err, ErrScopesRequired)
+	_, err = s.Create(ctx, admin, domain.APIKey{Name: "erp", Scopes: []string{"orders:read"}, ExpiresAt: &past})
+	assert.ErrorIs(t, err, ErrExpired)
+}
+
+func TestVerifyKeyOk(t *testing.T) {
+	s, repo, _ := newTestService()
+	k, _ := s.Create(ctx, admin, domain.APIKey{Name: "erp", Scopes: []string{"orders:read"}})
+
+	p, err := s.VerifyKey(ctx, k.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, "apikey:1", p.Subject)
+	assert.Equal(t, []string{"orders:read"}, p.Roles)
+
+	// The second use is answered from the cache
+	_, err = s.VerifyKey(ctx, k.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, repo.lookups)
+	assert.Equal(t, 2, repo.touched)
+}
+
+func TestVerifyKeyErrUnknown(t *testing.T) {
+	s, repo, _ := newTestService()
+
+	_, err := s.VerifyKey(ctx, "ak_12345678_nope")
+	assert.ErrorIs(t, err, auth.ErrInvalidKey)
+	_, err = s.VerifyKey(ctx, "ak_12345678_nope")
+	assert.ErrorIs(t, err, auth.ErrInvalidKey)
+	assert.Equal(t, 1, repo.lookups)
+
+	_, err = s.VerifyKey(ctx, "not-a-key")
+	assert.ErrorIs(t, err, auth.ErrInvalidKey)
+}
+
+func TestVerifyKeyErrRevoked(t *testing.T) {
+	s, _, _ := newTestService()
+	k, _ := s.Create(ctx, admin, domain.APIKey{Name: "erp", Scopes: []string{"orders:read"}})
+	_, err := s.VerifyKey(ctx, k.Key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Revoke(ctx, k.ID))
+	_, err = s.VerifyKey(ctx, k.Key)
+	assert.ErrorIs(t, err, auth.ErrInvalidKey)
+	assert.ErrorIs(t, s.Revoke(ctx, k.ID), ErrAlreadyRevoked)
+}
+
+func TestVerifyKeyErrExpired(t *testing.T) {
+	s, repo, _ := newTestService()
+	expires := time.Now().Add(time.Hour)
+	k, _ := s.Create(ctx, admin, domain.APIKey{Name: "erp", Scopes: []string{"orders:read"}, ExpiresAt: &expires})
+	_, err := s.VerifyKey(ctx, k.Key)
+	assert.NoError(t, err)
+
+	// Expiry is checked on cached keys too
+	past := time.Now().Add(-time.Minute)
+	stored := repo.keys[k.ID]
+	stored.ExpiresAt = &past
+	repo.keys[k.ID] = stored
+	s.(*service).cache.Set(ctx, stored.Hash, stored)
+
+	_, err = s.VerifyKey(ctx, k.Key)
+	assert.ErrorIs(t, err, auth.ErrInvalidKey)
+}
@@ -0,0 +1,58 @@
+package cart
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+type Repository interface {
+	Get(ctx context.Context, id string) (domain.Cart, error)
+	Save(ctx context.Context, c domain.Cart) error
+	Delete(ctx context.Context, id string) error
+}
+
+// Carts expire after this long without changes
+const TTL = 7 * 24 * time.Hour
+
+type repository struct {
+	rd *redis.Client
+}
+
+func NewRepository(rd *redis.Client) Repository {
+	return &repository{rd: rd}
+}
+
+func (r *repository) Get(ctx context.Context, id string) (domain.Cart, error) {
+	var c domain.Cart
+	data, err := r.rd.Get(ctx, key(ctx, id)).Bytes()
+	if err == redis.Nil {
+		return c, ErrNotFound
+	}
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+func (r *repository) Save(ctx context.Context, c domain.Cart) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return r.rd.Set(ctx, key(ctx, c.ID), data, TTL).Err()
+}
+
+func (r *repository) Delete(ctx context.Context, id string) error {
+	return r.rd.Del(ctx, key(ctx, id)).Err()
+}
+
+// key keeps the carts of each tenant apart
+func key(ctx context.Context, id string) string {
+	return tenant.Key(ctx, "cart["+id+"]")
+}
@@ -0,0 +1,287 @@
+package cart
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/order"
+	"github.com/vincentconace/api-gin/internal/product"
+)
+
+// Service manages carts on behalf of a caller, the subject of an
+// authenticated request or empty for anonymous ones. Anonymous carts are
+// reachable by anyone holding their ID, the cart of a subject only by it.
+type Service interface {
+	Create(ctx context.Context) (domain.Cart, error)
+	Get(ctx context.Context, caller, id string) (domain.Cart, error)
+	SetItem(ctx context.Context, caller, id string, productID, quantity int) (domain.Cart, error)
+	RemoveItem(ctx context.Context, caller, id string, productID int) (domain.Cart, error)
+	Merge(ctx context.Context, caller, fromID, intoID string) (domain.Cart, error)
+	Checkout(ctx context.Context, caller, id string) (domain.Order, error)
+}
+
+// Issues reported on cart lines when re-validated
+const (
+	IssueUnavailable       = "unavailable"
+	IssueInsufficientStock = "insufficient_stock"
+	IssuePriceChanged      = "price_changed"
+)
+
+var (
+	ErrNotFound        = errors.New("cart not found")
+	ErrProductNotFound = errors.New("product not found")
+	ErrInvalidQuantity = errors.New("quantity must not be negative")
+	ErrOutOfStock      = errors.New("not enough stock for requested quantity")
+	ErrEmptyCart       = errors.New("cart is empty")
+	ErrInvalidCart     = errors.New("cart has unavailable items")
+	ErrAnonymous       = errors.New("merging needs an authenticated caller")
+)
+
+type service struct {
+	repo           Repository
+	productService product.Service
+	orderService   order.Service
+}
+
+func NewService(repo Repository, productService product.Service, orderService order.Service) Service {
+	return &service{repo: repo, productService: productService, orderService: orderService}
+}
+
+func (s *service) Create(ctx context.Context) (domain.Cart, error) {
+	c := domain.Cart{ID: newID(), Items: []domain.CartItem{}, Valid: true, UpdatedAt: time.Now().UTC()}
+	return c, s.repo.Save(ctx, c)
+}
+
+// Get returns the cart with every line re-validated against the current
+// product price and stock.
+func (s *service) Get(ctx context.Context, caller, id string) (domain.Cart, error) {
+	c, err := s.get(ctx, caller, id)
+	if err != nil {
+		return c, err
+	}
+	s.revalidate(ctx, &c)
+	return c, nil
+}
+
+// SetItem sets the quantity of a product in the cart, removing the line
+// when quantity is zero.
+func (s *service) SetItem(ctx context.Context, caller, id string, productID, quantity int) (domain.Cart, error) {
+	if quantity < 0 {
+		return domain.Cart{}, ErrInvalidQuantity
+	}
+	if quantity == 0 {
+		return s.RemoveItem(ctx, caller, id, productID)
+	}
+
+	c, err := s.get(ctx, caller, id)
+	if err != nil {
+		return c, err
+	}
+	p, err := s.productService.GetById(ctx, productID)
+	if err != nil {
+		return c, ErrProductNotFound
+	}
+	if err := checkStock(p, quantity); err != nil {
+		return c, err
+	}
+
+	item := domain.CartItem{ProductID: productID, Quantity: quantity}
+	if p.Price != nil {
+		item.AddedPrice = *p.Price
+	}
+	if i := indexOf(c.Items, productID); i >= 0 {
+		c.Items[i] = item
+	} else {
+		c.Items = append(c.Items, item)
+	}
+
+	if err := s.save(ctx, &c); err != nil {
+		return c, err
+	}
+	s.revalidate(ctx, &c)
+	return c, nil
+}
+
+func (s *service) RemoveItem(ctx context.Context, caller, id string, productID int) (domain.Cart, error) {
+	c, err := s.get(ctx, caller, id)
+	if err != nil {
+		return c, err
+	}
+	if i := indexOf(c.Items, productID); i >= 0 {
+		c.Items = append(c.Items[:i], c.Items[i+1:]...)
+	}
+	if err := s.save(ctx, &c); err != nil {
+		return c, err
+	}
+	s.revalidate(ctx, &c)
+	return c, nil
+}
+
+// Merge moves the lines of an anonymous cart into the cart of the caller,
+// whose ID is its subject, adding quantities for products present in both,
+// and deletes the source. The merged quantities must be in stock.
+func (s *service) Merge(ctx context.Context, caller, fromID, intoID string) (domain.Cart, error) {
+	if caller == "" {
+		return domain.Cart{}, ErrAnonymous
+	}
+	if intoID != caller {
+		return domain.Cart{}, ErrNotFound
+	}
+	from, err := s.get(ctx, caller, fromID)
+	if err != nil {
+		return domain.Cart{}, err
+	}
+	if from.Owner != "" {
+		return domain.Cart{}, ErrNotFound
+	}
+	into, err := s.get(ctx, caller, intoID)
+	if errors.Is(err, ErrNotFound) {
+		into = domain.Cart{ID: intoID}
+	} else if err != nil {
+		return domain.Cart{}, err
+	}
+	into.Owner = caller
+
+	for _, item := range from.Items {
+		i := indexOf(into.Items, item.ProductID)
+		if i < 0 {
+			into.Items = append(into.Items, item)
+			continue
+		}
+		into.Items[i].Quantity += item.Quantity
+	}
+	for _, item := range into.Items {
+		p, err := s.productService.GetById(ctx, item.ProductID)
+		if err != nil {
+			// Revalidation flags the line as unavailable
+			continue
+		}
+		if err := checkStock(p, item.Quantity); err != nil {
+			return into, err
+		}
+	}
+
+	if err := s.save(ctx, &into); err != nil {
+		return into, err
+	}
+	if err := s.repo.Delete(ctx, fromID); err != nil {
+		return into, err
+	}
+	s.revalidate(ctx, &into)
+	return into, nil
+}
+
+// Checkout turns a valid cart into a pending order and deletes the cart.
+func (s *service) Checkout(ctx context.Context, caller, id string) (domain.Order, error) {
+	c, err := s.Get(ctx, caller, id)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	if len(c.Items) == 0 {
+		return domain.Order{}, ErrEmptyCart
+	}
+	if !c.Valid {
+		return domain.Order{}, ErrInvalidCart
+	}
+
+	items := make([]domain.OrderItem, len(c.Items))
+	for i, item := range c.Items {
+		items[i] = domain.OrderItem{ProductID: item.ProductID, Quantity: item.Quantity}
+	}
+	o, err := s.orderService.Create(ctx, "cart:"+c.ID, items)
+	if err != nil {
+		return o, err
+	}
+	return o, s.repo.Delete(ctx, id)
+}
+
+// get returns the cart if the caller may use it, hiding the carts of other
+// subjects
+func (s *service) get(ctx context.Context, caller, id string) (domain.Cart, error) {
+	c, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return c, err
+	}
+	if c.Owner != "" && c.Owner != caller {
+		return domain.Cart{}, ErrNotFound
+	}
+	return c, nil
+}
+
+func checkStock(p domain.Product, quantity int) error {
+	if p.Stock == nil || *p.Stock < quantity {
+		return ErrOutOfStock
+	}
+	return nil
+}
+
+func (s *service) save(ctx context.Context, c *domain.Cart) error {
+	c.UpdatedAt = time.Now().UTC()
+	if c.Items == nil {
+		c.Items = []domain.CartItem{}
+	}
+	return s.repo.Save(ctx, *c)
+}
+
+// revalidate fills current product data on every line and flags lines
+// whose product disappeared, lacks stock or changed price since added.
+// Price changes are informative, only the other issues invalidate the cart.
+func (s *service) revalidate(ctx context.Context, c *domain.Cart) {
+	c.Total = 0
+	c.Valid = true
+	for i := range c.Items {
+		item := &c.Items[i]
+		item.Issues = nil
+
+		p, err := s.productService.GetById(ctx, item.ProductID)
+		if err != nil {
+			item.Issues = append(item.Issues, IssueUnavailable)
+			item.Available, item.UnitPrice, item.Subtotal = 0, 0, 0
+			c.Valid = false
+			continue
+		}
+
+		item.ProductCode, item.Name, item.UnitPrice, item.Available = "", "", 0, 0
+		if p.ProductCode != nil {
+			item.ProductCode = *p.ProductCode
+		}
+		if p.Name != nil {
+			item.Name = *p.Name
+		}
+		if p.Price != nil {
+			item.UnitPrice = *p.Price
+		}
+		if p.Stock != nil {
+			item.Available = *p.Stock
+		}
+
+		if item.Available < item.Quantity {
+			item.Issues = append(item.Issues, IssueInsufficientStock)
+			c.Valid = false
+		}
+		if item.UnitPrice != item.AddedPrice {
+			item.Issues = append(item.Issues, IssuePriceChanged)
+		}
+		item.Subtotal = item.UnitPrice * float32(item.Quantity)
+		c.Total += item.Subtotal
+	}
+}
+
+func indexOf(items []domain.CartItem, productID int) int {
+	for i, item := range items {
+		if item.ProductID == productID {
+			return i
+		}
+	}
+	return -1
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
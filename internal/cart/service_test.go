@@ -0,0 +1,156 @@
+package cart
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/order"
+	"github.com/vincentconace/api-gin/internal/product"
+)
+
+var ctx = context.Background()
+
+func puntInt(i int) *int {
+	return &i
+}
+
+func puntFloat(i float32) *float32 {
+	return &i
+}
+
+type repositoryStub struct {
+	carts map[string]domain.Cart
+}
+
+func (r *repositoryStub) Get(ctx context.Context, id string) (domain.Cart, error) {
+	c, ok := r.carts[id]
+	if !ok {
+		return c, ErrNotFound
+	}
+	return c, nil
+}
+
+func (r *repositoryStub) Save(ctx context.Context, c domain.Cart) error {
+	r.carts[c.ID] = c
+	return nil
+}
+
+func (r *repositoryStub) Delete(ctx context.Context, id string) error {
+	delete(r.carts, id)
+	return nil
+}
+
+type productServiceStub struct {
+	product.Service
+	products map[int]domain.Product
+}
+
+func (s *productServiceStub) GetById(ctx context.Context, id int) (domain.Product, error) {
+	p, ok := s.products[id]
+	if !ok {
+		return p, product.ErrNotFound
+	}
+	return p, nil
+}
+
+type orderServiceStub struct {
+	order.Service
+	items []domain.OrderItem
+}
+
+func (s *orderServiceStub) Create(ctx context.Context, reference string, items []domain.OrderItem) (domain.Order, error) {
+	s.items = items
+	return domain.Order{ID: 1, Reference: reference, Items: items}, nil
+}
+
+func newTestService() (Service, *productServiceStub, *orderServiceStub) {
+	products := &productServiceStub{products: map[int]domain.Product{
+		1: {ID: puntInt(1), Price: puntFloat(10), Stock: puntInt(5)},
+		2: {ID: puntInt(2), Price: puntFloat(3), Stock: puntInt(1)},
+	}}
+	orders := &orderServiceStub{}
+	return NewService(&repositoryStub{carts: map[string]domain.Cart{}}, products, orders), products, orders
+}
+
+func TestSetItemErrOutOfStock(t *testing.T) {
+	service, _, _ := newTestService()
+	c, _ := service.Create(ctx)
+
+	_, err := service.SetItem(ctx, "", c.ID, 2, 3)
+
+	assert.ErrorIs(t, err, ErrOutOfStock)
+}
+
+func TestGetRevalidatesPriceAndStock(t *testing.T) {
+	service, products, _ := newTestService()
+	c, _ := service.Create(ctx)
+	_, err := service.SetItem(ctx, "", c.ID, 1, 2)
+	assert.NoError(t, err)
+
+	products.products[1] = domain.Product{ID: puntInt(1), Price: puntFloat(12), Stock: puntInt(1)}
+	c, err = service.Get(ctx, "", c.ID)
+
+	assert.NoError(t, err)
+	assert.False(t, c.Valid)
+	assert.Equal(t, float32(24), c.Total)
+	assert.Equal(t, []string{IssueInsufficientStock, IssuePriceChanged}, c.Items[0].Issues)
+}
+
+func TestMergeOk(t *testing.T) {
+	carts, _, _ := newTestService()
+	anonymous, _ := carts.Create(ctx)
+	carts.SetItem(ctx, "", anonymous.ID, 1, 1)
+	carts.SetItem(ctx, "", anonymous.ID, 2, 1)
+	carts.(*service).repo.Save(ctx, domain.Cart{ID: "user:7", Owner: "user:7"})
+	carts.SetItem(ctx, "user:7", "user:7", 1, 2)
+
+	merged, err := carts.Merge(ctx, "user:7", anonymous.ID, "user:7")
+
+	assert.NoError(t, err)
+	assert.Len(t, merged.Items, 2)
+	assert.Equal(t, 3, merged.Items[0].Quantity)
+	_, err = carts.Get(ctx, "", anonymous.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = carts.Get(ctx, "", "user:7")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMergeErrOtherSubject(t *testing.T) {
+	carts, _, _ := newTestService()
+	anonymous, _ := carts.Create(ctx)
+
+	_, err := carts.Merge(ctx, "user:7", anonymous.ID, "user:8")
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = carts.Get(ctx, "user:8", "user:8")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMergeErrOutOfStock(t *testing.T) {
+	carts, _, _ := newTestService()
+	anonymous, _ := carts.Create(ctx)
+	carts.SetItem(ctx, "", anonymous.ID, 2, 1)
+	carts.(*service).repo.Save(ctx, domain.Cart{ID: "user:7", Owner: "user:7", Items: []domain.CartItem{{ProductID: 2, Quantity: 1}}})
+
+	_, err := carts.Merge(ctx, "user:7", anonymous.ID, "user:7")
+
+	assert.ErrorIs(t, err, ErrOutOfStock)
+	_, err = carts.Get(ctx, "", anonymous.ID)
+	assert.NoError(t, err)
+}
+
+func TestCheckoutOk(t *testing.T) {
+	service, _, orders := newTestService()
+	c, _ := service.Create(ctx)
+	service.SetItem(ctx, "", c.ID, 1, 2)
+
+	o, err := service.Checkout(ctx, "", c.ID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "cart:"+c.ID, o.Reference)
+	assert.Equal(t, []domain.OrderItem{{ProductID: 1, Quantity: 2}}, orders.items)
+	_, err = service.Get(ctx, "", c.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+type ReorderSetting struct {
+	ProductID       int `json:"product_id"`
+	ReorderPoint    int `json:"reorder_point"`
+	ReorderQuantity int `json:"reorder_quantity"`
+}
+
+type StockAlert struct {
+	ID              int        `json:"id"`
+	Tenant          string     `json:"-"`
+	ProductID       int        `json:"product_id"`
+	ProductCode     string     `json:"product_code"`
+	Name            string     `json:"name"`
+	Stock           int        `json:"stock"`
+	ReorderPoint    int        `json:"reorder_point"`
+	ReorderQuantity int        `json:"reorder_quantity"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+}
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+type Cart struct {
+	ID        string     `json:"id"`
+	Owner     string     `json:"owner,omitempty"`
+	Items     []CartItem `json:"items"`
+	Total     float32    `json:"total"`
+	Valid     bool       `json:"valid"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type CartItem struct {
+	ProductID   int      `json:"product_id"`
+	ProductCode string   `json:"product_code"`
+	Name        string   `json:"name"`
+	Quantity    int      `json:"quantity"`
+	AddedPrice  float32  `json:"added_price"`
+	UnitPrice   float32  `json:"unit_price"`
+	Subtotal    float32  `json:"subtotal"`
+	Available   int      `json:"available"`
+	Issues      []string `json:"issues,omitempty"`
+}
@@ -0,0 +1,22 @@
+package domain
+
+type ProductImport struct {
+	ID        string             `json:"id"`
+	DryRun    bool               `json:"dry_run"`
+	Mode      string             `json:"mode"`
+	TotalRows int                `json:"total_rows"`
+	Creates   int                `json:"creates"`
+	Updates   int                `json:"updates"`
+	Failed    int                `json:"failed"`
+	Rows      []ProductImportRow `json:"rows"`
+	ReportURL string             `json:"report_url,omitempty"`
+}
+
+type ProductImportRow struct {
+	Row         int      `json:"row"`
+	ProductCode string   `json:"product_code"`
+	Op          string   `json:"op"`
+	Status      string   `json:"status"`
+	ID          *int     `json:"id,omitempty"`
+	Errors      []string `json:"errors,omitempty"`
+}
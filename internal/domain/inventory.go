@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+type StockMovement struct {
+	ID          int       `json:"id"`
+	ProductID   int       `json:"product_id"`
+	WarehouseID *int      `json:"warehouse_id,omitempty"`
+	Delta       int       `json:"delta"`
+	Reason      string    `json:"reason"`
+	Reference   string    `json:"reference,omitempty"`
+	StockAfter  int       `json:"stock_after"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Reservation struct {
+	ID        int       `json:"id"`
+	Tenant    string    `json:"-"`
+	ProductID int       `json:"product_id"`
+	Quantity  int       `json:"quantity"`
+	Reference string    `json:"reference,omitempty"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Status      string          `json:"status"`
+	Tenant      string          `json:"tenant,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Progress    int             `json:"progress"`
+	ResultURL   string          `json:"result_url,omitempty"`
+	Errors      []string        `json:"errors,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	// Trace carries the trace context of the request that enqueued it
+	Trace map[string]string `json:"trace,omitempty"`
+}
@@ -0,0 +1,14 @@
+package domain
+
+type Media struct {
+	ID          int               `json:"id"`
+	ProductID   int               `json:"product_id"`
+	StorageKey  string            `json:"-"`
+	FileName    string            `json:"file_name"`
+	ContentType string            `json:"content_type"`
+	Size        int64             `json:"size"`
+	Position    int               `json:"position"`
+	IsPrimary   bool              `json:"is_primary"`
+	URL         string            `json:"url"`
+	Thumbnails  map[string]string `json:"thumbnails,omitempty"`
+}
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+type Order struct {
+	ID        int         `json:"id"`
+	Reference string      `json:"reference,omitempty"`
+	Status    string      `json:"status"`
+	Total     float32     `json:"total"`
+	Items     []OrderItem `json:"items,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+type OrderItem struct {
+	ID          int     `json:"id"`
+	OrderID     int     `json:"order_id"`
+	ProductID   int     `json:"product_id"`
+	ProductCode string  `json:"product_code"`
+	Name        string  `json:"name"`
+	UnitPrice   float32 `json:"unit_price"`
+	Quantity    int     `json:"quantity"`
+	Subtotal    float32 `json:"subtotal"`
+}
@@ -7,4 +7,26 @@ type Product struct {
 	Description *string  `json:"description"`
 	Price       *float32 `json:"price"`
 	Stock       *int     `json:"stock"`
+	Media       []Media  `json:"media,omitempty"`
+}
+
+// ProductTotals counts the products of one tenant
+type ProductTotals struct {
+	Tenant     string
+	Products   int
+	OutOfStock int
+}
+
+type ProductBatchOperation struct {
+	Op      string   `json:"op"`
+	ID      *int     `json:"id,omitempty"`
+	Product *Product `json:"product,omitempty"`
+}
+
+type ProductBatchResult struct {
+	Index  int      `json:"index"`
+	Op     string   `json:"op"`
+	Status string   `json:"status"`
+	ID     *int     `json:"id,omitempty"`
+	Errors []string `json:"errors,omitempty"`
 }
@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+type User struct {
+	ID           int        `json:"id"`
+	Email        string     `json:"email"`
+	Name         string     `json:"name"`
+	Roles        []string   `json:"roles"`
+	Tenant       string     `json:"tenant"`
+	PasswordHash string     `json:"-"`
+	FailedLogins int        `json:"-"`
+	LockedUntil  *time.Time `json:"locked_until,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
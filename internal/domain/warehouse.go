@@ -0,0 +1,34 @@
+package domain
+
+import "time"
+
+type Warehouse struct {
+	ID      int    `json:"id"`
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+type StockLevel struct {
+	WarehouseID   int    `json:"warehouse_id"`
+	WarehouseCode string `json:"warehouse_code"`
+	WarehouseName string `json:"warehouse_name"`
+	Quantity      int    `json:"quantity"`
+}
+
+type ProductInventory struct {
+	ProductID int          `json:"product_id"`
+	OnHand    int          `json:"on_hand"`
+	Reserved  int          `json:"reserved"`
+	Available int          `json:"available"`
+	Locations []StockLevel `json:"locations"`
+}
+
+type Transfer struct {
+	ID              int       `json:"id"`
+	ProductID       int       `json:"product_id"`
+	FromWarehouseID int       `json:"from_warehouse_id"`
+	ToWarehouseID   int       `json:"to_warehouse_id"`
+	Quantity        int       `json:"quantity"`
+	CreatedAt       time.Time `json:"created_at"`
+}
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Webhook struct {
+	ID       int      `json:"id"`
+	URL      string   `json:"url"`
+	Events   []string `json:"events"`
+	Secret   string   `json:"secret,omitempty"`
+	Active   bool     `json:"active"`
+	Failures int      `json:"consecutive_failures"`
+	// DisabledAt is set when repeated failures turned the webhook off
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID         int             `json:"id"`
+	WebhookID  int             `json:"webhook_id"`
+	EventID    int64           `json:"event_id"`
+	EventType  string          `json:"event_type"`
+	Attempt    int             `json:"attempt"`
+	StatusCode int             `json:"status_code,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	DurationMs int64           `json:"duration_ms"`
+	Payload    json.RawMessage `json:"payload"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
@@ -0,0 +1,114 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+)
+
+// Writer encodes products one at a time so exports never hold the whole
+// catalog in memory. Close must be called to complete the output.
+type Writer interface {
+	Write(p domain.Product) error
+	Close() error
+}
+
+type Format struct {
+	ContentType string
+	Extension   string
+	// Compressible is false for formats that are already compressed
+	Compressible bool
+}
+
+// Export formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatXLSX  = "xlsx"
+)
+
+var Formats = map[string]Format{
+	FormatCSV:   {ContentType: "text/csv; charset=utf-8", Extension: ".csv", Compressible: true},
+	FormatJSONL: {ContentType: "application/x-ndjson", Extension: ".jsonl", Compressible: true},
+	FormatXLSX:  {ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Extension: ".xlsx"},
+}
+
+var ErrUnsupportedFormat = errors.New("format must be csv, jsonl or xlsx")
+
+// Columns of the tabular formats, readable back by the importer
+var columns = []string{"id", "product_code", "name", "description", "price", "stock"}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return &jsonlWriter{enc: enc}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (Writer, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: cw}, nil
+}
+
+func (c *csvWriter) Write(p domain.Product) error {
+	return c.w.Write([]string{
+		formatInt(p.ID), formatString(p.ProductCode), formatString(p.Name),
+		formatString(p.Description), formatFloat(p.Price), formatInt(p.Stock),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(p domain.Product) error {
+	return j.enc.Encode(p)
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+func formatString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
+
+func formatFloat(f *float32) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(float64(*f), 'f', -1, 32)
+}
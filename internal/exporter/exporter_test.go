@@ -0,0 +1,92 @@
+package exporter
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+)
+
+func puntInt(i int) *int {
+	return &i
+}
+
+func puntFloat(i float32) *float32 {
+	return &i
+}
+
+func puntStr(i string) *string {
+	return &i
+}
+
+var productsMock = []domain.Product{
+	{
+		ID:          puntInt(1),
+		ProductCode: puntStr("PRO001"),
+		Name:        puntStr("Product, \"one\""),
+		Description: puntStr("A & B"),
+		Price:       puntFloat(1.99),
+		Stock:       puntInt(10),
+	},
+	{
+		ID:          puntInt(2),
+		ProductCode: puntStr("PRO002"),
+		Name:        puntStr("Product 2"),
+	},
+}
+
+func exportAll(t *testing.T, format string) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf)
+	assert.NoError(t, err)
+	for _, p := range productsMock {
+		assert.NoError(t, w.Write(p))
+	}
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestCSVOk(t *testing.T) {
+	out := exportAll(t, FormatCSV)
+
+	assert.Equal(t, "id,product_code,name,description,price,stock\n"+
+		"1,PRO001,\"Product, \"\"one\"\"\",A & B,1.99,10\n"+
+		"2,PRO002,Product 2,,,\n", string(out))
+}
+
+func TestJSONLOk(t *testing.T) {
+	out := exportAll(t, FormatJSONL)
+
+	assert.Equal(t, `{"id":1,"product_code":"PRO001","name":"Product, \"one\"","description":"A & B","price":1.99,"stock":10}`+"\n"+
+		`{"id":2,"product_code":"PRO002","name":"Product 2","description":null,"price":null,"stock":null}`+"\n", string(out))
+}
+
+func TestXLSXOk(t *testing.T) {
+	out := exportAll(t, FormatXLSX)
+
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	assert.NoError(t, err)
+	var sheet []byte
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			assert.NoError(t, err)
+			sheet, _ = io.ReadAll(rc)
+			rc.Close()
+		}
+	}
+	assert.Len(t, zr.File, 5)
+	assert.Contains(t, string(sheet), `<row><c><v>1</v></c><c t="inlineStr"><is><t xml:space="preserve">PRO001</t></is></c>`)
+	assert.Contains(t, string(sheet), `A &amp; B`)
+	assert.Contains(t, string(sheet), `<c><v>1.99</v></c><c><v>10</v></c></row>`)
+	assert.Contains(t, string(sheet), `<c/><c/><c/></row></sheetData></worksheet>`)
+}
+
+func TestNewWriterErrUnsupportedFormat(t *testing.T) {
+	_, err := NewWriter("pdf", io.Discard)
+
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
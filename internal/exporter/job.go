@@ -0,0 +1,56 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/job"
+	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/pkg/blob"
+)
+
+const JobType = "product_export"
+
+type JobPayload struct {
+	Format string `json:"format"`
+}
+
+// JobHandler exports the catalog to the blob store, streaming rows into the
+// upload, and links the stored file as the job result.
+func JobHandler(productService product.Service, store blob.Store) job.Handler {
+	return func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		var payload JobPayload
+		if err := json.Unmarshal(j.Payload, &payload); err != nil {
+			return "", job.Permanent(job.ErrInvalidPayload)
+		}
+		format, ok := Formats[payload.Format]
+		if !ok {
+			return "", job.Permanent(ErrUnsupportedFormat)
+		}
+
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(export(ctx, payload.Format, pw, productService))
+		}()
+
+		key := "exports/" + j.ID + format.Extension
+		if err := store.Put(ctx, key, pr, format.ContentType); err != nil {
+			pr.CloseWithError(err)
+			return "", err
+		}
+		return store.URL(key), nil
+	}
+}
+
+func export(ctx context.Context, format string, w io.Writer, productService product.Service) error {
+	out, err := NewWriter(format, w)
+	if err != nil {
+		return err
+	}
+	if err := productService.Stream(ctx, out.Write); err != nil {
+		return err
+	}
+	return out.Close()
+}
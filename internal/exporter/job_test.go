@@ -0,0 +1,42 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/pkg/blob"
+)
+
+type productServiceStub struct {
+	product.Service
+}
+
+func (productServiceStub) Stream(ctx context.Context, fn func(p domain.Product) error) error {
+	for _, p := range productsMock {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestJobHandlerOk(t *testing.T) {
+	store, err := blob.NewLocalStore(t.TempDir(), "/media")
+	assert.NoError(t, err)
+	payload, _ := json.Marshal(JobPayload{Format: FormatJSONL})
+
+	url, err := JobHandler(productServiceStub{}, store)(context.Background(), domain.Job{ID: "abc", Payload: payload}, func(int) {})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/media/exports/abc.jsonl", url)
+	rc, err := store.Get(context.Background(), "exports/abc.jsonl")
+	assert.NoError(t, err)
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	assert.Equal(t, string(exportAll(t, FormatJSONL)), string(data))
+}
@@ -0,0 +1,97 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/job"
+	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/pkg/blob"
+)
+
+const JobType = "product_import"
+
+type jobPayload struct {
+	Key      string  `json:"key"`
+	FileName string  `json:"file_name"`
+	Options  Options `json:"options"`
+}
+
+func (s *service) Enqueue(ctx context.Context, fileName string, r io.Reader, opts Options) (domain.Job, error) {
+	if opts.Mode != product.BatchAtomic && opts.Mode != product.BatchBestEffort {
+		return domain.Job{}, product.ErrInvalidBatchMode
+	}
+	data, err := io.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return domain.Job{}, err
+	}
+	if len(data) > MaxSize {
+		return domain.Job{}, ErrTooLarge
+	}
+
+	key := "imports/uploads/" + newID() + path.Ext(fileName)
+	if err := s.store.Put(ctx, key, bytes.NewReader(data), "application/octet-stream"); err != nil {
+		return domain.Job{}, err
+	}
+	return s.jobs.Enqueue(ctx, JobType, jobPayload{Key: key, FileName: path.Base(fileName), Options: opts})
+}
+
+// JobHandler imports an uploaded file stored by Enqueue. The full import
+// result is stored as JSON and linked as the job result.
+func JobHandler(s Service, store blob.Store) job.Handler {
+	return func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		var payload jobPayload
+		if err := json.Unmarshal(j.Payload, &payload); err != nil {
+			return "", job.Permanent(job.ErrInvalidPayload)
+		}
+		rc, err := store.Get(ctx, payload.Key)
+		if errors.Is(err, blob.ErrNotFound) {
+			return "", job.Permanent(err)
+		}
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+
+		result, err := s.Import(ctx, payload.FileName, rc, payload.Options)
+		if err != nil {
+			if isInputError(err) {
+				return "", job.Permanent(err)
+			}
+			return "", err
+		}
+		progress(90)
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			return "", err
+		}
+		key := "imports/" + result.ID + ".json"
+		if err := store.Put(ctx, key, bytes.NewReader(data), "application/json"); err != nil {
+			return "", err
+		}
+		if err := store.Delete(ctx, payload.Key); err != nil && !errors.Is(err, blob.ErrNotFound) {
+			return "", err
+		}
+		return store.URL(key), nil
+	}
+}
+
+// isInputError reports errors caused by the file or options, which fail
+// the same way on every attempt
+func isInputError(err error) bool {
+	for _, target := range []error{
+		ErrTooLarge, ErrUnsupportedFormat, ErrInvalidFile, ErrEmptyFile, ErrInvalidMapping,
+		ErrMissingCodeColumn, product.ErrInvalidBatchMode, product.ErrBatchTooLarge,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,356 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/job"
+	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/pkg/blob"
+)
+
+type Service interface {
+	Import(ctx context.Context, fileName string, r io.Reader, opts Options) (domain.ProductImport, error)
+	// Enqueue stores the file and runs the import as a background job
+	Enqueue(ctx context.Context, fileName string, r io.Reader, opts Options) (domain.Job, error)
+}
+
+type Options struct {
+	DryRun bool   `json:"dry_run"`
+	Mode   string `json:"mode"`
+	// Mapping maps spreadsheet headers to product fields, overriding the
+	// default headers
+	Mapping map[string]string `json:"mapping,omitempty"`
+}
+
+// Product fields a column can be mapped to
+const (
+	FieldProductCode = "product_code"
+	FieldName        = "name"
+	FieldDescription = "description"
+	FieldPrice       = "price"
+	FieldStock       = "stock"
+)
+
+// Maximum size in bytes of an uploaded file
+const MaxSize = 10 << 20
+
+// Maximum size of a single decompressed XLSX part
+const maxUncompressed = 100 << 20
+
+var (
+	ErrTooLarge          = fmt.Errorf("file exceeds the maximum size of %d MB", MaxSize>>20)
+	ErrUnsupportedFormat = errors.New("file must be CSV or XLSX")
+	ErrInvalidFile       = errors.New("file could not be read")
+	ErrEmptyFile         = errors.New("file has no product rows")
+	ErrInvalidMapping    = errors.New("mapping targets an unknown product field")
+	ErrMissingCodeColumn = errors.New("no column is mapped to product_code")
+)
+
+// Headers recognised without an explicit mapping
+var defaultHeaders = map[string]string{
+	"product_code": FieldProductCode,
+	"code":         FieldProductCode,
+	"sku":          FieldProductCode,
+	"name":         FieldName,
+	"description":  FieldDescription,
+	"price":        FieldPrice,
+	"stock":        FieldStock,
+	"quantity":     FieldStock,
+}
+
+type row struct {
+	number int
+	cells  []string
+}
+
+type service struct {
+	productService product.Service
+	productRepo    product.Repository
+	store          blob.Store
+	jobs           job.Service
+}
+
+func NewService(productService product.Service, productRepo product.Repository, store blob.Store, jobs job.Service) Service {
+	return &service{productService: productService, productRepo: productRepo, store: store, jobs: jobs}
+}
+
+// Import reads products from a CSV or XLSX file and creates or updates
+// them keyed on product code, using the product batch rules. With DryRun
+// nothing is written and rows report what would happen. When any row
+// fails, a CSV error report is stored and its URL returned.
+func (s *service) Import(ctx context.Context, fileName string, r io.Reader, opts Options) (domain.ProductImport, error) {
+	result := domain.ProductImport{ID: newID(), DryRun: opts.DryRun, Mode: opts.Mode}
+	if opts.Mode != product.BatchAtomic && opts.Mode != product.BatchBestEffort {
+		return result, product.ErrInvalidBatchMode
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return result, err
+	}
+	if len(data) > MaxSize {
+		return result, ErrTooLarge
+	}
+	rows, err := readRows(fileName, data)
+	if err != nil {
+		return result, err
+	}
+	if len(rows) < 2 {
+		return result, ErrEmptyFile
+	}
+	columns, err := mapColumns(rows[0].cells, opts.Mapping)
+	if err != nil {
+		return result, err
+	}
+
+	var products []domain.Product
+	for _, rw := range rows[1:] {
+		if isEmpty(rw.cells) {
+			continue
+		}
+		p, errs := parseRow(rw.cells, columns)
+		line := domain.ProductImportRow{Row: rw.number, Errors: errs}
+		if p.ProductCode != nil {
+			line.ProductCode = *p.ProductCode
+		}
+		result.Rows = append(result.Rows, line)
+		products = append(products, p)
+	}
+	if len(result.Rows) == 0 {
+		return result, ErrEmptyFile
+	}
+	if len(result.Rows) > product.MaxBatchOperations {
+		return result, product.ErrBatchTooLarge
+	}
+
+	if err := s.run(ctx, &result, products); err != nil {
+		return result, err
+	}
+
+	result.TotalRows = len(result.Rows)
+	for _, line := range result.Rows {
+		switch {
+		case line.Status == product.StatusFailed:
+			result.Failed++
+		case line.Status == product.StatusSkipped:
+		case line.Op == product.OpCreate:
+			result.Creates++
+		case line.Op == product.OpUpdate:
+			result.Updates++
+		}
+	}
+	if result.Failed > 0 {
+		key := "imports/" + result.ID + "-errors.csv"
+		if err := s.store.Put(ctx, key, bytes.NewReader(errorReport(result.Rows)), "text/csv"); err != nil {
+			return result, err
+		}
+		result.ReportURL = s.store.URL(key)
+	}
+	return result, nil
+}
+
+// run turns the parsed rows into batch operations, creating products whose
+// code is unknown and updating the others, and copies the batch results
+// back onto the rows.
+func (s *service) run(ctx context.Context, result *domain.ProductImport, products []domain.Product) error {
+	var codes []string
+	for i, line := range result.Rows {
+		if len(line.Errors) == 0 && products[i].ProductCode != nil {
+			codes = append(codes, *products[i].ProductCode)
+		}
+	}
+	inUse, err := s.productRepo.CodesInUse(ctx, codes)
+	if err != nil {
+		return err
+	}
+
+	var ops []domain.ProductBatchOperation
+	var index []int
+	parseFailed := false
+	for i := range result.Rows {
+		line := &result.Rows[i]
+		if len(line.Errors) > 0 {
+			line.Status = product.StatusFailed
+			parseFailed = true
+			continue
+		}
+		op := domain.ProductBatchOperation{Op: product.OpCreate, Product: &products[i]}
+		if id, ok := inUse[line.ProductCode]; ok {
+			op.Op, op.ID = product.OpUpdate, &id
+		}
+		line.Op = op.Op
+		ops = append(ops, op)
+		index = append(index, i)
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	var batch []domain.ProductBatchResult
+	// Rows that failed to parse never reach the batch, so an atomic import
+	// with such rows must not write the others
+	if result.DryRun || (result.Mode == product.BatchAtomic && parseFailed) {
+		batch, err = s.productService.ValidateBatch(ctx, ops)
+	} else {
+		batch, err = s.productService.Batch(ctx, result.Mode, ops)
+	}
+	if err != nil {
+		return err
+	}
+
+	for n, res := range batch {
+		line := &result.Rows[index[n]]
+		line.Status, line.ID, line.Errors = res.Status, res.ID, res.Errors
+		if !result.DryRun && res.Status == product.StatusValid {
+			line.Status = product.StatusSkipped
+		}
+	}
+	return nil
+}
+
+func readRows(fileName string, data []byte) ([]row, error) {
+	ext := strings.ToLower(path.Ext(fileName))
+	switch {
+	case ext == ".xlsx" || bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return readXLSX(data)
+	case ext == ".csv" || ext == ".txt" || ext == "":
+		return readCSV(data)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+func readCSV(data []byte) ([]row, error) {
+	cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var rows []row
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidFile, err)
+		}
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, row{number: line, cells: record})
+	}
+}
+
+// mapColumns returns the product field of each column, empty for columns
+// that are not imported.
+func mapColumns(header []string, mapping map[string]string) ([]string, error) {
+	custom := make(map[string]string, len(mapping))
+	for h, field := range mapping {
+		field = normalize(field)
+		switch field {
+		case FieldProductCode, FieldName, FieldDescription, FieldPrice, FieldStock:
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMapping, field)
+		}
+		custom[normalize(h)] = field
+	}
+
+	columns := make([]string, len(header))
+	hasCode := false
+	for i, h := range header {
+		field, ok := custom[normalize(h)]
+		if !ok {
+			field = defaultHeaders[normalize(h)]
+		}
+		columns[i] = field
+		hasCode = hasCode || field == FieldProductCode
+	}
+	if !hasCode {
+		return nil, ErrMissingCodeColumn
+	}
+	return columns, nil
+}
+
+// parseRow builds a product from the mapped cells. Empty cells stay nil so
+// the batch validation reports them as required.
+func parseRow(cells, columns []string) (domain.Product, []string) {
+	var p domain.Product
+	var errs []string
+	for i, field := range columns {
+		if field == "" || i >= len(cells) {
+			continue
+		}
+		value := strings.TrimSpace(cells[i])
+		if value == "" {
+			continue
+		}
+		switch field {
+		case FieldProductCode:
+			p.ProductCode = &value
+		case FieldName:
+			p.Name = &value
+		case FieldDescription:
+			p.Description = &value
+		case FieldPrice:
+			price, err := strconv.ParseFloat(value, 32)
+			if err != nil {
+				errs = append(errs, "price must be a number")
+				continue
+			}
+			v := float32(price)
+			p.Price = &v
+		case FieldStock:
+			// Spreadsheets may store whole numbers as floats
+			stock, err := strconv.ParseFloat(value, 64)
+			if err != nil || stock != math.Trunc(stock) {
+				errs = append(errs, "stock must be a whole number")
+				continue
+			}
+			v := int(stock)
+			p.Stock = &v
+		}
+	}
+	return p, errs
+}
+
+func errorReport(rows []domain.ProductImportRow) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"row", "product_code", "op", "errors"})
+	for _, line := range rows {
+		if line.Status != product.StatusFailed {
+			continue
+		}
+		w.Write([]string{strconv.Itoa(line.Row), line.ProductCode, line.Op, strings.Join(line.Errors, "; ")})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+func normalize(s string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(s)), " ", "_")
+}
+
+func isEmpty(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,218 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/job"
+	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/pkg/blob"
+	"github.com/vincentconace/api-gin/pkg/logging"
+)
+
+var ctx = context.Background()
+
+// productRepoStub knows a single product, PRO001 with id 1
+type productRepoStub struct {
+	product.Repository
+	saved   []domain.Product
+	updated []domain.Product
+}
+
+func (r *productRepoStub) CodesInUse(ctx context.Context, codes []string) (map[string]int, error) {
+	inUse := map[string]int{}
+	for _, code := range codes {
+		if code == "PRO001" {
+			inUse[code] = 1
+		}
+	}
+	return inUse, nil
+}
+
+func (r *productRepoStub) GetByIds(ctx context.Context, ids []int) (map[int]domain.Product, error) {
+	found := map[int]domain.Product{}
+	for _, id := range ids {
+		if id == 1 {
+			found[id] = domain.Product{ID: &id}
+		}
+	}
+	return found, nil
+}
+
+func (r *productRepoStub) SaveBatch(ctx context.Context, ps []domain.Product) ([]int, error) {
+	ids := make([]int, len(ps))
+	for i := range ps {
+		ids[i] = 100 + len(r.saved)
+		r.saved = append(r.saved, ps[i])
+	}
+	return ids, nil
+}
+
+func (r *productRepoStub) UpdateBatch(ctx context.Context, ps []domain.Product) error {
+	r.updated = append(r.updated, ps...)
+	return nil
+}
+
+func (r *productRepoStub) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func newTestService(t *testing.T) (Service, *productRepoStub, blob.Store) {
+	store, err := blob.NewLocalStore(t.TempDir(), "/media")
+	assert.NoError(t, err)
+	repo := &productRepoStub{}
+	jobs := job.NewService(job.NewMemoryRepository(), logging.Discard())
+	service := NewService(product.NewService(repo), repo, store, jobs)
+	jobs.Register(JobType, JobHandler(service, store))
+	return service, repo, store
+}
+
+const productsCSV = "SKU,Name,Description,Price,Stock\n" +
+	"PRO001,Product 1,First,1.50,10\n" +
+	"PRO002,Product 2,Second,2.50,20\n" +
+	"\n" +
+	"PRO003,Product 3,Third,abc,5\n"
+
+func TestImportDryRunOk(t *testing.T) {
+	service, repo, _ := newTestService(t)
+
+	result, err := service.Import(ctx, "products.csv", strings.NewReader(productsCSV), Options{DryRun: true, Mode: product.BatchBestEffort})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.TotalRows)
+	assert.Equal(t, 1, result.Creates)
+	assert.Equal(t, 1, result.Updates)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, product.OpUpdate, result.Rows[0].Op)
+	assert.Equal(t, product.StatusValid, result.Rows[0].Status)
+	assert.Equal(t, product.OpCreate, result.Rows[1].Op)
+	assert.Equal(t, 5, result.Rows[2].Row)
+	assert.Equal(t, []string{"price must be a number"}, result.Rows[2].Errors)
+	assert.Empty(t, repo.saved)
+	assert.Empty(t, repo.updated)
+}
+
+func TestImportBestEffortOk(t *testing.T) {
+	service, repo, store := newTestService(t)
+
+	result, err := service.Import(ctx, "products.csv", strings.NewReader(productsCSV), Options{Mode: product.BatchBestEffort})
+
+	assert.NoError(t, err)
+	assert.Equal(t, product.StatusUpdated, result.Rows[0].Status)
+	assert.Equal(t, product.StatusCreated, result.Rows[1].Status)
+	assert.Equal(t, 100, *result.Rows[1].ID)
+	assert.Equal(t, product.StatusFailed, result.Rows[2].Status)
+	assert.Len(t, repo.saved, 1)
+	assert.Len(t, repo.updated, 1)
+
+	assert.Equal(t, "/media/imports/"+result.ID+"-errors.csv", result.ReportURL)
+	rc, err := store.Get(ctx, "imports/"+result.ID+"-errors.csv")
+	assert.NoError(t, err)
+	defer rc.Close()
+	report, _ := io.ReadAll(rc)
+	assert.Equal(t, "row,product_code,op,errors\n5,PRO003,,price must be a number\n", string(report))
+}
+
+func TestImportAtomicErrSkipsValidRows(t *testing.T) {
+	service, repo, _ := newTestService(t)
+
+	result, err := service.Import(ctx, "products.csv", strings.NewReader(productsCSV), Options{Mode: product.BatchAtomic})
+
+	assert.NoError(t, err)
+	assert.Equal(t, product.StatusSkipped, result.Rows[0].Status)
+	assert.Equal(t, product.StatusSkipped, result.Rows[1].Status)
+	assert.Equal(t, 0, result.Creates)
+	assert.Empty(t, repo.saved)
+}
+
+func TestImportXLSXWithMappingOk(t *testing.T) {
+	service, repo, _ := newTestService(t)
+	data := xlsxFile(t, `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="inlineStr"><is><t>Title</t></is></c><c r="C1" t="s"><v>1</v></c><c r="D1" t="s"><v>2</v></c><c r="E1" t="s"><v>3</v></c></row>`+
+		`<row r="2"><c r="A2" t="s"><v>4</v></c><c r="B2" t="inlineStr"><is><r><t>New </t></r><r><t>product</t></r></is></c><c r="C2" t="inlineStr"><is><t>Desc</t></is></c><c r="D2"><v>3.25</v></c><c r="E2"><v>7</v></c></row>`,
+		[]string{"Reference", "Description", "Price", "Stock", "PRO009"})
+
+	result, err := service.Import(ctx, "catalog.xlsx", bytes.NewReader(data), Options{
+		Mode:    product.BatchAtomic,
+		Mapping: map[string]string{"Reference": "product_code", "Title": "name"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Creates)
+	assert.Equal(t, 2, result.Rows[0].Row)
+	assert.Len(t, repo.saved, 1)
+	assert.Equal(t, "New product", *repo.saved[0].Name)
+	assert.Equal(t, float32(3.25), *repo.saved[0].Price)
+	assert.Equal(t, 7, *repo.saved[0].Stock)
+}
+
+func TestImportXLSXErrColumnPastXFD(t *testing.T) {
+	service, _, _ := newTestService(t)
+	data := xlsxFile(t, `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="XFE1" t="inlineStr"><is><t>Name</t></is></c></row>`,
+		[]string{"product_code"})
+
+	_, err := service.Import(ctx, "catalog.xlsx", bytes.NewReader(data), Options{Mode: product.BatchAtomic})
+
+	assert.ErrorIs(t, err, ErrInvalidFile)
+}
+
+func TestImportErrMissingCodeColumn(t *testing.T) {
+	service, _, _ := newTestService(t)
+
+	_, err := service.Import(ctx, "products.csv", strings.NewReader("Name,Price\nProduct,1\n"), Options{Mode: product.BatchAtomic})
+
+	assert.ErrorIs(t, err, ErrMissingCodeColumn)
+}
+
+func TestImportErrUnsupportedFormat(t *testing.T) {
+	service, _, _ := newTestService(t)
+
+	_, err := service.Import(ctx, "products.json", strings.NewReader("[]"), Options{Mode: product.BatchAtomic})
+
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+// xlsxFile builds a minimal workbook whose first sheet holds rows
+func xlsxFile(t *testing.T, rows string, shared []string) []byte {
+	var sst strings.Builder
+	for _, s := range shared {
+		sst.WriteString("<si><t>" + s + "</t></si>")
+	}
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Products" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":     `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` + sst.String() + `</sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + rows + `</sheetData></worksheet>`,
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestEnqueueAndRunJobOk(t *testing.T) {
+	service, repo, store := newTestService(t)
+
+	j, err := service.Enqueue(ctx, "products.csv", strings.NewReader(productsCSV), Options{Mode: product.BatchBestEffort})
+	assert.NoError(t, err)
+	assert.Equal(t, JobType, j.Type)
+
+	url, err := JobHandler(service, store)(ctx, j, func(int) {})
+
+	assert.NoError(t, err)
+	assert.Len(t, repo.saved, 1)
+	assert.Regexp(t, "^/media/imports/[0-9a-f]+\\.json$", url)
+}
@@ -0,0 +1,450 @@
+package inventory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/outbox"
+	"github.com/vincentconace/api-gin/pkg/db"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+type Repository interface {
+	Adjust(ctx context.Context, productID, warehouseID, delta int, reason, reference string) (domain.StockMovement, error)
+	Ledger(ctx context.Context, productID int) ([]domain.StockMovement, error)
+	Reserve(ctx context.Context, r domain.Reservation) (domain.Reservation, error)
+	GetReservation(ctx context.Context, id int) (domain.Reservation, error)
+	Release(ctx context.Context, id int, reason string) error
+	Commit(ctx context.Context, id int) error
+	// Expired returns the id and tenant of pending reservations past expiry
+	Expired(ctx context.Context, now time.Time) ([]domain.Reservation, error)
+	// SetLevel records a count of the product in a warehouse
+	SetLevel(ctx context.Context, warehouseID, productID, quantity int) error
+	// Transfer moves stock between warehouses, the product stock is unchanged
+	Transfer(ctx context.Context, productID, fromWarehouseID, toWarehouseID, quantity int, reference string) error
+}
+
+type repository struct {
+	db     *sql.DB
+	txm    db.TxManager
+	outbox outbox.Repository
+}
+
+func NewRepository(conn *sql.DB) Repository {
+	return &repository{db: conn, txm: db.NewTxManager(conn), outbox: outbox.NewRepository(conn)}
+}
+
+// conn joins the transaction active in ctx, if any, labelling its
+// statements with the repository method op
+func (r *repository) conn(ctx context.Context, op string) db.Executor {
+	return db.Conn(ctx, r.db, "inventory", op)
+}
+
+// Query all inventory. Every query is scoped to the tenant of the context,
+// whose id is their first argument.
+var (
+	adjustStockQuery       = `UPDATE products SET stock = stock + ? WHERE tenant_id = ? AND id = ? AND stock + ? >= 0`
+	getStockQuery          = `SELECT stock FROM products WHERE tenant_id = ? AND id = ?`
+	createMovementQuery    = `INSERT INTO inventory_ledger (tenant_id, product_id, warehouse_id, delta, reason, reference, stock_after, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	getLedgerQuery         = `SELECT id, product_id, warehouse_id, delta, reason, reference, stock_after, created_at FROM inventory_ledger WHERE tenant_id = ? AND product_id = ? ORDER BY id`
+	createReservationQuery = `INSERT INTO stock_reservations (tenant_id, product_id, quantity, reference, status, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	getReservationQuery    = `SELECT id, product_id, quantity, reference, status, expires_at, created_at FROM stock_reservations WHERE tenant_id = ? AND id = ?`
+	lockReservationQuery   = getReservationQuery + ` FOR UPDATE`
+	updateReservationQuery = `UPDATE stock_reservations SET status = ? WHERE tenant_id = ? AND id = ? AND status = ?`
+	lockStockQuery         = `SELECT stock FROM products WHERE tenant_id = ? AND id = ? FOR UPDATE`
+	lockLevelsQuery        = `SELECT s.warehouse_id, s.quantity FROM warehouse_stock s JOIN products p ON p.id = s.product_id WHERE p.tenant_id = ? AND s.product_id = ? ORDER BY s.quantity DESC, s.warehouse_id FOR UPDATE OF s`
+	lockWarehouseQuery     = `SELECT id FROM warehouses WHERE tenant_id = ? AND id = ? FOR SHARE`
+	addLevelQuery          = `INSERT INTO warehouse_stock (warehouse_id, product_id, quantity) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE quantity = quantity + VALUES(quantity)`
+	// The product stock is what is on hand across warehouses minus pending reservations
+	syncStockQuery = `UPDATE products SET stock = GREATEST(
+		(SELECT COALESCE(SUM(quantity), 0) FROM warehouse_stock WHERE product_id = ?) -
+		(SELECT COALESCE(SUM(quantity), 0) FROM stock_reservations WHERE product_id = ? AND status = 'pending'), 0)
+		WHERE tenant_id = ? AND id = ?`
+	// The only query across tenants, the expirer releases each reservation
+	// under its own tenant
+	expiredReservationsQuery = `SELECT id, tenant_id FROM stock_reservations WHERE status = ? AND expires_at <= ?`
+)
+
+func (r *repository) Adjust(ctx context.Context, productID, warehouseID, delta int, reason, reference string) (domain.StockMovement, error) {
+	var m domain.StockMovement
+	err := r.txm.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		m, err = r.adjust(ctx, productID, warehouseID, delta, reason, reference)
+		return err
+	})
+	return m, err
+}
+
+// Ledger fails with ErrProductNotFound for products of other tenants rather
+// than returning an empty ledger
+func (r *repository) Ledger(ctx context.Context, productID int) ([]domain.StockMovement, error) {
+	var stock int
+	err := r.conn(ctx, "Ledger").QueryRowContext(ctx, getStockQuery, tenant.FromContext(ctx), productID).Scan(&stock)
+	if err == sql.ErrNoRows {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.conn(ctx, "Ledger").QueryContext(ctx, getLedgerQuery, tenant.FromContext(ctx), productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []domain.StockMovement
+	for rows.Next() {
+		var m domain.StockMovement
+		err := rows.Scan(&m.ID, &m.ProductID, &m.WarehouseID, &m.Delta, &m.Reason, &m.Reference, &m.StockAfter, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+	}
+	return movements, rows.Err()
+}
+
+func (r *repository) Reserve(ctx context.Context, res domain.Reservation) (domain.Reservation, error) {
+	err := r.txm.WithinTx(ctx, func(ctx context.Context) error {
+		stock, err := r.lockStock(ctx, res.ProductID)
+		if err != nil {
+			return err
+		}
+		if stock < res.Quantity {
+			return ErrInsufficientStock
+		}
+		levels, err := r.levels(ctx, res.ProductID)
+		if err != nil {
+			return err
+		}
+		result, err := r.conn(ctx, "Reserve").ExecContext(ctx, createReservationQuery, tenant.FromContext(ctx), res.ProductID, res.Quantity, res.Reference, res.Status, res.ExpiresAt, res.CreatedAt)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		res.ID = int(id)
+		_, err = r.hold(ctx, res.ProductID, levels, -res.Quantity, ReasonReservation, res.Reference)
+		return err
+	})
+	return res, err
+}
+
+func (r *repository) GetReservation(ctx context.Context, id int) (domain.Reservation, error) {
+	return scanReservation(r.conn(ctx, "GetReservation").QueryRowContext(ctx, getReservationQuery, tenant.FromContext(ctx), id))
+}
+
+func (r *repository) Release(ctx context.Context, id int, reason string) error {
+	return r.txm.WithinTx(ctx, func(ctx context.Context) error {
+		res, err := scanReservation(r.conn(ctx, "Release").QueryRowContext(ctx, lockReservationQuery, tenant.FromContext(ctx), id))
+		if err != nil {
+			return err
+		}
+		if res.Status != StatusPending {
+			return ErrReservationClosed
+		}
+		status := StatusReleased
+		if reason == ReasonReservationExpired {
+			status = StatusExpired
+		}
+		if _, err := r.lockStock(ctx, res.ProductID); err != nil {
+			return err
+		}
+		levels, err := r.levels(ctx, res.ProductID)
+		if err != nil {
+			return err
+		}
+		if _, err := r.conn(ctx, "Release").ExecContext(ctx, updateReservationQuery, status, tenant.FromContext(ctx), id, StatusPending); err != nil {
+			return err
+		}
+		_, err = r.hold(ctx, res.ProductID, levels, res.Quantity, reason, res.Reference)
+		return err
+	})
+}
+
+// Commit closes the reservation. The held stock already left the product
+// stock, products stocked in warehouses take it out of their levels now.
+func (r *repository) Commit(ctx context.Context, id int) error {
+	return r.txm.WithinTx(ctx, func(ctx context.Context) error {
+		res, err := scanReservation(r.conn(ctx, "Commit").QueryRowContext(ctx, lockReservationQuery, tenant.FromContext(ctx), id))
+		if err != nil {
+			return err
+		}
+		if res.Status != StatusPending {
+			return ErrReservationClosed
+		}
+		if _, err := r.lockStock(ctx, res.ProductID); err != nil {
+			return err
+		}
+		levels, err := r.levels(ctx, res.ProductID)
+		if err != nil {
+			return err
+		}
+		if _, err := r.conn(ctx, "Commit").ExecContext(ctx, updateReservationQuery, StatusCommitted, tenant.FromContext(ctx), id, StatusPending); err != nil {
+			return err
+		}
+		if len(levels) == 0 {
+			return nil
+		}
+		_, err = r.allocate(ctx, res.ProductID, levels, -res.Quantity, ReasonReservationCommitted, res.Reference)
+		return err
+	})
+}
+
+func (r *repository) Expired(ctx context.Context, now time.Time) ([]domain.Reservation, error) {
+	rows, err := r.conn(ctx, "Expired").QueryContext(ctx, expiredReservationsQuery, StatusPending, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expired []domain.Reservation
+	for rows.Next() {
+		var res domain.Reservation
+		if err := rows.Scan(&res.ID, &res.Tenant); err != nil {
+			return nil, err
+		}
+		expired = append(expired, res)
+	}
+	return expired, rows.Err()
+}
+
+// adjust applies delta to the stock of a product, at warehouseID when set,
+// only if it stays non-negative, and records the movement in the ledger.
+// Products stocked in warehouses take their stock from the levels, so a
+// change without a warehouse is spread over them.
+func (r *repository) adjust(ctx context.Context, productID, warehouseID, delta int, reason, reference string) (domain.StockMovement, error) {
+	stock, err := r.lockStock(ctx, productID)
+	if err != nil {
+		return domain.StockMovement{}, err
+	}
+	levels, err := r.levels(ctx, productID)
+	if err != nil {
+		return domain.StockMovement{}, err
+	}
+	if stock+delta < 0 {
+		return domain.StockMovement{}, ErrInsufficientStock
+	}
+
+	switch {
+	case warehouseID > 0:
+		if err := r.lockWarehouse(ctx, warehouseID); err != nil {
+			return domain.StockMovement{}, err
+		}
+		if levelOf(levels, warehouseID)+delta < 0 {
+			return domain.StockMovement{}, ErrInsufficientStock
+		}
+		return r.move(ctx, productID, warehouseID, delta, reason, reference)
+	case len(levels) == 0:
+		return r.hold(ctx, productID, levels, delta, reason, reference)
+	}
+	return r.allocate(ctx, productID, levels, delta, reason, reference)
+}
+
+// hold applies delta to the product stock alone, for reservations and
+// products kept outside warehouses, and records the movement
+func (r *repository) hold(ctx context.Context, productID int, levels []level, delta int, reason, reference string) (domain.StockMovement, error) {
+	m := domain.StockMovement{
+		ProductID: productID,
+		Delta:     delta,
+		Reason:    reason,
+		Reference: reference,
+		CreatedAt: time.Now().UTC(),
+	}
+	var err error
+	if len(levels) > 0 {
+		_, err = r.conn(ctx, "hold").ExecContext(ctx, syncStockQuery, productID, productID, tenant.FromContext(ctx), productID)
+	} else {
+		_, err = r.conn(ctx, "hold").ExecContext(ctx, adjustStockQuery, delta, tenant.FromContext(ctx), productID, delta)
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := r.conn(ctx, "hold").QueryRowContext(ctx, getStockQuery, tenant.FromContext(ctx), productID).Scan(&m.StockAfter); err != nil {
+		return m, err
+	}
+	return m, r.record(ctx, &m)
+}
+
+// allocate spreads delta over the warehouse levels: stock comes from the
+// most stocked warehouses first and goes to the most stocked one. It
+// returns the last movement.
+func (r *repository) allocate(ctx context.Context, productID int, levels []level, delta int, reason, reference string) (domain.StockMovement, error) {
+	if delta > 0 {
+		return r.move(ctx, productID, levels[0].warehouseID, delta, reason, reference)
+	}
+
+	var m domain.StockMovement
+	left := -delta
+	for _, l := range levels {
+		if left == 0 {
+			break
+		}
+		take := l.quantity
+		if take > left {
+			take = left
+		}
+		if take <= 0 {
+			continue
+		}
+		var err error
+		if m, err = r.move(ctx, productID, l.warehouseID, -take, reason, reference); err != nil {
+			return m, err
+		}
+		left -= take
+	}
+	if left > 0 {
+		return m, ErrInsufficientStock
+	}
+	return m, nil
+}
+
+func (r *repository) SetLevel(ctx context.Context, warehouseID, productID, quantity int) error {
+	return r.txm.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := r.lockStock(ctx, productID); err != nil {
+			return err
+		}
+		levels, err := r.levels(ctx, productID)
+		if err != nil {
+			return err
+		}
+		delta := quantity - levelOf(levels, warehouseID)
+		if delta == 0 {
+			return nil
+		}
+		_, err = r.move(ctx, productID, warehouseID, delta, ReasonWarehouseLevel, "")
+		return err
+	})
+}
+
+func (r *repository) Transfer(ctx context.Context, productID, fromWarehouseID, toWarehouseID, quantity int, reference string) error {
+	return r.txm.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := r.lockStock(ctx, productID); err != nil {
+			return err
+		}
+		levels, err := r.levels(ctx, productID)
+		if err != nil {
+			return err
+		}
+		if levelOf(levels, fromWarehouseID) < quantity {
+			return ErrInsufficientStock
+		}
+		if _, err := r.move(ctx, productID, fromWarehouseID, -quantity, ReasonTransfer, reference); err != nil {
+			return err
+		}
+		_, err = r.move(ctx, productID, toWarehouseID, quantity, ReasonTransfer, reference)
+		return err
+	})
+}
+
+// level is the stock of a product in one warehouse
+type level struct {
+	warehouseID int
+	quantity    int
+}
+
+// lockStock locks the product row, which serializes every stock change of
+// the product, and returns its stock
+func (r *repository) lockStock(ctx context.Context, productID int) (int, error) {
+	var stock int
+	err := r.conn(ctx, "lockStock").QueryRowContext(ctx, lockStockQuery, tenant.FromContext(ctx), productID).Scan(&stock)
+	if err == sql.ErrNoRows {
+		return 0, ErrProductNotFound
+	}
+	return stock, err
+}
+
+// lockWarehouse checks the warehouse exists and keeps it from being deleted
+// until the transaction ends
+func (r *repository) lockWarehouse(ctx context.Context, warehouseID int) error {
+	var id int
+	err := r.conn(ctx, "lockWarehouse").QueryRowContext(ctx, lockWarehouseQuery, tenant.FromContext(ctx), warehouseID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrWarehouseNotFound
+	}
+	return err
+}
+
+// levels returns the warehouse levels of a product, most stocked first
+func (r *repository) levels(ctx context.Context, productID int) ([]level, error) {
+	rows, err := r.conn(ctx, "levels").QueryContext(ctx, lockLevelsQuery, tenant.FromContext(ctx), productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var levels []level
+	for rows.Next() {
+		var l level
+		if err := rows.Scan(&l.warehouseID, &l.quantity); err != nil {
+			return nil, err
+		}
+		levels = append(levels, l)
+	}
+	return levels, rows.Err()
+}
+
+func levelOf(levels []level, warehouseID int) int {
+	for _, l := range levels {
+		if l.warehouseID == warehouseID {
+			return l.quantity
+		}
+	}
+	return 0
+}
+
+// move applies delta to the level of a warehouse, derives the product stock
+// from the levels and records the movement. The caller checked the level
+// stays non-negative while holding the product lock.
+func (r *repository) move(ctx context.Context, productID, warehouseID, delta int, reason, reference string) (domain.StockMovement, error) {
+	m := domain.StockMovement{
+		ProductID:   productID,
+		WarehouseID: &warehouseID,
+		Delta:       delta,
+		Reason:      reason,
+		Reference:   reference,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if _, err := r.conn(ctx, "move").ExecContext(ctx, addLevelQuery, warehouseID, productID, delta); err != nil {
+		return m, err
+	}
+	if _, err := r.conn(ctx, "move").ExecContext(ctx, syncStockQuery, productID, productID, tenant.FromContext(ctx), productID); err != nil {
+		return m, err
+	}
+	if err := r.conn(ctx, "move").QueryRowContext(ctx, getStockQuery, tenant.FromContext(ctx), productID).Scan(&m.StockAfter); err != nil {
+		return m, err
+	}
+	return m, r.record(ctx, &m)
+}
+
+// record adds the movement to the ledger and publishes it
+func (r *repository) record(ctx context.Context, m *domain.StockMovement) error {
+	res, err := r.conn(ctx, "record").ExecContext(ctx, createMovementQuery, tenant.FromContext(ctx), m.ProductID, m.WarehouseID, m.Delta, m.Reason, m.Reference, m.StockAfter, m.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	m.ID = int(id)
+	return r.outbox.Add(ctx, outbox.NewStockChanged(*m))
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReservation(s scanner) (domain.Reservation, error) {
+	var res domain.Reservation
+	err := s.Scan(&res.ID, &res.ProductID, &res.Quantity, &res.Reference, &res.Status, &res.ExpiresAt, &res.CreatedAt)
+	if err == sql.ErrNoRows {
+		return res, ErrReservationNotFound
+	}
+	return res, err
+}
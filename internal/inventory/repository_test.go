@@ -0,0 +1,281 @@
+package inventory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+var ctx = context.Background()
+
+func TestAdjustOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(10))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"warehouse_id", "quantity"}))
+	mock.ExpectExec("UPDATE products SET stock = stock \\+ \\? WHERE tenant_id = \\? AND id = \\? AND stock \\+ \\? >= 0").
+		WithArgs(-2, tenant.Default, 1, -2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\?").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(8))
+	mock.ExpectExec("INSERT INTO inventory_ledger").WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	repository := NewRepository(db)
+	movement, err := repository.Adjust(ctx, 1, 0, -2, ReasonSale, "order-1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 5, movement.ID)
+	assert.Equal(t, 8, movement.StockAfter)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdjustErrInsufficientStock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(1))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"warehouse_id", "quantity"}))
+	mock.ExpectRollback()
+
+	repository := NewRepository(db)
+	_, err = repository.Adjust(ctx, 1, 0, -2, ReasonSale, "")
+
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdjustErrProductNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}))
+	mock.ExpectRollback()
+
+	repository := NewRepository(db)
+	_, err = repository.Adjust(ctx, 1, 0, 5, ReasonRestock, "")
+
+	assert.ErrorIs(t, err, ErrProductNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdjustErrWarehouseNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(10))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"warehouse_id", "quantity"}))
+	mock.ExpectQuery("SELECT id FROM warehouses WHERE tenant_id = \\? AND id = \\? FOR SHARE").
+		WithArgs(tenant.Default, 99).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	repository := NewRepository(db)
+	_, err = repository.Adjust(ctx, 1, 99, 5, ReasonRestock, "")
+
+	assert.ErrorIs(t, err, ErrWarehouseNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReleaseOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	colums := []string{"id", "product_id", "quantity", "reference", "status", "expires_at", "created_at"}
+	rows := mock.NewRows(colums).AddRow(3, 1, 2, "cart-9", StatusPending, time.Now(), time.Now())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM stock_reservations WHERE tenant_id = \\? AND id = \\? FOR UPDATE").WithArgs(tenant.Default, 3).WillReturnRows(rows)
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(8))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"warehouse_id", "quantity"}))
+	mock.ExpectExec("UPDATE stock_reservations SET status = ?").
+		WithArgs(StatusExpired, tenant.Default, 3, StatusPending).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE products SET stock").WithArgs(2, tenant.Default, 1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(10))
+	mock.ExpectExec("INSERT INTO inventory_ledger").WillReturnResult(sqlmock.NewResult(6, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	repository := NewRepository(db)
+	err = repository.Release(ctx, 3, ReasonReservationExpired)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommitOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	colums := []string{"id", "product_id", "quantity", "reference", "status", "expires_at", "created_at"}
+	rows := mock.NewRows(colums).AddRow(3, 1, 4, "cart-9", StatusPending, time.Now(), time.Now())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM stock_reservations WHERE tenant_id = \\? AND id = \\? FOR UPDATE").WithArgs(tenant.Default, 3).WillReturnRows(rows)
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(6))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"warehouse_id", "quantity"}).AddRow(2, 7).AddRow(1, 3))
+	mock.ExpectExec("UPDATE stock_reservations SET status = ?").
+		WithArgs(StatusCommitted, tenant.Default, 3, StatusPending).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO warehouse_stock").WithArgs(2, 1, -4).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE products SET stock = GREATEST").WithArgs(1, 1, tenant.Default, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\?").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(6))
+	mock.ExpectExec("INSERT INTO inventory_ledger").
+		WithArgs(tenant.Default, 1, 2, -4, ReasonReservationCommitted, "cart-9", 6, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	repository := NewRepository(db)
+	err = repository.Commit(ctx, 3)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCommitErrReservationClosed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	colums := []string{"id", "product_id", "quantity", "reference", "status", "expires_at", "created_at"}
+	rows := mock.NewRows(colums).AddRow(3, 1, 4, "cart-9", StatusCommitted, time.Now(), time.Now())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM stock_reservations WHERE tenant_id = \\? AND id = \\? FOR UPDATE").WithArgs(tenant.Default, 3).WillReturnRows(rows)
+	mock.ExpectRollback()
+
+	repository := NewRepository(db)
+	err = repository.Commit(ctx, 3)
+
+	assert.ErrorIs(t, err, ErrReservationClosed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// A sale takes the stock out of a warehouse, so counting that warehouse
+// afterwards leaves the product stock where the sale put it
+func TestSellThenSetLevelOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(10))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"warehouse_id", "quantity"}).AddRow(1, 10))
+	mock.ExpectExec("INSERT INTO warehouse_stock").WithArgs(1, 1, -3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE products SET stock = GREATEST").WithArgs(1, 1, tenant.Default, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\?").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(7))
+	mock.ExpectExec("INSERT INTO inventory_ledger").
+		WithArgs(tenant.Default, 1, 1, -3, ReasonSale, "order-1", 7, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(7))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"warehouse_id", "quantity"}).AddRow(1, 7))
+	mock.ExpectCommit()
+
+	repository := NewRepository(db)
+	movement, err := repository.Adjust(ctx, 1, 0, -3, ReasonSale, "order-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, *movement.WarehouseID)
+	assert.Equal(t, 7, movement.StockAfter)
+
+	err = repository.SetLevel(ctx, 1, 1, 7)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLedgerErrOtherTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\?").
+		WithArgs("acme", 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}))
+
+	repository := NewRepository(db)
+	_, err = repository.Ledger(tenant.WithID(ctx, "acme"), 1)
+
+	assert.ErrorIs(t, err, ErrProductNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReleaseErrOtherTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	colums := []string{"id", "product_id", "quantity", "reference", "status", "expires_at", "created_at"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM stock_reservations WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs("acme", 3).WillReturnRows(mock.NewRows(colums))
+	mock.ExpectRollback()
+
+	repository := NewRepository(db)
+	err = repository.Release(tenant.WithID(ctx, "acme"), 3, ReasonReservationReleased)
+
+	assert.ErrorIs(t, err, ErrReservationNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,183 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+type Service interface {
+	Adjust(ctx context.Context, productID, warehouseID, delta int, reason, reference string) (domain.StockMovement, error)
+	Ledger(ctx context.Context, productID int) ([]domain.StockMovement, error)
+	Reserve(ctx context.Context, productID, quantity int, ttl time.Duration, reference string) (domain.Reservation, error)
+	GetReservation(ctx context.Context, id int) (domain.Reservation, error)
+	Release(ctx context.Context, id int) (domain.Reservation, error)
+	Commit(ctx context.Context, id int) (domain.Reservation, error)
+	ExpireReservations(ctx context.Context) (int, error)
+}
+
+// Ledger reason codes
+const (
+	ReasonSale                 = "sale"
+	ReasonRestock              = "restock"
+	ReasonReturn               = "return"
+	ReasonDamage               = "damage"
+	ReasonCorrection           = "correction"
+	ReasonReservation          = "reservation"
+	ReasonReservationReleased  = "reservation_released"
+	ReasonReservationExpired   = "reservation_expired"
+	ReasonReservationCommitted = "reservation_committed"
+	ReasonOrderCancelled       = "order_cancelled"
+	ReasonWarehouseLevel       = "warehouse_level"
+	ReasonTransfer             = "transfer"
+	// ReasonProductUpdate is a stock set by updating the product
+	ReasonProductUpdate = "product_update"
+)
+
+// Reservation statuses
+const (
+	StatusPending   = "pending"
+	StatusCommitted = "committed"
+	StatusReleased  = "released"
+	StatusExpired   = "expired"
+)
+
+const (
+	DefaultReservationTTL = 15 * time.Minute
+	MaxReservationTTL     = 24 * time.Hour
+)
+
+var (
+	ErrProductNotFound     = errors.New("product not found")
+	ErrWarehouseNotFound   = errors.New("warehouse not found")
+	ErrInsufficientStock   = errors.New("insufficient stock")
+	ErrInvalidDelta        = errors.New("delta must not be zero")
+	ErrInvalidQuantity     = errors.New("quantity must be greater than zero")
+	ErrInvalidReason       = errors.New("invalid reason code")
+	ErrInvalidTTL          = fmt.Errorf("ttl must be between 1s and %s", MaxReservationTTL)
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrReservationClosed   = errors.New("reservation is no longer pending")
+)
+
+// Reasons accepted for manual adjustments, the reservation ones are
+// reserved for the reservation workflow.
+var manualReasons = map[string]bool{
+	ReasonSale:       true,
+	ReasonRestock:    true,
+	ReasonReturn:     true,
+	ReasonDamage:     true,
+	ReasonCorrection: true,
+}
+
+type service struct {
+	repo Repository
+	now  func() time.Time
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo, now: time.Now}
+}
+
+func (s *service) Adjust(ctx context.Context, productID, warehouseID, delta int, reason, reference string) (domain.StockMovement, error) {
+	if delta == 0 {
+		return domain.StockMovement{}, ErrInvalidDelta
+	}
+	if !manualReasons[reason] {
+		return domain.StockMovement{}, ErrInvalidReason
+	}
+	return s.repo.Adjust(ctx, productID, warehouseID, delta, reason, reference)
+}
+
+func (s *service) Ledger(ctx context.Context, productID int) ([]domain.StockMovement, error) {
+	return s.repo.Ledger(ctx, productID)
+}
+
+func (s *service) Reserve(ctx context.Context, productID, quantity int, ttl time.Duration, reference string) (domain.Reservation, error) {
+	if quantity <= 0 {
+		return domain.Reservation{}, ErrInvalidQuantity
+	}
+	if ttl == 0 {
+		ttl = DefaultReservationTTL
+	}
+	if ttl < time.Second || ttl > MaxReservationTTL {
+		return domain.Reservation{}, ErrInvalidTTL
+	}
+	now := s.now().UTC()
+	return s.repo.Reserve(ctx, domain.Reservation{
+		ProductID: productID,
+		Quantity:  quantity,
+		Reference: reference,
+		Status:    StatusPending,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	})
+}
+
+func (s *service) GetReservation(ctx context.Context, id int) (domain.Reservation, error) {
+	return s.repo.GetReservation(ctx, id)
+}
+
+func (s *service) Release(ctx context.Context, id int) (domain.Reservation, error) {
+	if err := s.repo.Release(ctx, id, ReasonReservationReleased); err != nil {
+		return domain.Reservation{}, err
+	}
+	return s.repo.GetReservation(ctx, id)
+}
+
+func (s *service) Commit(ctx context.Context, id int) (domain.Reservation, error) {
+	res, err := s.repo.GetReservation(ctx, id)
+	if err != nil {
+		return res, err
+	}
+	if res.Status == StatusPending && !s.now().Before(res.ExpiresAt) {
+		return res, ErrReservationClosed
+	}
+	if err := s.repo.Commit(ctx, id); err != nil {
+		return res, err
+	}
+	res.Status = StatusCommitted
+	return res, nil
+}
+
+// ExpireReservations returns the stock held by every pending reservation
+// past its expiry and reports how many were released.
+func (s *service) ExpireReservations(ctx context.Context) (int, error) {
+	reservations, err := s.repo.Expired(ctx, s.now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, res := range reservations {
+		err := s.repo.Release(tenant.WithID(ctx, res.Tenant), res.ID, ReasonReservationExpired)
+		if errors.Is(err, ErrReservationClosed) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// RunExpirer expires reservations every interval until ctx is done,
+// logging failures to log
+func RunExpirer(ctx context.Context, s Service, interval time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ExpireReservations(ctx); err != nil {
+				log.Error("expire reservations", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package job
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+)
+
+// Interval at which Pop checks for due jobs
+const memoryPollInterval = 5 * time.Millisecond
+
+type memoryRepository struct {
+	mu      sync.Mutex
+	jobs    map[string]domain.Job
+	pending map[string]time.Time
+	// leases of popped jobs by id
+	processing map[string]time.Time
+	dead       []string
+}
+
+// NewMemoryRepository returns a process local Repository, meant for tests
+func NewMemoryRepository() Repository {
+	return &memoryRepository{jobs: map[string]domain.Job{}, pending: map[string]time.Time{}, processing: map[string]time.Time{}}
+}
+
+func (r *memoryRepository) Get(ctx context.Context, id string) (domain.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok {
+		return j, ErrNotFound
+	}
+	return j, nil
+}
+
+func (r *memoryRepository) Save(ctx context.Context, j domain.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[j.ID] = j
+	return nil
+}
+
+func (r *memoryRepository) Update(ctx context.Context, id string, fn func(j *domain.Job) error) (domain.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok {
+		return j, ErrNotFound
+	}
+	if err := fn(&j); err != nil {
+		return r.jobs[id], err
+	}
+	r.jobs[id] = j
+	return j, nil
+}
+
+func (r *memoryRepository) Push(ctx context.Context, id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[id] = at
+	return nil
+}
+
+func (r *memoryRepository) Pop(ctx context.Context, timeout, lease time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if id, ok := r.due(lease); ok {
+			return id, nil
+		}
+		if time.Now().After(deadline) {
+			return "", ErrEmpty
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(memoryPollInterval):
+		}
+	}
+}
+
+// due moves the job that has been due the longest to the processing ones
+// and returns it
+func (r *memoryRepository) due(lease time.Duration) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	next, nextAt := "", now
+	for id, at := range r.pending {
+		if !at.After(nextAt) {
+			next, nextAt = id, at
+		}
+	}
+	if next == "" {
+		return "", false
+	}
+	delete(r.pending, next)
+	r.processing[next] = now.Add(lease)
+	return next, true
+}
+
+func (r *memoryRepository) Extend(ctx context.Context, id string, lease time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.processing[id]; ok {
+		r.processing[id] = time.Now().Add(lease)
+	}
+	return nil
+}
+
+func (r *memoryRepository) Ack(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.processing, id)
+	return nil
+}
+
+func (r *memoryRepository) Expired(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var ids []string
+	for id, until := range r.processing {
+		if until.Before(now) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *memoryRepository) Requeue(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.processing[id]; ok {
+		delete(r.processing, id)
+		// Ahead of the jobs that are due
+		r.pending[id] = time.Time{}
+	}
+	return nil
+}
+
+func (r *memoryRepository) DeadLetter(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dead = append(r.dead, id)
+	return nil
+}
@@ -0,0 +1,197 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vincentconace/api-gin/internal/domain"
+)
+
+// Repository stores jobs and the queue of job ids waiting to run
+type Repository interface {
+	Get(ctx context.Context, id string) (domain.Job, error)
+	Save(ctx context.Context, j domain.Job) error
+	// Update applies fn to the stored job only if nobody changed it
+	// meanwhile. An error of fn leaves the job as it was and is returned.
+	Update(ctx context.Context, id string, fn func(j *domain.Job) error) (domain.Job, error)
+	// Push queues id to run at the given time
+	Push(ctx context.Context, id string, at time.Time) error
+	// Pop waits up to timeout for a job id that is due, returning ErrEmpty
+	// when there is none. The job stays in a processing list, leased to
+	// the caller for lease, until it is acknowledged.
+	Pop(ctx context.Context, timeout, lease time.Duration) (string, error)
+	// Extend renews the lease of a popped job
+	Extend(ctx context.Context, id string, lease time.Duration) error
+	// Ack removes a popped job from the processing list
+	Ack(ctx context.Context, id string) error
+	// Expired lists the popped jobs whose lease ran out, their worker died
+	Expired(ctx context.Context) ([]string, error)
+	// Requeue moves a popped job back to the ready list, ahead of the jobs
+	// that are due
+	Requeue(ctx context.Context, id string) error
+	DeadLetter(ctx context.Context, id string) error
+}
+
+// Finished jobs are kept this long
+const TTL = 7 * 24 * time.Hour
+
+// Redis keys of the queues
+const (
+	readyKey      = "jobs:ready"
+	delayedKey    = "jobs:delayed"
+	processingKey = "jobs:processing"
+	deadKey       = "jobs:dead"
+)
+
+// Update gives up after this many conflicting writes
+const maxUpdateAttempts = 10
+
+// Moves due delayed jobs to the ready list atomically
+var promoteScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('LPUSH', KEYS[2], id)
+end
+return #ids`)
+
+// Lists the popped jobs without a lease
+var expiredScript = redis.NewScript(`
+local ids = redis.call('LRANGE', KEYS[1], 0, -1)
+local expired = {}
+for _, id in ipairs(ids) do
+	if redis.call('EXISTS', ARGV[1] .. id .. ARGV[2]) == 0 then
+		table.insert(expired, id)
+	end
+end
+return expired`)
+
+// Moves a popped job back to the end of the ready list that is popped
+// first, once even if called twice
+var requeueScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) > 0 then
+	redis.call('RPUSH', KEYS[2], ARGV[1])
+end
+return 0`)
+
+type repository struct {
+	rd *redis.Client
+}
+
+func NewRepository(rd *redis.Client) Repository {
+	return &repository{rd: rd}
+}
+
+func (r *repository) Get(ctx context.Context, id string) (domain.Job, error) {
+	var j domain.Job
+	data, err := r.rd.Get(ctx, key(id)).Bytes()
+	if err == redis.Nil {
+		return j, ErrNotFound
+	}
+	if err != nil {
+		return j, err
+	}
+	err = json.Unmarshal(data, &j)
+	return j, err
+}
+
+func (r *repository) Save(ctx context.Context, j domain.Job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return r.rd.Set(ctx, key(j.ID), data, TTL).Err()
+}
+
+func (r *repository) Update(ctx context.Context, id string, fn func(j *domain.Job) error) (domain.Job, error) {
+	var j domain.Job
+	for i := 0; i < maxUpdateAttempts; i++ {
+		err := r.rd.Watch(ctx, func(tx *redis.Tx) error {
+			j = domain.Job{}
+			data, err := tx.Get(ctx, key(id)).Bytes()
+			if err == redis.Nil {
+				return ErrNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(data, &j); err != nil {
+				return err
+			}
+			if err := fn(&j); err != nil {
+				return err
+			}
+			if data, err = json.Marshal(j); err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key(id), data, TTL)
+				return nil
+			})
+			return err
+		}, key(id))
+		if err != redis.TxFailedErr {
+			return j, err
+		}
+	}
+	return j, ErrConflict
+}
+
+func (r *repository) Push(ctx context.Context, id string, at time.Time) error {
+	if !at.After(time.Now()) {
+		return r.rd.LPush(ctx, readyKey, id).Err()
+	}
+	return r.rd.ZAdd(ctx, delayedKey, &redis.Z{Score: float64(at.UnixMilli()), Member: id}).Err()
+}
+
+func (r *repository) Pop(ctx context.Context, timeout, lease time.Duration) (string, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	if err := promoteScript.Run(ctx, r.rd, []string{delayedKey, readyKey}, now).Err(); err != nil {
+		return "", err
+	}
+	id, err := r.rd.BLMove(ctx, readyKey, processingKey, "RIGHT", "LEFT", timeout).Result()
+	if err == redis.Nil {
+		return "", ErrEmpty
+	}
+	if err != nil {
+		return "", err
+	}
+	return id, r.Extend(ctx, id, lease)
+}
+
+func (r *repository) Extend(ctx context.Context, id string, lease time.Duration) error {
+	return r.rd.Set(ctx, leaseKey(id), 1, lease).Err()
+}
+
+func (r *repository) Ack(ctx context.Context, id string) error {
+	_, err := r.rd.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, processingKey, 1, id)
+		pipe.Del(ctx, leaseKey(id))
+		return nil
+	})
+	return err
+}
+
+func (r *repository) Expired(ctx context.Context) ([]string, error) {
+	return expiredScript.Run(ctx, r.rd, []string{processingKey}, "job[", "]:lease").StringSlice()
+}
+
+func (r *repository) Requeue(ctx context.Context, id string) error {
+	return requeueScript.Run(ctx, r.rd, []string{processingKey, readyKey}, id).Err()
+}
+
+func (r *repository) DeadLetter(ctx context.Context, id string) error {
+	return r.rd.LPush(ctx, deadKey, id).Err()
+}
+
+func key(id string) string {
+	return "job[" + id + "]"
+}
+
+// leaseKey exists while a worker holds the job, expiredScript builds it too
+func leaseKey(id string) string {
+	return key(id) + ":lease"
+}
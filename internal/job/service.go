@@ -0,0 +1,437 @@
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/logging"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+	"github.com/vincentconace/api-gin/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Handler runs a job of one type. It reports progress as a percentage and
+// returns a link to the result, if any. Errors are retried unless wrapped
+// with Permanent.
+type Handler func(ctx context.Context, j domain.Job, progress func(percent int)) (resultURL string, err error)
+
+type Service interface {
+	Register(jobType string, h Handler)
+	Enqueue(ctx context.Context, jobType string, payload interface{}) (domain.Job, error)
+	// Get and Cancel only find jobs enqueued in the tenant of ctx
+	Get(ctx context.Context, id string) (domain.Job, error)
+	Cancel(ctx context.Context, id string) (domain.Job, error)
+	// Run processes jobs with the given number of workers until ctx is
+	// done, then waits up to grace for running jobs before interrupting
+	// and requeueing them.
+	Run(ctx context.Context, workers int, grace time.Duration)
+}
+
+// Job statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+const (
+	DefaultMaxAttempts = 5
+	maxBackoff         = 5 * time.Minute
+	popTimeout         = time.Second
+)
+
+// Variables so tests can run without waiting
+var (
+	baseBackoff   = time.Second
+	watchInterval = time.Second
+	// Workers renew the lease of their job every watchInterval, jobs whose
+	// lease runs out are reaped every reapInterval
+	lease        = 30 * time.Second
+	reapInterval = 30 * time.Second
+)
+
+var (
+	ErrNotFound       = errors.New("job not found")
+	ErrEmpty          = errors.New("no job ready")
+	ErrUnknownType    = errors.New("unknown job type")
+	ErrNotCancellable = errors.New("job already finished")
+	ErrInvalidPayload = errors.New("invalid job payload")
+	ErrConflict       = errors.New("job changed concurrently")
+
+	// errSkip leaves a job alone that is no longer the worker's to run
+	errSkip = errors.New("job skipped")
+	// errWorkerLost is recorded for the attempt of a worker that died
+	errWorkerLost = errors.New("worker lost")
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, failing the job right away
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+type service struct {
+	repo     Repository
+	log      *slog.Logger
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+func NewService(repo Repository, log *slog.Logger) Service {
+	return &service{repo: repo, log: log, handlers: map[string]Handler{}}
+}
+
+func (s *service) Register(jobType string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[jobType] = h
+}
+
+func (s *service) Enqueue(ctx context.Context, jobType string, payload interface{}) (domain.Job, error) {
+	if s.handler(jobType) == nil {
+		return domain.Job{}, fmt.Errorf("%w: %s", ErrUnknownType, jobType)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return domain.Job{}, err
+	}
+
+	now := time.Now().UTC()
+	j := domain.Job{
+		ID:          newID(),
+		Type:        jobType,
+		Status:      StatusQueued,
+		Tenant:      tenant.FromContext(ctx),
+		Payload:     data,
+		MaxAttempts: DefaultMaxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Trace:       map[string]string{},
+	}
+	tracing.Inject(ctx, j.Trace)
+	if err := s.repo.Save(ctx, j); err != nil {
+		return j, err
+	}
+	return j, s.repo.Push(ctx, j.ID, now)
+}
+
+func (s *service) Get(ctx context.Context, id string) (domain.Job, error) {
+	j, err := s.repo.Get(ctx, id)
+	if err == nil && j.Tenant != tenant.FromContext(ctx) {
+		return domain.Job{}, ErrNotFound
+	}
+	return j, err
+}
+
+// Cancel stops a queued job from running and asks a running one to stop.
+// Workers notice cancellation of running jobs within a second.
+func (s *service) Cancel(ctx context.Context, id string) (domain.Job, error) {
+	j, err := s.repo.Update(ctx, id, func(j *domain.Job) error {
+		if j.Tenant != tenant.FromContext(ctx) {
+			return ErrNotFound
+		}
+		if j.Status != StatusQueued && j.Status != StatusRunning {
+			return ErrNotCancellable
+		}
+		now := time.Now().UTC()
+		j.Status, j.UpdatedAt, j.FinishedAt = StatusCancelled, now, &now
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		return domain.Job{}, err
+	}
+	return j, err
+}
+
+func (s *service) Run(ctx context.Context, workers int, grace time.Duration) {
+	// Running jobs use their own context so shutdown lets them finish
+	runCtx, interrupt := context.WithCancel(context.Background())
+	defer interrupt()
+
+	go s.reap(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx, runCtx)
+		}()
+	}
+
+	<-ctx.Done()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(grace):
+		interrupt()
+		<-done
+	}
+}
+
+// reap queues again the jobs of workers that died until ctx is done
+func (s *service) reap(ctx context.Context) {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ids, err := s.repo.Expired(ctx)
+			if err != nil {
+				s.log.Error("reap jobs", "error", err)
+				continue
+			}
+			for _, id := range ids {
+				s.reapOne(ctx, id)
+			}
+		}
+	}
+}
+
+// reapOne queues again, or fails when it has no attempts left, a job whose
+// worker died. The attempt of that worker counts.
+func (s *service) reapOne(ctx context.Context, id string) {
+	log := s.log.With("job_id", id)
+	j, err := s.repo.Update(ctx, id, func(j *domain.Job) error {
+		// Not started, or finished but not acknowledged: process decides
+		if j.Status != StatusRunning {
+			return errSkip
+		}
+		now := time.Now().UTC()
+		j.UpdatedAt = now
+		j.Errors = append(j.Errors, errWorkerLost.Error())
+		if j.Attempts >= j.MaxAttempts {
+			j.Status, j.FinishedAt = StatusFailed, &now
+		} else {
+			j.Status, j.RunAt = StatusQueued, now
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrNotFound):
+		s.ack(ctx, log, id)
+		return
+	case errors.Is(err, errSkip):
+	case err != nil:
+		log.Error("reap job", "error", err)
+		return
+	case j.Status == StatusFailed:
+		log.Error("job failed, its worker was lost", "attempt", j.Attempts)
+		if err := s.repo.DeadLetter(ctx, id); err != nil {
+			log.Error("requeue job", "error", err)
+			return
+		}
+		s.ack(ctx, log, id)
+		return
+	default:
+		log.Warn("requeued job of lost worker", "attempt", j.Attempts)
+	}
+	if err := s.repo.Requeue(ctx, id); err != nil {
+		log.Error("requeue job", "error", err)
+	}
+}
+
+func (s *service) work(ctx, runCtx context.Context) {
+	for ctx.Err() == nil {
+		id, err := s.repo.Pop(ctx, popTimeout, lease)
+		if errors.Is(err, ErrEmpty) || ctx.Err() != nil {
+			continue
+		}
+		if err != nil {
+			s.log.Error("pop job", "error", err)
+			sleep(ctx, popTimeout)
+			continue
+		}
+		s.process(runCtx, id)
+	}
+}
+
+func (s *service) process(runCtx context.Context, id string) {
+	// Bookkeeping must survive an interrupted run
+	ctx := context.Background()
+	log := s.log.With("job_id", id)
+	j, err := s.repo.Update(ctx, id, func(j *domain.Job) error {
+		// Cancelled while queued, or a duplicate of a job already handled
+		if j.Status != StatusQueued {
+			return errSkip
+		}
+		now := time.Now().UTC()
+		j.Status, j.Attempts, j.StartedAt, j.UpdatedAt = StatusRunning, j.Attempts+1, &now, now
+		return nil
+	})
+	if errors.Is(err, errSkip) || errors.Is(err, ErrNotFound) {
+		s.ack(ctx, log, id)
+		return
+	}
+	if err != nil {
+		// The lease runs out and the job is reaped
+		log.Error("start job", "error", err)
+		return
+	}
+	log = log.With("job_type", j.Type, "attempt", j.Attempts)
+
+	var resultURL string
+	h := s.handler(j.Type)
+	if h == nil {
+		err = Permanent(fmt.Errorf("%w: %s", ErrUnknownType, j.Type))
+	} else {
+		// Handlers logging with the context tie their records to the job
+		runCtx := logging.WithAttrs(runCtx, slog.String("job_id", id), slog.String("job_type", j.Type), slog.Int("attempt", j.Attempts))
+		resultURL, err = s.execute(runCtx, j, h)
+	}
+
+	// A cancel that lands first wins over the outcome of the run
+	j, saveErr := s.repo.Update(ctx, id, func(j *domain.Job) error {
+		if j.Status != StatusRunning {
+			return errSkip
+		}
+		now := time.Now().UTC()
+		j.UpdatedAt = now
+		switch {
+		case err == nil:
+			j.Status, j.Progress, j.ResultURL, j.FinishedAt = StatusSucceeded, 100, resultURL, &now
+		case runCtx.Err() != nil:
+			// Interrupted by shutdown, the attempt doesn't count
+			j.Status, j.Attempts, j.RunAt = StatusQueued, j.Attempts-1, now
+		case isPermanent(err) || j.Attempts >= j.MaxAttempts:
+			j.Status, j.FinishedAt = StatusFailed, &now
+			j.Errors = append(j.Errors, err.Error())
+		default:
+			j.Status, j.RunAt = StatusQueued, now.Add(backoff(j.Attempts))
+			j.Errors = append(j.Errors, err.Error())
+		}
+		return nil
+	})
+	if errors.Is(saveErr, errSkip) {
+		s.ack(ctx, log, id)
+		return
+	}
+	if saveErr != nil {
+		log.Error("finish job", "error", saveErr)
+		return
+	}
+
+	switch j.Status {
+	case StatusSucceeded:
+		log.Info("job succeeded")
+	case StatusQueued:
+		log.Warn("job attempt failed, retrying", "error", err, "run_at", j.RunAt)
+		err = s.repo.Push(ctx, j.ID, j.RunAt)
+	case StatusFailed:
+		log.Error("job failed", "error", err)
+		err = s.repo.DeadLetter(ctx, j.ID)
+	}
+	if err != nil {
+		log.Error("requeue job", "error", err)
+		return
+	}
+	s.ack(ctx, log, id)
+}
+
+func (s *service) ack(ctx context.Context, log *slog.Logger, id string) {
+	if err := s.repo.Ack(ctx, id); err != nil {
+		log.Error("ack job", "error", err)
+	}
+}
+
+// execute runs h, cancelling its context when the job gets cancelled
+func (s *service) execute(runCtx context.Context, j domain.Job, h Handler) (resultURL string, err error) {
+	ctx, cancel := context.WithCancel(runCtx)
+	defer cancel()
+	// The run joins the trace of the request that enqueued the job
+	ctx, span := tracing.Start(tracing.Extract(ctx, j.Trace), "job "+j.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("job.id", j.ID), attribute.Int("job.attempt", j.Attempts)))
+	defer func() { tracing.End(span, err) }()
+
+	go func() {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.repo.Extend(ctx, j.ID, lease); err != nil {
+					s.log.ErrorContext(ctx, "extend job lease", "error", err)
+				}
+				if latest, err := s.repo.Get(ctx, j.ID); err == nil && latest.Status == StatusCancelled {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	progress := func(percent int) {
+		_, err := s.repo.Update(ctx, j.ID, func(latest *domain.Job) error {
+			if latest.Status != StatusRunning {
+				return errSkip
+			}
+			latest.Progress, latest.UpdatedAt = percent, time.Now().UTC()
+			return nil
+		})
+		if err != nil && !errors.Is(err, errSkip) {
+			s.log.ErrorContext(ctx, "save job progress", "error", err)
+		}
+	}
+	// Handlers act for the tenant that enqueued the job
+	return h(tenant.WithID(ctx, j.Tenant), j, progress)
+}
+
+func (s *service) handler(jobType string) Handler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.handlers[jobType]
+}
+
+func isPermanent(err error) bool {
+	var perm permanentError
+	return errors.As(err, &perm)
+}
+
+// backoff doubles the delay after each failed attempt, up to maxBackoff
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << (attempt - 1)
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,320 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/logging"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+	"github.com/vincentconace/api-gin/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func init() {
+	baseBackoff = time.Millisecond
+	watchInterval = 5 * time.Millisecond
+	lease = 50 * time.Millisecond
+	reapInterval = 10 * time.Millisecond
+}
+
+// start runs the workers until the returned stop function is called
+func start(s Service, grace time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx, 2, grace)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func waitStatus(t *testing.T, s Service, id, status string) domain.Job {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		j, err := s.Get(context.Background(), id)
+		assert.NoError(t, err)
+		if j.Status == status || time.Now().After(deadline) {
+			assert.Equal(t, status, j.Status)
+			return j
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRunOk(t *testing.T) {
+	service := NewService(NewMemoryRepository(), logging.Discard())
+	service.Register("export", func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		progress(50)
+		return "/media/exports/" + j.ID + ".csv", nil
+	})
+	stop := start(service, time.Second)
+	defer stop()
+
+	j, err := service.Enqueue(context.Background(), "export", map[string]string{"format": "csv"})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusQueued, j.Status)
+
+	j = waitStatus(t, service, j.ID, StatusSucceeded)
+	assert.Equal(t, 100, j.Progress)
+	assert.Equal(t, 1, j.Attempts)
+	assert.Equal(t, "/media/exports/"+j.ID+".csv", j.ResultURL)
+	assert.JSONEq(t, `{"format":"csv"}`, string(j.Payload))
+}
+
+func TestRunErrRetriesThenDeadLetter(t *testing.T) {
+	repo := NewMemoryRepository()
+	service := NewService(repo, logging.Discard())
+	service.Register("export", func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		return "", errors.New("storage unavailable")
+	})
+	stop := start(service, time.Second)
+	defer stop()
+
+	j, err := service.Enqueue(context.Background(), "export", nil)
+	assert.NoError(t, err)
+
+	j = waitStatus(t, service, j.ID, StatusFailed)
+	assert.Equal(t, DefaultMaxAttempts, j.Attempts)
+	assert.Len(t, j.Errors, DefaultMaxAttempts)
+	assert.Equal(t, []string{j.ID}, repo.(*memoryRepository).dead)
+}
+
+func TestRunErrPermanent(t *testing.T) {
+	service := NewService(NewMemoryRepository(), logging.Discard())
+	service.Register("import", func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		return "", Permanent(ErrInvalidPayload)
+	})
+	stop := start(service, time.Second)
+	defer stop()
+
+	j, err := service.Enqueue(context.Background(), "import", nil)
+	assert.NoError(t, err)
+
+	j = waitStatus(t, service, j.ID, StatusFailed)
+	assert.Equal(t, 1, j.Attempts)
+	assert.Equal(t, []string{ErrInvalidPayload.Error()}, j.Errors)
+}
+
+func TestCancelRunningOk(t *testing.T) {
+	service := NewService(NewMemoryRepository(), logging.Discard())
+	stopped := make(chan struct{})
+	service.Register("export", func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		<-ctx.Done()
+		close(stopped)
+		return "", ctx.Err()
+	})
+	stop := start(service, time.Second)
+	defer stop()
+
+	j, err := service.Enqueue(context.Background(), "export", nil)
+	assert.NoError(t, err)
+	waitStatus(t, service, j.ID, StatusRunning)
+
+	_, err = service.Cancel(context.Background(), j.ID)
+	assert.NoError(t, err)
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("running job was not cancelled")
+	}
+	waitStatus(t, service, j.ID, StatusCancelled)
+}
+
+func TestCancelErrFinished(t *testing.T) {
+	service := NewService(NewMemoryRepository(), logging.Discard())
+	service.Register("export", func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		return "", nil
+	})
+	stop := start(service, time.Second)
+	defer stop()
+
+	j, err := service.Enqueue(context.Background(), "export", nil)
+	assert.NoError(t, err)
+	waitStatus(t, service, j.ID, StatusSucceeded)
+
+	_, err = service.Cancel(context.Background(), j.ID)
+	assert.ErrorIs(t, err, ErrNotCancellable)
+}
+
+func TestRunShutdownRequeuesInterrupted(t *testing.T) {
+	repo := NewMemoryRepository()
+	service := NewService(repo, logging.Discard())
+	service.Register("export", func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	stop := start(service, 10*time.Millisecond)
+
+	j, err := service.Enqueue(context.Background(), "export", nil)
+	assert.NoError(t, err)
+	waitStatus(t, service, j.ID, StatusRunning)
+	stop()
+
+	j, err = service.Get(context.Background(), j.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusQueued, j.Status)
+	assert.Equal(t, 0, j.Attempts)
+	id, err := repo.Pop(context.Background(), time.Millisecond, lease)
+	assert.NoError(t, err)
+	assert.Equal(t, j.ID, id)
+}
+
+func TestCancelOkBeforeFinish(t *testing.T) {
+	service := NewService(NewMemoryRepository(), logging.Discard())
+	service.Register("export", func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		// Cancelled after the run, before its outcome is saved
+		_, err := service.Cancel(context.Background(), j.ID)
+		return "/media/exports/" + j.ID + ".csv", err
+	})
+	stop := start(service, time.Second)
+	defer stop()
+
+	j, err := service.Enqueue(context.Background(), "export", nil)
+	assert.NoError(t, err)
+
+	j = waitStatus(t, service, j.ID, StatusCancelled)
+	time.Sleep(10 * watchInterval)
+	j, err = service.Get(context.Background(), j.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCancelled, j.Status)
+	assert.Empty(t, j.ResultURL)
+}
+
+func TestRunOkReapsLostJob(t *testing.T) {
+	repo := NewMemoryRepository()
+	service := NewService(repo, logging.Discard())
+	service.Register("export", func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		return "", nil
+	})
+
+	j, err := service.Enqueue(context.Background(), "export", nil)
+	assert.NoError(t, err)
+	// A worker pops the job and dies
+	id, err := repo.Pop(context.Background(), time.Millisecond, time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, j.ID, id)
+
+	stop := start(service, time.Second)
+	waitStatus(t, service, j.ID, StatusSucceeded)
+	stop()
+
+	assert.Empty(t, repo.(*memoryRepository).processing)
+}
+
+// startLost has a worker pop the job of id, mark it running and die
+func startLost(t *testing.T, repo Repository, id string) {
+	popped, err := repo.Pop(context.Background(), time.Millisecond, time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, id, popped)
+	_, err = repo.Update(context.Background(), id, func(j *domain.Job) error {
+		j.Status, j.Attempts = StatusRunning, j.Attempts+1
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestRunOkReapsJobLostWhileRunning(t *testing.T) {
+	repo := NewMemoryRepository()
+	service := NewService(repo, logging.Discard())
+	service.Register("export", func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		return "", nil
+	})
+
+	j, err := service.Enqueue(context.Background(), "export", nil)
+	assert.NoError(t, err)
+	startLost(t, repo, j.ID)
+
+	stop := start(service, time.Second)
+	j = waitStatus(t, service, j.ID, StatusSucceeded)
+	stop()
+
+	assert.Equal(t, 2, j.Attempts)
+	assert.Equal(t, []string{errWorkerLost.Error()}, j.Errors)
+	assert.Empty(t, repo.(*memoryRepository).processing)
+}
+
+func TestRunErrReapsLostJobWithoutAttemptsLeft(t *testing.T) {
+	repo := NewMemoryRepository()
+	service := NewService(repo, logging.Discard())
+	service.Register("export", func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		return "", nil
+	})
+
+	j, err := service.Enqueue(context.Background(), "export", nil)
+	assert.NoError(t, err)
+	_, err = repo.Update(context.Background(), j.ID, func(j *domain.Job) error {
+		j.MaxAttempts = 1
+		return nil
+	})
+	assert.NoError(t, err)
+	startLost(t, repo, j.ID)
+
+	stop := start(service, time.Second)
+	j = waitStatus(t, service, j.ID, StatusFailed)
+	stop()
+
+	assert.Equal(t, 1, j.Attempts)
+	assert.Equal(t, []string{j.ID}, repo.(*memoryRepository).dead)
+	assert.Empty(t, repo.(*memoryRepository).processing)
+}
+
+func TestGetErrOtherTenant(t *testing.T) {
+	service := NewService(NewMemoryRepository(), logging.Discard())
+	service.Register("export", func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		return "", nil
+	})
+	acme := tenant.WithID(context.Background(), "acme")
+	j, err := service.Enqueue(acme, "export", nil)
+	assert.NoError(t, err)
+
+	_, err = service.Get(acme, j.ID)
+	assert.NoError(t, err)
+	_, err = service.Get(context.Background(), j.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = service.Cancel(context.Background(), j.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestEnqueueErrUnknownType(t *testing.T) {
+	service := NewService(NewMemoryRepository(), logging.Discard())
+
+	_, err := service.Enqueue(context.Background(), "reindex", nil)
+
+	assert.ErrorIs(t, err, ErrUnknownType)
+}
+
+func TestRunOkContinuesTrace(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	service := NewService(NewMemoryRepository(), logging.Discard())
+	traces := make(chan string, 1)
+	service.Register("export", func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		traces <- tracing.TraceID(ctx)
+		return "", nil
+	})
+	stop := start(service, time.Second)
+	defer stop()
+
+	ctx, span := tracing.Start(context.Background(), "POST /products/export")
+	_, err := service.Enqueue(ctx, "export", nil)
+	span.End()
+	assert.NoError(t, err)
+
+	select {
+	case traceID := <-traces:
+		assert.Equal(t, span.SpanContext().TraceID().String(), traceID)
+	case <-time.After(time.Second):
+		t.Fatal("job did not run")
+	}
+}
@@ -0,0 +1,64 @@
+package live
+
+import (
+	"crypto/subtle"
+	"os"
+	"strings"
+
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+// Authenticator checks the token a socket client presents at the handshake
+// and returns the tenant the client follows
+type Authenticator interface {
+	Authenticate(token string) (string, bool)
+}
+
+type tokenAuthenticator []string
+
+// NewTokenAuthenticator accepts the device tokens listed, comma separated,
+// in LIVE_SOCKET_TOKENS, for the default tenant. With none configured every
+// handshake is refused.
+func NewTokenAuthenticator() Authenticator {
+	var tokens tokenAuthenticator
+	for _, t := range strings.Split(os.Getenv("LIVE_SOCKET_TOKENS"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+func (a tokenAuthenticator) Authenticate(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	ok := 0
+	for _, t := range a {
+		ok |= subtle.ConstantTimeCompare([]byte(t), []byte(token))
+	}
+	return tenant.Default, ok == 1
+}
+
+// AuthenticatorFunc adapts a func to Authenticator
+type AuthenticatorFunc func(token string) (string, bool)
+
+func (f AuthenticatorFunc) Authenticate(token string) (string, bool) {
+	return f(token)
+}
+
+type anyAuthenticator []Authenticator
+
+// AnyAuthenticator accepts the tokens any of auths accepts
+func AnyAuthenticator(auths ...Authenticator) Authenticator {
+	return anyAuthenticator(auths)
+}
+
+func (a anyAuthenticator) Authenticate(token string) (string, bool) {
+	for _, auth := range a {
+		if id, ok := auth.Authenticate(token); ok {
+			return id, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,132 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vincentconace/api-gin/internal/domain"
+)
+
+// Channel is the Redis channel the outbox relay broadcasts events on
+const Channel = "product-events:live"
+
+// Events buffered per subscriber before it is considered too slow
+const subscriberBuffer = 64
+
+// Filter picks the events of one tenant, of the listed products or of all
+// of them when none are
+type Filter struct {
+	Tenant     string
+	ProductIDs map[int]bool
+}
+
+func (f Filter) Match(e domain.Event) bool {
+	return e.Tenant == f.Tenant && (len(f.ProductIDs) == 0 || f.ProductIDs[e.AggregateID])
+}
+
+type subscription struct {
+	filter Filter
+	ch     chan domain.Event
+}
+
+// Hub fans the events broadcast on Channel out to the subscribers of this
+// replica, so each replica holds a single Redis subscription.
+type Hub struct {
+	log    *slog.Logger
+	mu     sync.Mutex
+	subs   map[*subscription]struct{}
+	closed bool
+	done   chan struct{}
+}
+
+func NewHub(log *slog.Logger) *Hub {
+	return &Hub{log: log, subs: map[*subscription]struct{}{}, done: make(chan struct{})}
+}
+
+// Done is closed once the hub stops
+func (h *Hub) Done() <-chan struct{} {
+	return h.done
+}
+
+// Run relays Channel to subscribers until ctx is done, then ends every
+// subscription
+func (h *Hub) Run(ctx context.Context, rd *redis.Client) {
+	defer h.closeAll()
+	pubsub := rd.Subscribe(ctx, Channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var e domain.Event
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				h.log.Warn("skip malformed live event", "error", err)
+				continue
+			}
+			h.Broadcast(e)
+		}
+	}
+}
+
+// Subscribe returns the events matching filter and a func to stop. The
+// channel is closed when the hub stops or the subscriber falls behind, the
+// client is expected to reconnect and resume from its last event.
+func (h *Hub) Subscribe(filter Filter) (<-chan domain.Event, func()) {
+	s := &subscription{filter: filter, ch: make(chan domain.Event, subscriberBuffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(s.ch)
+		return s.ch, func() {}
+	}
+	h.subs[s] = struct{}{}
+	return s.ch, func() { h.remove(s) }
+}
+
+func (h *Hub) Broadcast(e domain.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		if !s.filter.Match(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			delete(h.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+func (h *Hub) remove(s *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
+
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	close(h.done)
+	for s := range h.subs {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
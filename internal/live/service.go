@@ -0,0 +1,92 @@
+package live
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/gorilla/websocket"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/outbox"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+const replayBatch = 500
+
+type Service interface {
+	// Subscribe streams the events of the tenant of ctx matching filter
+	// until ctx is done or the returned channel closes. Events published
+	// after lastEventID are replayed from the outbox first, so a
+	// reconnecting client misses none.
+	Subscribe(ctx context.Context, lastEventID int64, filter Filter) <-chan domain.Event
+	// ServeSocket lets a WebSocket client follow stock and price changes
+	// of the products of the tenant of ctx it subscribes to
+	ServeSocket(ctx context.Context, conn *websocket.Conn)
+}
+
+type service struct {
+	hub    *Hub
+	events outbox.Repository
+	log    *slog.Logger
+}
+
+func NewService(hub *Hub, events outbox.Repository, log *slog.Logger) Service {
+	return &service{hub: hub, events: events, log: log}
+}
+
+func (s *service) Subscribe(ctx context.Context, lastEventID int64, filter Filter) <-chan domain.Event {
+	// Subscribe before replaying so nothing published in between is lost,
+	// live events already replayed are skipped by id
+	filter.Tenant = tenant.FromContext(ctx)
+	live, stop := s.hub.Subscribe(filter)
+	out := make(chan domain.Event)
+	go func() {
+		defer close(out)
+		defer stop()
+
+		last := lastEventID
+		for last > 0 {
+			events, err := s.events.Published(ctx, last, replayBatch)
+			if err != nil {
+				s.log.ErrorContext(ctx, "replay live events", "after", last, "error", err)
+				return
+			}
+			for _, e := range events {
+				last = e.ID
+				if filter.Match(e) && !send(ctx, out, e) {
+					return
+				}
+			}
+			if len(events) < replayBatch {
+				break
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-live:
+				if !ok {
+					return
+				}
+				if e.ID <= last {
+					continue
+				}
+				last = e.ID
+				if !send(ctx, out, e) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+func send(ctx context.Context, out chan<- domain.Event, e domain.Event) bool {
+	select {
+	case out <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,89 @@
+package live
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/outbox"
+	"github.com/vincentconace/api-gin/pkg/logging"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+// eventsStub holds published events with ids 1 to n
+type eventsStub struct {
+	outbox.Repository
+	events []domain.Event
+}
+
+func (r *eventsStub) Published(ctx context.Context, afterID int64, limit int) ([]domain.Event, error) {
+	var events []domain.Event
+	for _, e := range r.events {
+		if e.ID > afterID && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func newEvent(id int64, productID int) domain.Event {
+	return domain.Event{ID: id, Tenant: tenant.Default, AggregateType: "product", AggregateID: productID, Type: outbox.StockChanged}
+}
+
+func receive(t *testing.T, ch <-chan domain.Event) domain.Event {
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return domain.Event{}
+	}
+}
+
+func TestSubscribeReplayThenLiveOk(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := NewHub(logging.Discard())
+	repo := &eventsStub{events: []domain.Event{newEvent(1, 1), newEvent(2, 2), newEvent(3, 1)}}
+	events := NewService(hub, repo, logging.Discard()).Subscribe(ctx, 1, Filter{ProductIDs: map[int]bool{1: true}})
+
+	assert.Equal(t, int64(3), receive(t, events).ID)
+	// Already replayed
+	hub.Broadcast(newEvent(3, 1))
+	hub.Broadcast(newEvent(4, 2))
+	hub.Broadcast(newEvent(5, 1))
+	assert.Equal(t, int64(5), receive(t, events).ID)
+}
+
+func TestSubscribeOkSkipsOtherTenants(t *testing.T) {
+	ctx, cancel := context.WithCancel(tenant.WithID(context.Background(), "acme"))
+	defer cancel()
+
+	hub := NewHub(logging.Discard())
+	events := NewService(hub, &eventsStub{}, logging.Discard()).Subscribe(ctx, 0, Filter{})
+
+	hub.Broadcast(newEvent(1, 1))
+	acme := newEvent(2, 1)
+	acme.Tenant = "acme"
+	hub.Broadcast(acme)
+	assert.Equal(t, int64(2), receive(t, events).ID)
+}
+
+func TestHubDropsSlowSubscriber(t *testing.T) {
+	hub := NewHub(logging.Discard())
+	events, stop := hub.Subscribe(Filter{Tenant: tenant.Default})
+	defer stop()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		hub.Broadcast(newEvent(int64(i+1), 1))
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+	assert.Equal(t, subscriberBuffer, received)
+}
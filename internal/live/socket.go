@@ -0,0 +1,206 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/outbox"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+// Socket message types
+const (
+	MessageSubscribe   = "subscribe"
+	MessageUnsubscribe = "unsubscribe"
+	MessageSubscribed  = "subscribed"
+	MessageStock       = "stock"
+	MessagePrice       = "price"
+	MessageError       = "error"
+)
+
+const (
+	maxSubscribedIDs    = 1000
+	maxClientMessage    = 16 << 10
+	pendingRequests     = 8
+	socketWriteWait     = 10 * time.Second
+	socketPongWait      = 60 * time.Second
+	socketPingPeriod    = socketPongWait * 9 / 10
+	closeReasonTooSlow  = "too slow, reconnect and subscribe again"
+	closeReasonShutdown = "server shutting down"
+)
+
+// Request is sent by clients to change the products they follow
+type Request struct {
+	Type       string `json:"type"`
+	ProductIDs []int  `json:"product_ids"`
+}
+
+// Message is sent to clients. Subscribed lists every product followed
+// after a request, stock and price messages describe one change.
+type Message struct {
+	Type       string   `json:"type"`
+	EventID    int64    `json:"event_id,omitempty"`
+	ProductID  int      `json:"product_id,omitempty"`
+	Stock      *int     `json:"stock,omitempty"`
+	Delta      *int     `json:"delta,omitempty"`
+	Price      *float64 `json:"price,omitempty"`
+	OldPrice   *float64 `json:"old_price,omitempty"`
+	ProductIDs []int    `json:"product_ids,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// ServeSocket runs the subscription protocol on conn until the client
+// leaves or ctx is done. Writes happen on this goroutine only; a client
+// that can't keep up fills its hub buffer and gets disconnected.
+func (s *service) ServeSocket(ctx context.Context, conn *websocket.Conn) {
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events, stop := s.hub.Subscribe(Filter{Tenant: tenant.FromContext(ctx)})
+	defer stop()
+
+	requests := make(chan Request, pendingRequests)
+	go readRequests(ctx, conn, requests)
+
+	ping := time.NewTicker(socketPingPeriod)
+	defer ping.Stop()
+
+	products := map[int]bool{}
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.hub.Done():
+			closeSocket(conn, websocket.CloseGoingAway, closeReasonShutdown)
+			return
+		case req, ok := <-requests:
+			if !ok {
+				return
+			}
+			err = writeMessage(conn, applyRequest(products, req))
+		case e, ok := <-events:
+			if !ok {
+				reason := closeReasonTooSlow
+				select {
+				case <-s.hub.Done():
+					reason = closeReasonShutdown
+				default:
+				}
+				closeSocket(conn, websocket.CloseTryAgainLater, reason)
+				return
+			}
+			if !products[e.AggregateID] {
+				continue
+			}
+			if m, ok := toMessage(e); ok {
+				err = writeMessage(conn, m)
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			err = conn.WriteMessage(websocket.PingMessage, nil)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readRequests decodes client requests until the connection fails, which
+// includes missing pongs for longer than socketPongWait, and then closes
+// requests
+func readRequests(ctx context.Context, conn *websocket.Conn, requests chan<- Request) {
+	defer close(requests)
+	conn.SetReadLimit(maxClientMessage)
+	conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		// Malformed requests get an error reply through applyRequest
+		var req Request
+		json.Unmarshal(data, &req)
+		select {
+		case requests <- req:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func applyRequest(products map[int]bool, req Request) Message {
+	switch req.Type {
+	case MessageSubscribe:
+		if len(products)+len(req.ProductIDs) > maxSubscribedIDs {
+			return Message{Type: MessageError, Error: "too many products, unsubscribe some first"}
+		}
+		for _, id := range req.ProductIDs {
+			products[id] = true
+		}
+	case MessageUnsubscribe:
+		for _, id := range req.ProductIDs {
+			delete(products, id)
+		}
+	default:
+		return Message{Type: MessageError, Error: "type must be subscribe or unsubscribe"}
+	}
+
+	ids := make([]int, 0, len(products))
+	for id := range products {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return Message{Type: MessageSubscribed, ProductIDs: ids}
+}
+
+// toMessage describes the stock or price change in e, if any. Stock
+// written through a product update comes as its own StockChanged event.
+func toMessage(e domain.Event) (Message, bool) {
+	m := Message{EventID: e.ID, ProductID: e.AggregateID}
+	switch e.Type {
+	case outbox.StockChanged:
+		var p outbox.StockChangedPayload
+		if err := json.Unmarshal(e.Payload, &p); err != nil {
+			return m, false
+		}
+		m.Type, m.Stock, m.Delta = MessageStock, &p.StockAfter, &p.Delta
+		return m, true
+	case outbox.ProductUpdated:
+		var p outbox.ProductUpdatedPayload
+		if err := json.Unmarshal(e.Payload, &p); err != nil {
+			return m, false
+		}
+		change, ok := p.Changes["price"]
+		if !ok {
+			return m, false
+		}
+		m.Type = MessagePrice
+		if price, ok := change.New.(float64); ok {
+			m.Price = &price
+		}
+		if old, ok := change.Old.(float64); ok {
+			m.OldPrice = &old
+		}
+		return m, true
+	}
+	return m, false
+}
+
+func writeMessage(conn *websocket.Conn, m Message) error {
+	conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return conn.WriteJSON(m)
+}
+
+func closeSocket(conn *websocket.Conn, code int, reason string) {
+	deadline := time.Now().Add(socketWriteWait)
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+}
@@ -0,0 +1,74 @@
+package live
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/outbox"
+	"github.com/vincentconace/api-gin/pkg/logging"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+func dialSocket(t *testing.T, hub *Hub) *websocket.Conn {
+	upgrader := websocket.Upgrader{}
+	service := NewService(hub, &eventsStub{}, logging.Discard())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		service.ServeSocket(context.Background(), conn)
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when dialing the socket", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	return conn
+}
+
+// stockChanged is a StockChanged event of the default tenant
+func stockChanged(m domain.StockMovement) domain.Event {
+	e := outbox.NewStockChanged(m)
+	e.Tenant = tenant.Default
+	return e
+}
+
+func TestServeSocketOk(t *testing.T) {
+	hub := NewHub(logging.Discard())
+	conn := dialSocket(t, hub)
+
+	var m Message
+	assert.NoError(t, conn.WriteJSON(Request{Type: MessageSubscribe, ProductIDs: []int{1}}))
+	assert.NoError(t, conn.ReadJSON(&m))
+	assert.Equal(t, Message{Type: MessageSubscribed, ProductIDs: []int{1}}, m)
+
+	hub.Broadcast(stockChanged(domain.StockMovement{ProductID: 2, Delta: 1, StockAfter: 4}))
+	hub.Broadcast(stockChanged(domain.StockMovement{ProductID: 1, Delta: -2, StockAfter: 8}))
+
+	m = Message{}
+	assert.NoError(t, conn.ReadJSON(&m))
+	assert.Equal(t, MessageStock, m.Type)
+	assert.Equal(t, 1, m.ProductID)
+	assert.Equal(t, 8, *m.Stock)
+	assert.Equal(t, -2, *m.Delta)
+}
+
+func TestServeSocketErrUnknownRequest(t *testing.T) {
+	conn := dialSocket(t, NewHub(logging.Discard()))
+
+	var m Message
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"follow"}`)))
+	assert.NoError(t, conn.ReadJSON(&m))
+	assert.Equal(t, MessageError, m.Type)
+}
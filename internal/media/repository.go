@@ -0,0 +1,149 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/db"
+)
+
+type Repository interface {
+	GetByProduct(ctx context.Context, productID int) ([]domain.Media, error)
+	GetByProducts(ctx context.Context, productIDs []int) (map[int][]domain.Media, error)
+	GetById(ctx context.Context, id int) (domain.Media, error)
+	Save(ctx context.Context, m domain.Media) (int, error)
+	Update(ctx context.Context, m domain.Media) error
+	ClearPrimary(ctx context.Context, productID int) error
+	Delete(ctx context.Context, id int) error
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// conn joins the transaction active in ctx, if any, labelling its
+// statements with the repository method op
+func (r *repository) conn(ctx context.Context, op string) db.Executor {
+	return db.Conn(ctx, r.db, "media", op)
+}
+
+// Query all product media
+var (
+	mediaColumns            = `id, product_id, storage_key, file_name, content_type, size, position, is_primary`
+	getMediaByProductQuery  = `SELECT ` + mediaColumns + ` FROM product_media WHERE product_id = ? ORDER BY position, id`
+	getMediaByProductsQuery = `SELECT ` + mediaColumns + ` FROM product_media WHERE product_id IN (%s) ORDER BY product_id, position, id`
+	getMediaByIdQuery       = `SELECT ` + mediaColumns + ` FROM product_media WHERE id = ?`
+	createMediaQuery        = `INSERT INTO product_media (product_id, storage_key, file_name, content_type, size, position, is_primary) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	updateMediaQuery        = `UPDATE product_media SET position = ?, is_primary = ? WHERE id = ?`
+	clearPrimaryMediaQuery  = `UPDATE product_media SET is_primary = FALSE WHERE product_id = ?`
+	deleteMediaQuery        = `DELETE FROM product_media WHERE id = ?`
+)
+
+func (r *repository) GetByProduct(ctx context.Context, productID int) ([]domain.Media, error) {
+	rows, err := r.conn(ctx, "GetByProduct").QueryContext(ctx, getMediaByProductQuery, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var media []domain.Media
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+	return media, rows.Err()
+}
+
+func (r *repository) GetByProducts(ctx context.Context, productIDs []int) (map[int][]domain.Media, error) {
+	result := make(map[int][]domain.Media)
+	if len(productIDs) == 0 {
+		return result, nil
+	}
+
+	args := make([]interface{}, len(productIDs))
+	for i, id := range productIDs {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(productIDs)), ", ")
+	query := fmt.Sprintf(getMediaByProductsQuery, placeholders)
+
+	rows, err := r.conn(ctx, "GetByProducts").QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[m.ProductID] = append(result[m.ProductID], m)
+	}
+	return result, rows.Err()
+}
+
+func (r *repository) GetById(ctx context.Context, id int) (domain.Media, error) {
+	m, err := scanMedia(r.conn(ctx, "GetById").QueryRowContext(ctx, getMediaByIdQuery, id))
+	if err == sql.ErrNoRows {
+		return m, ErrNotFound
+	}
+	return m, err
+}
+
+func (r *repository) Save(ctx context.Context, m domain.Media) (int, error) {
+	res, err := r.conn(ctx, "Save").ExecContext(ctx, createMediaQuery, m.ProductID, m.StorageKey, m.FileName, m.ContentType, m.Size, m.Position, m.IsPrimary)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *repository) Update(ctx context.Context, m domain.Media) error {
+	_, err := r.conn(ctx, "Update").ExecContext(ctx, updateMediaQuery, m.Position, m.IsPrimary, m.ID)
+	return err
+}
+
+func (r *repository) ClearPrimary(ctx context.Context, productID int) error {
+	_, err := r.conn(ctx, "ClearPrimary").ExecContext(ctx, clearPrimaryMediaQuery, productID)
+	return err
+}
+
+func (r *repository) Delete(ctx context.Context, id int) error {
+	res, err := r.conn(ctx, "Delete").ExecContext(ctx, deleteMediaQuery, id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMedia(s scanner) (domain.Media, error) {
+	var m domain.Media
+	err := s.Scan(&m.ID, &m.ProductID, &m.StorageKey, &m.FileName, &m.ContentType, &m.Size, &m.Position, &m.IsPrimary)
+	return m, err
+}
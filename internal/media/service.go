@@ -0,0 +1,283 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/pkg/blob"
+)
+
+type Service interface {
+	Upload(ctx context.Context, productID int, fileName string, r io.Reader) (domain.Media, error)
+	List(ctx context.Context, productID int) ([]domain.Media, error)
+	Update(ctx context.Context, productID, mediaID int, position *int, primary *bool) (domain.Media, error)
+	Delete(ctx context.Context, productID, mediaID int) error
+	Attach(ctx context.Context, products ...*domain.Product) error
+}
+
+// Maximum size in bytes of a single uploaded file
+const MaxSize = 10 << 20
+
+var (
+	ErrNotFound             = errors.New("media not found")
+	ErrTooLarge             = fmt.Errorf("file exceeds the maximum size of %d MB", MaxSize>>20)
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrInvalidImage         = errors.New("invalid image")
+)
+
+// Sniffed content types accepted for upload and the extension used to store them
+var allowedTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"application/pdf": ".pdf",
+}
+
+type service struct {
+	repo        Repository
+	productRepo product.Repository
+	store       blob.Store
+}
+
+func NewService(repo Repository, productRepo product.Repository, store blob.Store) Service {
+	return &service{repo: repo, productRepo: productRepo, store: store}
+}
+
+func (s *service) Upload(ctx context.Context, productID int, fileName string, r io.Reader) (domain.Media, error) {
+	if _, err := s.productRepo.GetById(ctx, productID); err != nil {
+		return domain.Media{}, product.ErrNotFound
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return domain.Media{}, err
+	}
+	if len(data) > MaxSize {
+		return domain.Media{}, ErrTooLarge
+	}
+
+	contentType := strings.Split(http.DetectContentType(data), ";")[0]
+	ext, ok := allowedTypes[contentType]
+	if !ok {
+		return domain.Media{}, ErrUnsupportedMediaType
+	}
+
+	var thumbnails map[string][]byte
+	if isImage(contentType) {
+		thumbnails, err = generateThumbnails(data)
+		if err != nil {
+			return domain.Media{}, ErrInvalidImage
+		}
+	}
+
+	existing, err := s.repo.GetByProduct(ctx, productID)
+	if err != nil {
+		return domain.Media{}, err
+	}
+	m := domain.Media{
+		ProductID:   productID,
+		StorageKey:  fmt.Sprintf("products/%d/%s%s", productID, randomName(), ext),
+		FileName:    path.Base(strings.ReplaceAll(fileName, "\\", "/")),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		IsPrimary:   len(existing) == 0,
+	}
+	if len(existing) > 0 {
+		m.Position = existing[len(existing)-1].Position + 1
+	}
+
+	if err := s.store.Put(ctx, m.StorageKey, bytes.NewReader(data), contentType); err != nil {
+		return domain.Media{}, err
+	}
+	for name, thumb := range thumbnails {
+		if err := s.store.Put(ctx, thumbnailKey(m.StorageKey, name), bytes.NewReader(thumb), "image/jpeg"); err != nil {
+			s.deleteBlobs(ctx, m)
+			return domain.Media{}, err
+		}
+	}
+
+	id, err := s.repo.Save(ctx, m)
+	if err != nil {
+		s.deleteBlobs(ctx, m)
+		return domain.Media{}, err
+	}
+	m.ID = id
+	s.decorate(&m)
+	return m, nil
+}
+
+func (s *service) List(ctx context.Context, productID int) ([]domain.Media, error) {
+	if _, err := s.productRepo.GetById(ctx, productID); err != nil {
+		return nil, product.ErrNotFound
+	}
+	media, err := s.repo.GetByProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range media {
+		s.decorate(&media[i])
+	}
+	return media, nil
+}
+
+func (s *service) Update(ctx context.Context, productID, mediaID int, position *int, primary *bool) (domain.Media, error) {
+	m, err := s.get(ctx, productID, mediaID)
+	if err != nil {
+		return domain.Media{}, err
+	}
+
+	if primary != nil {
+		if *primary {
+			if err := s.repo.ClearPrimary(ctx, productID); err != nil {
+				return domain.Media{}, err
+			}
+		}
+		m.IsPrimary = *primary
+		if err := s.repo.Update(ctx, m); err != nil {
+			return domain.Media{}, err
+		}
+	}
+
+	if position != nil {
+		if m, err = s.move(ctx, m, *position); err != nil {
+			return domain.Media{}, err
+		}
+	}
+
+	s.decorate(&m)
+	return m, nil
+}
+
+func (s *service) Delete(ctx context.Context, productID, mediaID int) error {
+	m, err := s.get(ctx, productID, mediaID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, m.ID); err != nil {
+		return err
+	}
+	s.deleteBlobs(ctx, m)
+
+	// Promote the next image so the product keeps a primary one
+	if !m.IsPrimary {
+		return nil
+	}
+	remaining, err := s.repo.GetByProduct(ctx, productID)
+	if err != nil || len(remaining) == 0 {
+		return err
+	}
+	remaining[0].IsPrimary = true
+	return s.repo.Update(ctx, remaining[0])
+}
+
+func (s *service) Attach(ctx context.Context, products ...*domain.Product) error {
+	ids := make([]int, 0, len(products))
+	for _, p := range products {
+		if p.ID != nil {
+			ids = append(ids, *p.ID)
+		}
+	}
+	media, err := s.repo.GetByProducts(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, p := range products {
+		if p.ID == nil {
+			continue
+		}
+		p.Media = media[*p.ID]
+		for i := range p.Media {
+			s.decorate(&p.Media[i])
+		}
+	}
+	return nil
+}
+
+func (s *service) get(ctx context.Context, productID, mediaID int) (domain.Media, error) {
+	m, err := s.repo.GetById(ctx, mediaID)
+	if err != nil {
+		return domain.Media{}, err
+	}
+	if m.ProductID != productID {
+		return domain.Media{}, ErrNotFound
+	}
+	return m, nil
+}
+
+// move places m at the given index of the product's media and renumbers
+// the rest so positions stay contiguous.
+func (s *service) move(ctx context.Context, m domain.Media, position int) (domain.Media, error) {
+	all, err := s.repo.GetByProduct(ctx, m.ProductID)
+	if err != nil {
+		return m, err
+	}
+	ordered := make([]domain.Media, 0, len(all))
+	for _, other := range all {
+		if other.ID != m.ID {
+			ordered = append(ordered, other)
+		}
+	}
+	if position < 0 {
+		position = 0
+	}
+	if position > len(ordered) {
+		position = len(ordered)
+	}
+	ordered = append(ordered[:position], append([]domain.Media{m}, ordered[position:]...)...)
+
+	for i := range ordered {
+		if ordered[i].Position == i && ordered[i].ID != m.ID {
+			continue
+		}
+		ordered[i].Position = i
+		if err := s.repo.Update(ctx, ordered[i]); err != nil {
+			return m, err
+		}
+	}
+	m.Position = position
+	return m, nil
+}
+
+func (s *service) decorate(m *domain.Media) {
+	m.URL = s.store.URL(m.StorageKey)
+	if !isImage(m.ContentType) {
+		return
+	}
+	m.Thumbnails = make(map[string]string, len(ThumbnailSizes))
+	for name := range ThumbnailSizes {
+		m.Thumbnails[name] = s.store.URL(thumbnailKey(m.StorageKey, name))
+	}
+}
+
+func (s *service) deleteBlobs(ctx context.Context, m domain.Media) {
+	s.store.Delete(ctx, m.StorageKey)
+	if isImage(m.ContentType) {
+		for name := range ThumbnailSizes {
+			s.store.Delete(ctx, thumbnailKey(m.StorageKey, name))
+		}
+	}
+}
+
+func isImage(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/")
+}
+
+func thumbnailKey(key, size string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "_" + size + ".jpg"
+}
+
+func randomName() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
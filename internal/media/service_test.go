@@ -0,0 +1,103 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/product"
+	"github.com/vincentconace/api-gin/pkg/blob"
+)
+
+var ctx = context.Background()
+
+type productRepoStub struct {
+	product.Repository
+}
+
+func (productRepoStub) GetById(ctx context.Context, id int) (domain.Product, error) {
+	if id != 1 {
+		return domain.Product{}, product.ErrNotFound
+	}
+	return domain.Product{ID: &id}, nil
+}
+
+type mediaRepoStub struct {
+	Repository
+	saved []domain.Media
+}
+
+func (r *mediaRepoStub) GetByProduct(ctx context.Context, productID int) ([]domain.Media, error) {
+	return r.saved, nil
+}
+
+func (r *mediaRepoStub) Save(ctx context.Context, m domain.Media) (int, error) {
+	m.ID = len(r.saved) + 1
+	r.saved = append(r.saved, m)
+	return m.ID, nil
+}
+
+func newTestService(t *testing.T) (Service, blob.Store) {
+	store, err := blob.NewLocalStore(t.TempDir(), "/media")
+	assert.NoError(t, err)
+	return NewService(&mediaRepoStub{}, productRepoStub{}, store), store
+}
+
+func pngImage(w, h int) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)))
+	return buf.Bytes()
+}
+
+func TestUploadOk(t *testing.T) {
+	service, store := newTestService(t)
+
+	first, err := service.Upload(ctx, 1, "front.png", bytes.NewReader(pngImage(1200, 800)))
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", first.ContentType)
+	assert.True(t, first.IsPrimary)
+	assert.Equal(t, 0, first.Position)
+	assert.Len(t, first.Thumbnails, len(ThumbnailSizes))
+
+	r, err := store.Get(ctx, thumbnailKey(first.StorageKey, "small"))
+	assert.NoError(t, err)
+	thumb, _, err := image.Decode(r)
+	r.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, 150, thumb.Bounds().Dx())
+	assert.Equal(t, 100, thumb.Bounds().Dy())
+
+	second, err := service.Upload(ctx, 1, "back.png", bytes.NewReader(pngImage(10, 10)))
+	assert.NoError(t, err)
+	assert.False(t, second.IsPrimary)
+	assert.Equal(t, 1, second.Position)
+}
+
+func TestUploadErrUnsupportedMediaType(t *testing.T) {
+	service, _ := newTestService(t)
+
+	_, err := service.Upload(ctx, 1, "notes.txt", strings.NewReader("plain text"))
+
+	assert.ErrorIs(t, err, ErrUnsupportedMediaType)
+}
+
+func TestUploadErrTooLarge(t *testing.T) {
+	service, _ := newTestService(t)
+
+	_, err := service.Upload(ctx, 1, "big.pdf", bytes.NewReader(make([]byte, MaxSize+1)))
+
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestUploadErrProductNotFound(t *testing.T) {
+	service, _ := newTestService(t)
+
+	_, err := service.Upload(ctx, 2, "front.png", bytes.NewReader(pngImage(10, 10)))
+
+	assert.ErrorIs(t, err, product.ErrNotFound)
+}
@@ -0,0 +1,213 @@
+package order
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/inventory"
+	"github.com/vincentconace/api-gin/pkg/db"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+type Repository interface {
+	Get(ctx context.Context) ([]domain.Order, error)
+	GetById(ctx context.Context, id int) (domain.Order, error)
+	Create(ctx context.Context, o domain.Order) (domain.Order, error)
+	UpdateStatus(ctx context.Context, id int, status string, from []string, restoreStock bool) error
+}
+
+type repository struct {
+	db        *sql.DB
+	txm       db.TxManager
+	inventory inventory.Repository
+}
+
+func NewRepository(conn *sql.DB) Repository {
+	return &repository{db: conn, txm: db.NewTxManager(conn), inventory: inventory.NewRepository(conn)}
+}
+
+// conn joins the transaction active in ctx, if any, labelling its
+// statements with the repository method op
+func (r *repository) conn(ctx context.Context, op string) db.Executor {
+	return db.Conn(ctx, r.db, "order", op)
+}
+
+// Query all orders. Every query is scoped to the tenant of the context,
+// whose id is their first argument; order items follow their order.
+var (
+	getOrdersQuery         = `SELECT id, reference, status, total, created_at, updated_at FROM orders WHERE tenant_id = ? ORDER BY id DESC`
+	getOrderByIdQuery      = `SELECT id, reference, status, total, created_at, updated_at FROM orders WHERE tenant_id = ? AND id = ?`
+	lockOrderStatusQuery   = `SELECT status FROM orders WHERE tenant_id = ? AND id = ? FOR UPDATE`
+	getOrderItemsQuery     = `SELECT id, order_id, product_id, product_code, name, unit_price, quantity, subtotal FROM order_items WHERE order_id = ? ORDER BY id`
+	lockProductQuery       = `SELECT COALESCE(product_code, ''), COALESCE(name, ''), COALESCE(price, 0) FROM products WHERE tenant_id = ? AND id = ? FOR UPDATE`
+	createOrderQuery       = `INSERT INTO orders (tenant_id, reference, status, total, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`
+	createOrderItemQuery   = `INSERT INTO order_items (order_id, product_id, product_code, name, unit_price, quantity, subtotal) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	updateOrderStatusQuery = `UPDATE orders SET status = ?, updated_at = ? WHERE tenant_id = ? AND id = ?`
+)
+
+func (r *repository) Get(ctx context.Context) ([]domain.Order, error) {
+	rows, err := r.conn(ctx, "Get").QueryContext(ctx, getOrdersQuery, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []domain.Order{}
+	for rows.Next() {
+		var o domain.Order
+		if err := rows.Scan(&o.ID, &o.Reference, &o.Status, &o.Total, &o.CreatedAt, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+func (r *repository) GetById(ctx context.Context, id int) (domain.Order, error) {
+	var o domain.Order
+	err := r.conn(ctx, "GetById").QueryRowContext(ctx, getOrderByIdQuery, tenant.FromContext(ctx), id).Scan(&o.ID, &o.Reference, &o.Status, &o.Total, &o.CreatedAt, &o.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return o, ErrNotFound
+	}
+	if err != nil {
+		return o, err
+	}
+	o.Items, err = items(ctx, r.conn(ctx, "GetById"), id)
+	return o, err
+}
+
+// Create snapshots each product's code, name and price, inserts the order
+// and decrements stock in one transaction, so an order never exists
+// without its stock being taken.
+func (r *repository) Create(ctx context.Context, o domain.Order) (domain.Order, error) {
+	err := r.txm.WithinTx(ctx, func(ctx context.Context) error {
+		// Lock products in id order so concurrent orders can't deadlock
+		sorted := make([]int, len(o.Items))
+		for i := range o.Items {
+			sorted[i] = i
+		}
+		sort.Slice(sorted, func(a, b int) bool {
+			return o.Items[sorted[a]].ProductID < o.Items[sorted[b]].ProductID
+		})
+
+		o.Total = 0
+		for _, i := range sorted {
+			item := &o.Items[i]
+			err := r.conn(ctx, "Create").QueryRowContext(ctx, lockProductQuery, tenant.FromContext(ctx), item.ProductID).Scan(&item.ProductCode, &item.Name, &item.UnitPrice)
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("%w: %d", ErrProductNotFound, item.ProductID)
+			}
+			if err != nil {
+				return err
+			}
+			item.Subtotal = item.UnitPrice * float32(item.Quantity)
+			o.Total += item.Subtotal
+		}
+
+		res, err := r.conn(ctx, "Create").ExecContext(ctx, createOrderQuery, tenant.FromContext(ctx), o.Reference, o.Status, o.Total, o.CreatedAt, o.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		o.ID = int(id)
+
+		for _, i := range sorted {
+			item := &o.Items[i]
+			item.OrderID = o.ID
+			res, err := r.conn(ctx, "Create").ExecContext(ctx, createOrderItemQuery, item.OrderID, item.ProductID, item.ProductCode, item.Name, item.UnitPrice, item.Quantity, item.Subtotal)
+			if err != nil {
+				return err
+			}
+			itemID, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			item.ID = int(itemID)
+
+			_, err = r.inventory.Adjust(ctx, item.ProductID, 0, -item.Quantity, inventory.ReasonSale, reference(o.ID))
+			if err == inventory.ErrInsufficientStock {
+				return fmt.Errorf("%w: %d", ErrInsufficientStock, item.ProductID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return o, err
+}
+
+// UpdateStatus moves the order to status if its current status is one of
+// from, restoring the stock of every item when restoreStock is set.
+func (r *repository) UpdateStatus(ctx context.Context, id int, status string, from []string, restoreStock bool) error {
+	return r.txm.WithinTx(ctx, func(ctx context.Context) error {
+		var current string
+		err := r.conn(ctx, "UpdateStatus").QueryRowContext(ctx, lockOrderStatusQuery, tenant.FromContext(ctx), id).Scan(&current)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !contains(from, current) {
+			return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, current, status)
+		}
+
+		if _, err := r.conn(ctx, "UpdateStatus").ExecContext(ctx, updateOrderStatusQuery, status, time.Now().UTC(), tenant.FromContext(ctx), id); err != nil {
+			return err
+		}
+		if !restoreStock {
+			return nil
+		}
+
+		orderItems, err := items(ctx, r.conn(ctx, "UpdateStatus"), id)
+		if err != nil {
+			return err
+		}
+		for _, item := range orderItems {
+			_, err := r.inventory.Adjust(ctx, item.ProductID, 0, item.Quantity, inventory.ReasonOrderCancelled, reference(id))
+			if err != nil && err != inventory.ErrProductNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func items(ctx context.Context, q db.Executor, orderID int) ([]domain.OrderItem, error) {
+	rows, err := q.QueryContext(ctx, getOrderItemsQuery, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []domain.OrderItem
+	for rows.Next() {
+		var i domain.OrderItem
+		if err := rows.Scan(&i.ID, &i.OrderID, &i.ProductID, &i.ProductCode, &i.Name, &i.UnitPrice, &i.Quantity, &i.Subtotal); err != nil {
+			return nil, err
+		}
+		result = append(result, i)
+	}
+	return result, rows.Err()
+}
+
+func reference(orderID int) string {
+	return fmt.Sprintf("order:%d", orderID)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+var ctx = context.Background()
+
+var orderMock = domain.Order{
+	Reference: "cart-1",
+	Status:    StatusPending,
+	Items:     []domain.OrderItem{{ProductID: 1, Quantity: 2}},
+	CreatedAt: time.Now(),
+	UpdatedAt: time.Now(),
+}
+
+func TestCreateOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").WithArgs(tenant.Default, 1).
+		WillReturnRows(mock.NewRows([]string{"product_code", "name", "price"}).AddRow("PRO001", "Product 1", 2.5))
+	mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectExec("INSERT INTO order_items").
+		WithArgs(10, 1, "PRO001", "Product 1", float32(2.5), 2, float32(5)).WillReturnResult(sqlmock.NewResult(20, 1))
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").WithArgs(tenant.Default, 1).
+		WillReturnRows(mock.NewRows([]string{"stock"}).AddRow(10))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").WithArgs(tenant.Default, 1).
+		WillReturnRows(mock.NewRows([]string{"warehouse_id", "quantity"}).AddRow(3, 10))
+	mock.ExpectExec("INSERT INTO warehouse_stock").WithArgs(3, 1, -2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE products SET stock = GREATEST").WithArgs(1, 1, tenant.Default, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\?").WillReturnRows(mock.NewRows([]string{"stock"}).AddRow(8))
+	mock.ExpectExec("INSERT INTO inventory_ledger").
+		WithArgs(tenant.Default, 1, 3, -2, "sale", "order:10", 8, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(30, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	repository := NewRepository(db)
+	o, err := repository.Create(ctx, orderMock)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 10, o.ID)
+	assert.Equal(t, float32(5), o.Total)
+	assert.Equal(t, "Product 1", o.Items[0].Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateErrInsufficientStock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WillReturnRows(mock.NewRows([]string{"product_code", "name", "price"}).AddRow("PRO001", "Product 1", 2.5))
+	mock.ExpectExec("INSERT INTO orders").WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectExec("INSERT INTO order_items").WillReturnResult(sqlmock.NewResult(20, 1))
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WillReturnRows(mock.NewRows([]string{"stock"}).AddRow(1))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").
+		WillReturnRows(mock.NewRows([]string{"warehouse_id", "quantity"}).AddRow(3, 1))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	repository := NewRepository(db)
+	_, err = repository.Create(ctx, orderMock)
+
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateStatusErrInvalidTransition(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT status FROM orders WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WillReturnRows(mock.NewRows([]string{"status"}).AddRow(StatusShipped))
+	mock.ExpectRollback()
+
+	repository := NewRepository(db)
+	err = repository.UpdateStatus(ctx, 10, StatusCancelled, transitions[StatusCancelled], true)
+
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetByIdErrOtherTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	colums := []string{"id", "reference", "status", "total", "created_at", "updated_at"}
+	mock.ExpectQuery("SELECT (.+) FROM orders WHERE tenant_id = \\? AND id = \\?").
+		WithArgs("acme", 10).WillReturnRows(mock.NewRows(colums))
+
+	repository := NewRepository(db)
+	_, err = repository.GetById(tenant.WithID(ctx, "acme"), 10)
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateErrProductOfOtherTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs("acme", 1).WillReturnRows(mock.NewRows([]string{"product_code", "name", "price"}))
+	mock.ExpectRollback()
+
+	repository := NewRepository(db)
+	_, err = repository.Create(tenant.WithID(ctx, "acme"), orderMock)
+
+	assert.ErrorIs(t, err, ErrProductNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
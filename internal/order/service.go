@@ -0,0 +1,98 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+)
+
+type Service interface {
+	Get(ctx context.Context) ([]domain.Order, error)
+	GetById(ctx context.Context, id int) (domain.Order, error)
+	Create(ctx context.Context, reference string, items []domain.OrderItem) (domain.Order, error)
+	UpdateStatus(ctx context.Context, id int, status string) (domain.Order, error)
+}
+
+// Order statuses
+const (
+	StatusPending   = "pending"
+	StatusPaid      = "paid"
+	StatusShipped   = "shipped"
+	StatusCancelled = "cancelled"
+)
+
+// Allowed transitions, keyed by target status
+var transitions = map[string][]string{
+	StatusPaid:      {StatusPending},
+	StatusShipped:   {StatusPaid},
+	StatusCancelled: {StatusPending, StatusPaid},
+}
+
+var (
+	ErrNotFound          = errors.New("order not found")
+	ErrProductNotFound   = errors.New("product not found")
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrEmptyOrder        = errors.New("order must have at least one item")
+	ErrInvalidQuantity   = errors.New("item quantity must be greater than zero")
+	ErrInvalidStatus     = errors.New("invalid order status")
+	ErrInvalidTransition = errors.New("invalid status transition")
+)
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo}
+}
+
+func (s *service) Get(ctx context.Context) ([]domain.Order, error) {
+	return s.repo.Get(ctx)
+}
+
+func (s *service) GetById(ctx context.Context, id int) (domain.Order, error) {
+	return s.repo.GetById(ctx, id)
+}
+
+func (s *service) Create(ctx context.Context, reference string, items []domain.OrderItem) (domain.Order, error) {
+	if len(items) == 0 {
+		return domain.Order{}, ErrEmptyOrder
+	}
+
+	// Merge repeated products into a single line
+	merged := make([]domain.OrderItem, 0, len(items))
+	index := make(map[int]int, len(items))
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return domain.Order{}, ErrInvalidQuantity
+		}
+		if i, ok := index[item.ProductID]; ok {
+			merged[i].Quantity += item.Quantity
+			continue
+		}
+		index[item.ProductID] = len(merged)
+		merged = append(merged, domain.OrderItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+
+	now := time.Now().UTC()
+	return s.repo.Create(ctx, domain.Order{
+		Reference: reference,
+		Status:    StatusPending,
+		Items:     merged,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+}
+
+func (s *service) UpdateStatus(ctx context.Context, id int, status string) (domain.Order, error) {
+	from, ok := transitions[status]
+	if !ok {
+		return domain.Order{}, ErrInvalidStatus
+	}
+	if err := s.repo.UpdateStatus(ctx, id, status, from, status == StatusCancelled); err != nil {
+		return domain.Order{}, err
+	}
+	return s.repo.GetById(ctx, id)
+}
@@ -0,0 +1,112 @@
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+)
+
+// Event types
+const (
+	ProductCreated = "ProductCreated"
+	ProductUpdated = "ProductUpdated"
+	ProductDeleted = "ProductDeleted"
+	StockChanged   = "StockChanged"
+)
+
+const aggregateProduct = "product"
+
+type Change struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Payloads of the event types, ProductCreated carries the product itself
+type ProductUpdatedPayload struct {
+	ID      int               `json:"id"`
+	Changes map[string]Change `json:"changes"`
+}
+
+type ProductDeletedPayload struct {
+	ID int `json:"id"`
+}
+
+type StockChangedPayload struct {
+	ProductID   int    `json:"product_id"`
+	WarehouseID *int   `json:"warehouse_id,omitempty"`
+	Delta       int    `json:"delta"`
+	StockAfter  int    `json:"stock_after"`
+	Reason      string `json:"reason"`
+	Reference   string `json:"reference,omitempty"`
+}
+
+func NewProductCreated(p domain.Product) domain.Event {
+	return newEvent(ProductCreated, *p.ID, p)
+}
+
+// NewProductUpdated returns the event for the fields that differ between
+// before and after, and false when nothing changed
+func NewProductUpdated(before, after domain.Product) (domain.Event, bool) {
+	changes := map[string]Change{}
+	diff := func(field string, o, n interface{}) {
+		if o != n {
+			changes[field] = Change{Old: o, New: n}
+		}
+	}
+	diff("product_code", deref(before.ProductCode), deref(after.ProductCode))
+	diff("name", deref(before.Name), deref(after.Name))
+	diff("description", deref(before.Description), deref(after.Description))
+	diff("price", deref(before.Price), deref(after.Price))
+	diff("stock", deref(before.Stock), deref(after.Stock))
+	if len(changes) == 0 {
+		return domain.Event{}, false
+	}
+	return newEvent(ProductUpdated, *before.ID, ProductUpdatedPayload{ID: *before.ID, Changes: changes}), true
+}
+
+func NewProductDeleted(id int) domain.Event {
+	return newEvent(ProductDeleted, id, ProductDeletedPayload{ID: id})
+}
+
+func NewStockChanged(m domain.StockMovement) domain.Event {
+	return newEvent(StockChanged, m.ProductID, StockChangedPayload{
+		ProductID:   m.ProductID,
+		WarehouseID: m.WarehouseID,
+		Delta:       m.Delta,
+		StockAfter:  m.StockAfter,
+		Reason:      m.Reason,
+		Reference:   m.Reference,
+	})
+}
+
+func newEvent(eventType string, aggregateID int, payload interface{}) domain.Event {
+	// Payloads are plain structs, marshalling them can't fail
+	data, _ := json.Marshal(payload)
+	return domain.Event{
+		AggregateType: aggregateProduct,
+		AggregateID:   aggregateID,
+		Type:          eventType,
+		Payload:       data,
+		CreatedAt:     time.Now().UTC(),
+	}
+}
+
+// deref returns the value behind a nullable column, or nil
+func deref(v interface{}) interface{} {
+	switch p := v.(type) {
+	case *string:
+		if p != nil {
+			return *p
+		}
+	case *int:
+		if p != nil {
+			return *p
+		}
+	case *float32:
+		if p != nil {
+			return *p
+		}
+	}
+	return nil
+}
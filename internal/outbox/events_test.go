@@ -0,0 +1,34 @@
+package outbox
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+)
+
+func TestNewProductUpdatedOk(t *testing.T) {
+	id, name, stock, newStock := 1, "Product 1", 10, 4
+	before := domain.Product{ID: &id, Name: &name, Stock: &stock}
+	after := domain.Product{ID: &id, Name: &name, Stock: &newStock}
+
+	e, ok := NewProductUpdated(before, after)
+
+	assert.True(t, ok)
+	assert.Equal(t, ProductUpdated, e.Type)
+	var payload struct {
+		Changes map[string]Change `json:"changes"`
+	}
+	assert.NoError(t, json.Unmarshal(e.Payload, &payload))
+	assert.Equal(t, map[string]Change{"stock": {Old: float64(10), New: float64(4)}}, payload.Changes)
+}
+
+func TestNewProductUpdatedErrNoChanges(t *testing.T) {
+	id, name := 1, "Product 1"
+	p := domain.Product{ID: &id, Name: &name}
+
+	_, ok := NewProductUpdated(p, p)
+
+	assert.False(t, ok)
+}
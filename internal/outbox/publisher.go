@@ -0,0 +1,84 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/vincentconace/api-gin/internal/domain"
+)
+
+// Publisher delivers events to a broker
+type Publisher interface {
+	Publish(ctx context.Context, e domain.Event) error
+}
+
+type redisStreamPublisher struct {
+	rd     *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewRedisStreamPublisher appends events to a Redis stream trimmed to
+// roughly maxLen entries. Consumers dedupe on the event_id field, since a
+// relay crash between publishing and marking can deliver an event twice.
+func NewRedisStreamPublisher(rd *redis.Client, stream string, maxLen int64) Publisher {
+	return &redisStreamPublisher{rd: rd, stream: stream, maxLen: maxLen}
+}
+
+func (p *redisStreamPublisher) Publish(ctx context.Context, e domain.Event) error {
+	return p.rd.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		MaxLen: p.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"event_id":       strconv.FormatInt(e.ID, 10),
+			"tenant":         e.Tenant,
+			"type":           e.Type,
+			"aggregate_type": e.AggregateType,
+			"aggregate_id":   strconv.Itoa(e.AggregateID),
+			"payload":        string(e.Payload),
+			"created_at":     e.CreatedAt.Format(time.RFC3339Nano),
+		},
+	}).Err()
+}
+
+type redisPubSubPublisher struct {
+	rd      *redis.Client
+	channel string
+}
+
+// NewRedisPubSubPublisher broadcasts events as JSON on a Redis channel.
+// Delivery is best effort, subscribers that miss messages catch up from
+// the outbox.
+func NewRedisPubSubPublisher(rd *redis.Client, channel string) Publisher {
+	return &redisPubSubPublisher{rd: rd, channel: channel}
+}
+
+func (p *redisPubSubPublisher) Publish(ctx context.Context, e domain.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return p.rd.Publish(ctx, p.channel, data).Err()
+}
+
+type fanoutPublisher []Publisher
+
+// NewFanoutPublisher publishes every event to each of publishers in turn.
+// A failure retries the event on all of them, so they must tolerate
+// duplicates.
+func NewFanoutPublisher(publishers ...Publisher) Publisher {
+	return fanoutPublisher(publishers)
+}
+
+func (f fanoutPublisher) Publish(ctx context.Context, e domain.Event) error {
+	for _, p := range f {
+		if err := p.Publish(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+)
+
+// claimLease is how long a relay owns the events it claimed, after it
+// runs out another relay publishes them again
+var claimLease = time.Minute
+
+// Relay publishes outbox events in order with at-least-once delivery
+type Relay struct {
+	repo      Repository
+	publisher Publisher
+	log       *slog.Logger
+	interval  time.Duration
+	batchSize int
+}
+
+func NewRelay(repo Repository, publisher Publisher, interval time.Duration, batchSize int, log *slog.Logger) *Relay {
+	return &Relay{repo: repo, publisher: publisher, log: log, interval: interval, batchSize: batchSize}
+}
+
+// Run relays pending events every interval until ctx is done, draining
+// the backlog a batch at a time.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := r.RelayBatch(ctx)
+			if err != nil {
+				r.log.Error("relay outbox events", "error", err)
+			}
+			if err != nil || n < r.batchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch publishes the oldest pending events. They are claimed for a
+// lease first, so no lock is held while publishing and relays on other
+// instances skip them instead of publishing out of order. Publishing
+// stops at the first failure, the events published before it are marked
+// and the rest are released for the next batch.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	events, err := r.repo.Claim(ctx, r.batchSize, time.Now().UTC().Add(claimLease))
+	if err != nil {
+		return 0, err
+	}
+
+	var published []int64
+	var publishErr error
+	for i, e := range events {
+		if err := r.publisher.Publish(ctx, e); err != nil {
+			publishErr = fmt.Errorf("publish event %d: %w", e.ID, err)
+			if err := r.repo.Release(ctx, eventIDs(events[i:])); err != nil {
+				r.log.ErrorContext(ctx, "release outbox events", "error", err)
+			}
+			break
+		}
+		published = append(published, e.ID)
+	}
+	if err := r.repo.MarkPublished(ctx, published, time.Now().UTC()); err != nil {
+		return 0, err
+	}
+	return len(published), publishErr
+}
+
+func eventIDs(events []domain.Event) []int64 {
+	ids := make([]int64, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	return ids
+}
@@ -0,0 +1,122 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/logging"
+)
+
+var ctx = context.Background()
+
+type stubPublisher struct {
+	published []int64
+	failOn    int64
+}
+
+func (p *stubPublisher) Publish(ctx context.Context, e domain.Event) error {
+	if e.ID == p.failOn {
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, e.ID)
+	return nil
+}
+
+func pendingRows(mock sqlmock.Sqlmock, ids ...int64) *sqlmock.Rows {
+	rows := mock.NewRows([]string{"id", "tenant_id", "aggregate_type", "aggregate_id", "type", "payload", "created_at", "claimed_until"})
+	for _, id := range ids {
+		rows.AddRow(id, "acme", "product", 1, ProductDeleted, []byte(`{"id":1}`), time.Now(), nil)
+	}
+	return rows
+}
+
+func TestRelayBatchOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM outbox_events WHERE published_at IS NULL ORDER BY id LIMIT \\? FOR UPDATE").
+		WithArgs(10).WillReturnRows(pendingRows(mock, 1, 2))
+	mock.ExpectExec("UPDATE outbox_events SET claimed_until = \\? WHERE id IN \\(\\?, \\?\\)").
+		WithArgs(sqlmock.AnyArg(), 1, 2).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	// Published after the claim commits
+	mock.ExpectExec("UPDATE outbox_events SET published_at = \\? WHERE id IN \\(\\?, \\?\\)").
+		WithArgs(sqlmock.AnyArg(), 1, 2).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	publisher := &stubPublisher{}
+	relay := NewRelay(NewRepository(db), publisher, time.Second, 10, logging.Discard())
+	n, err := relay.RelayBatch(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []int64{1, 2}, publisher.published)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayBatchErrPublishKeepsOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM outbox_events").WillReturnRows(pendingRows(mock, 1, 2, 3))
+	mock.ExpectExec("UPDATE outbox_events SET claimed_until = \\?").
+		WithArgs(sqlmock.AnyArg(), 1, 2, 3).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+	mock.ExpectExec("UPDATE outbox_events SET claimed_until = \\? WHERE id IN \\(\\?, \\?\\)").
+		WithArgs(nil, 2, 3).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE outbox_events SET published_at = \\? WHERE id IN \\(\\?\\)").
+		WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	publisher := &stubPublisher{failOn: 2}
+	relay := NewRelay(NewRepository(db), publisher, time.Second, 10, logging.Discard())
+	n, err := relay.RelayBatch(ctx)
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []int64{1}, publisher.published)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayBatchOkSkipsClaimedEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	// Event 2 is leased by another relay, events after it wait
+	rows := pendingRows(mock, 1).
+		AddRow(2, "acme", "product", 1, ProductDeleted, []byte(`{"id":1}`), time.Now(), time.Now().Add(time.Minute)).
+		AddRow(3, "acme", "product", 1, ProductDeleted, []byte(`{"id":1}`), time.Now(), nil)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM outbox_events").WillReturnRows(rows)
+	mock.ExpectExec("UPDATE outbox_events SET claimed_until = \\? WHERE id IN \\(\\?\\)").
+		WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("UPDATE outbox_events SET published_at = \\? WHERE id IN \\(\\?\\)").
+		WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	publisher := &stubPublisher{}
+	relay := NewRelay(NewRepository(db), publisher, time.Second, 10, logging.Discard())
+	n, err := relay.RelayBatch(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []int64{1}, publisher.published)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
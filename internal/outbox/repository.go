@@ -0,0 +1,165 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/db"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+type Repository interface {
+	// Add records events in the transaction active in ctx, so they commit
+	// or roll back together with the change they describe. Events belong
+	// to the tenant of ctx.
+	Add(ctx context.Context, events ...domain.Event) error
+	// Claim leases the oldest unpublished events in order until the
+	// given time, in a transaction of its own. It stops at the first event
+	// leased by another relay, so events are published in order.
+	Claim(ctx context.Context, limit int, until time.Time) ([]domain.Event, error)
+	// Release gives claimed events back before their lease runs out
+	Release(ctx context.Context, ids []int64) error
+	MarkPublished(ctx context.Context, ids []int64, at time.Time) error
+	// Published returns events of the tenant of ctx already published
+	// after afterID, in order
+	Published(ctx context.Context, afterID int64, limit int) ([]domain.Event, error)
+	db.TxManager
+}
+
+type repository struct {
+	db *sql.DB
+	db.TxManager
+}
+
+func NewRepository(conn *sql.DB) Repository {
+	return &repository{db: conn, TxManager: db.NewTxManager(conn)}
+}
+
+// conn joins the transaction active in ctx, if any, labelling its
+// statements with the repository method op
+func (r *repository) conn(ctx context.Context, op string) db.Executor {
+	return db.Conn(ctx, r.db, "outbox", op)
+}
+
+// Query all outbox events
+var (
+	createEventsQuery    = `INSERT INTO outbox_events (tenant_id, aggregate_type, aggregate_id, type, payload, created_at) VALUES %s`
+	pendingEventsQuery   = `SELECT id, tenant_id, aggregate_type, aggregate_id, type, payload, created_at, claimed_until FROM outbox_events WHERE published_at IS NULL ORDER BY id LIMIT ? FOR UPDATE`
+	claimEventsQuery     = `UPDATE outbox_events SET claimed_until = ? WHERE id IN (%s)`
+	publishedEventsQuery = `SELECT id, tenant_id, aggregate_type, aggregate_id, type, payload, created_at FROM outbox_events WHERE tenant_id = ? AND id > ? AND published_at IS NOT NULL ORDER BY id LIMIT ?`
+	markPublishedQuery   = `UPDATE outbox_events SET published_at = ? WHERE id IN (%s)`
+)
+
+func (r *repository) Add(ctx context.Context, events ...domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	values := make([]string, len(events))
+	args := make([]interface{}, 0, len(events)*6)
+	for i, e := range events {
+		values[i] = "(?, ?, ?, ?, ?, ?)"
+		args = append(args, tenant.FromContext(ctx), e.AggregateType, e.AggregateID, e.Type, []byte(e.Payload), e.CreatedAt)
+	}
+	_, err := r.conn(ctx, "Add").ExecContext(ctx, fmt.Sprintf(createEventsQuery, strings.Join(values, ", ")), args...)
+	return err
+}
+
+func (r *repository) Claim(ctx context.Context, limit int, until time.Time) ([]domain.Event, error) {
+	var events []domain.Event
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		events = nil
+		rows, err := r.conn(ctx, "Claim").QueryContext(ctx, pendingEventsQuery, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		now := time.Now().UTC()
+		var ids []int64
+		for rows.Next() {
+			var e domain.Event
+			var payload []byte
+			var claimedUntil sql.NullTime
+			if err := rows.Scan(&e.ID, &e.Tenant, &e.AggregateType, &e.AggregateID, &e.Type, &payload, &e.CreatedAt, &claimedUntil); err != nil {
+				return err
+			}
+			if claimedUntil.Valid && claimedUntil.Time.After(now) {
+				break
+			}
+			e.Payload = payload
+			events = append(events, e)
+			ids = append(ids, e.ID)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		return r.setClaim(ctx, ids, until)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *repository) Release(ctx context.Context, ids []int64) error {
+	return r.setClaim(ctx, ids, nil)
+}
+
+func (r *repository) setClaim(ctx context.Context, ids []int64, until interface{}) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := r.conn(ctx, "setClaim").ExecContext(ctx, fmt.Sprintf(claimEventsQuery, placeholders(len(ids))), idArgs(until, ids)...)
+	return err
+}
+
+func (r *repository) Published(ctx context.Context, afterID int64, limit int) ([]domain.Event, error) {
+	return r.list(ctx, publishedEventsQuery, tenant.FromContext(ctx), afterID, limit)
+}
+
+func (r *repository) list(ctx context.Context, query string, args ...interface{}) ([]domain.Event, error) {
+	rows, err := r.conn(ctx, "list").QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []domain.Event
+	for rows.Next() {
+		var e domain.Event
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.Tenant, &e.AggregateType, &e.AggregateID, &e.Type, &payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Payload = payload
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (r *repository) MarkPublished(ctx context.Context, ids []int64, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := r.conn(ctx, "MarkPublished").ExecContext(ctx, fmt.Sprintf(markPublishedQuery, placeholders(len(ids))), idArgs(at, ids)...)
+	return err
+}
+
+// idArgs are the arguments of a query setting value on the events of ids
+func idArgs(value interface{}, ids []int64) []interface{} {
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, value)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return args
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,46 @@
+package product
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Scrapes wait at most this long for the totals query
+const collectTimeout = 5 * time.Second
+
+// collector reports product counts per tenant each time metrics are
+// scraped, so they match the table rather than what this replica wrote
+type collector struct {
+	repo       Repository
+	products   *prometheus.Desc
+	outOfStock *prometheus.Desc
+}
+
+func NewCollector(repo Repository) prometheus.Collector {
+	return &collector{
+		repo:       repo,
+		products:   prometheus.NewDesc("products", "Products in the catalog.", []string{"tenant"}, nil),
+		outOfStock: prometheus.NewDesc("products_out_of_stock", "Products with no stock left.", []string{"tenant"}, nil),
+	}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.products
+	ch <- c.outOfStock
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+	totals, err := c.repo.Totals(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.products, err)
+		return
+	}
+	for _, t := range totals {
+		ch <- prometheus.MustNewConstMetric(c.products, prometheus.GaugeValue, float64(t.Products), t.Tenant)
+		ch <- prometheus.MustNewConstMetric(c.outOfStock, prometheus.GaugeValue, float64(t.OutOfStock), t.Tenant)
+	}
+}
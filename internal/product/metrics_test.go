@@ -0,0 +1,67 @@
+package product
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/pkg/metrics"
+)
+
+func TestCollectorOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT tenant_id, COUNT").
+		WillReturnRows(sqlmock.NewRows([]string{"tenant_id", "products", "out_of_stock"}).AddRow("acme", 12, 2))
+
+	expected := `
+# HELP products Products in the catalog.
+# TYPE products gauge
+products{tenant="acme"} 12
+# HELP products_out_of_stock Products with no stock left.
+# TYPE products_out_of_stock gauge
+products_out_of_stock{tenant="acme"} 2
+`
+	err = testutil.CollectAndCompare(NewCollector(NewRepository(db)), strings.NewReader(expected))
+	assert.NoError(t, err)
+
+	// The query is timed under the repository method that ran it
+	families, err := metrics.Registry.Gather()
+	assert.NoError(t, err)
+	var timed []string
+	for _, f := range families {
+		if f.GetName() != "db_query_duration_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			timed = append(timed, labels["repository"]+"."+labels["method"])
+		}
+	}
+	assert.Contains(t, timed, "product.Totals")
+}
+
+func TestCollectorErr(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT tenant_id, COUNT").WillReturnError(errors.New("connection refused"))
+
+	err = testutil.CollectAndCompare(NewCollector(NewRepository(db)), strings.NewReader(""))
+	assert.Error(t, err)
+}
@@ -3,43 +3,79 @@ package product
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
 
 	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/inventory"
+	"github.com/vincentconace/api-gin/internal/outbox"
+	"github.com/vincentconace/api-gin/pkg/db"
+	"github.com/vincentconace/api-gin/pkg/tenant"
 )
 
 type Repository interface {
 	Get(ctx context.Context) ([]domain.Product, error)
+	Stream(ctx context.Context, fn func(p domain.Product) error) error
 	GetById(ctx context.Context, id int) (domain.Product, error)
 	Save(ctx context.Context, p domain.Product) (int, error)
 	Update(ctx context.Context, id int, p domain.Product) error
 	Delete(ctx context.Context, id int) error
 	Exists(ctx context.Context, productCode string) bool
+	GetByIds(ctx context.Context, ids []int) (map[int]domain.Product, error)
+	CodesInUse(ctx context.Context, codes []string) (map[string]int, error)
+	SaveBatch(ctx context.Context, ps []domain.Product) ([]int, error)
+	UpdateBatch(ctx context.Context, ps []domain.Product) error
+	DeleteBatch(ctx context.Context, ids []int) error
+	// Totals counts products across every tenant, for metrics
+	Totals(ctx context.Context) ([]domain.ProductTotals, error)
+	db.TxManager
 }
 
 type repository struct {
 	db *sql.DB
+	db.TxManager
+	outbox    outbox.Repository
+	inventory inventory.Repository
 }
 
-func NewRepository(db *sql.DB) Repository {
-	return &repository{db: db}
+func NewRepository(conn *sql.DB) Repository {
+	return &repository{db: conn, TxManager: db.NewTxManager(conn), outbox: outbox.NewRepository(conn), inventory: inventory.NewRepository(conn)}
 }
 
-// Query all products
+// conn joins the transaction active in ctx, if any, labelling its
+// statements with the repository method op
+func (r *repository) conn(ctx context.Context, op string) db.Executor {
+	return db.Conn(ctx, r.db, "product", op)
+}
+
+// Query all products. Every query is scoped to the tenant of the context,
+// which is always its first argument.
 var (
-	getProductsQuery    = `SELECT id, product_code, name, description, price, stock FROM products`
-	getProductByIdQuery = `SELECT id, product_code, name, description, price, stock FROM products WHERE id = ?`
-	createProductQuery  = `INSERT INTO products (product_code, name, description, price, stock) VALUES (?, ?, ?, ?, ?)`
-	updateProductQuery  = `UPDATE products SET product_code = ?, name = ?, description = ?, price = ?, stock = ? WHERE id = ?`
-	deleteProductQuery  = `DELETE FROM products WHERE id = ?`
-	existProductQuery   = `SELECT id FROM products WHERE product_code = ?`
+	getProductsQuery      = `SELECT id, product_code, name, description, price, stock FROM products WHERE tenant_id = ?`
+	getProductByIdQuery   = `SELECT id, product_code, name, description, price, stock FROM products WHERE tenant_id = ? AND id = ?`
+	lockProductQuery      = getProductByIdQuery + ` FOR UPDATE`
+	createProductQuery    = `INSERT INTO products (tenant_id, product_code, name, description, price, stock) VALUES (?, ?, ?, ?, ?, ?)`
+	updateProductQuery    = `UPDATE products SET product_code = ?, name = ?, description = ?, price = ? WHERE tenant_id = ? AND id = ?`
+	deleteProductQuery    = `DELETE FROM products WHERE tenant_id = ? AND id = ?`
+	existProductQuery     = `SELECT id FROM products WHERE tenant_id = ? AND product_code = ?`
+	getProductsByIdsQuery = `SELECT id, product_code, name, description, price, stock FROM products WHERE tenant_id = ? AND id IN (%s)`
+	lockProductsQuery     = getProductsByIdsQuery + ` FOR UPDATE`
+	codesInUseQuery       = `SELECT id, product_code FROM products WHERE tenant_id = ? AND product_code IN (%s)`
+	deleteProductsQuery   = `DELETE FROM products WHERE tenant_id = ? AND id IN (%s)`
+	// The only query across tenants
+	productTotalsQuery = `SELECT tenant_id, COUNT(*), COALESCE(SUM(stock <= 0), 0) FROM products GROUP BY tenant_id`
 )
 
+// Rows written or looked up per statement in batch operations
+const batchSize = 500
+
 func (r *repository) Get(ctx context.Context) ([]domain.Product, error) {
 	var products []domain.Product
-	rows, err := r.db.Query(getProductsQuery)
+	rows, err := r.conn(ctx, "Get").QueryContext(ctx, getProductsQuery, tenant.FromContext(ctx))
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var p domain.Product
 		err := rows.Scan(&p.ID, &p.ProductCode, &p.Name, &p.Description, &p.Price, &p.Stock)
@@ -51,69 +87,354 @@ func (r *repository) Get(ctx context.Context) ([]domain.Product, error) {
 	return products, nil
 }
 
+// Stream calls fn for each product as rows arrive from the server, so the
+// result set is never held in memory.
+func (r *repository) Stream(ctx context.Context, fn func(p domain.Product) error) error {
+	rows, err := r.conn(ctx, "Stream").QueryContext(ctx, getProductsQuery, tenant.FromContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p domain.Product
+		if err := rows.Scan(&p.ID, &p.ProductCode, &p.Name, &p.Description, &p.Price, &p.Stock); err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 func (r *repository) GetById(ctx context.Context, id int) (domain.Product, error) {
 	var p domain.Product
-	err := r.db.QueryRow(getProductByIdQuery, id).Scan(&p.ID, &p.ProductCode, &p.Name, &p.Description, &p.Price, &p.Stock)
+	err := r.conn(ctx, "GetById").QueryRowContext(ctx, getProductByIdQuery, tenant.FromContext(ctx), id).Scan(&p.ID, &p.ProductCode, &p.Name, &p.Description, &p.Price, &p.Stock)
 	if err != nil {
 		return p, err
 	}
 	return p, nil
 }
 
+// Save inserts the product and records ProductCreated in one transaction
 func (r *repository) Save(ctx context.Context, p domain.Product) (int, error) {
-	stmt, err := r.db.Prepare(createProductQuery)
+	var id int
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		res, err := r.conn(ctx, "Save").ExecContext(ctx, createProductQuery, tenant.FromContext(ctx), p.ProductCode, p.Name, p.Description, p.Price, p.Stock)
+		if err != nil {
+			return err
+		}
+		lastID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		id = int(lastID)
+		p.ID = &id
+		return r.outbox.Add(ctx, outbox.NewProductCreated(p))
+	})
 	if err != nil {
 		return 0, err
 	}
-	res, err := stmt.Exec(p.ProductCode, p.Name, p.Description, p.Price, p.Stock)
+	return id, nil
+}
+
+// Update records ProductUpdated with the changed fields in the same
+// transaction as the update. A new stock is adjusted through the inventory.
+func (r *repository) Update(ctx context.Context, id int, p domain.Product) error {
+	return r.WithinTx(ctx, func(ctx context.Context) error {
+		before, err := scanProduct(r.conn(ctx, "Update").QueryRowContext(ctx, lockProductQuery, tenant.FromContext(ctx), id))
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := r.conn(ctx, "Update").ExecContext(ctx, updateProductQuery, &p.ProductCode, &p.Name, &p.Description, &p.Price, tenant.FromContext(ctx), id); err != nil {
+			return err
+		}
+
+		p.ID = &id
+		if err := r.outbox.Add(ctx, updateEvents(before, p)...); err != nil {
+			return err
+		}
+		return r.setStock(ctx, before, p)
+	})
+}
+
+// Delete removes the product and records ProductDeleted in one transaction
+func (r *repository) Delete(ctx context.Context, id int) error {
+	return r.WithinTx(ctx, func(ctx context.Context) error {
+		res, err := r.conn(ctx, "Delete").ExecContext(ctx, deleteProductQuery, tenant.FromContext(ctx), id)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows < 1 {
+			return ErrNotFound
+		}
+		return r.outbox.Add(ctx, outbox.NewProductDeleted(id))
+	})
+}
+
+func (r *repository) Exists(ctx context.Context, productCode string) bool {
+	row := r.conn(ctx, "Exists").QueryRowContext(ctx, existProductQuery, tenant.FromContext(ctx), productCode)
+	err := row.Scan(&productCode)
+	return err == nil
+}
+
+func (r *repository) Totals(ctx context.Context) ([]domain.ProductTotals, error) {
+	rows, err := r.conn(ctx, "Totals").QueryContext(ctx, productTotalsQuery)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	id, err := res.LastInsertId()
-	if err != nil {
-		return 0, err
+	defer rows.Close()
+	var totals []domain.ProductTotals
+	for rows.Next() {
+		var t domain.ProductTotals
+		if err := rows.Scan(&t.Tenant, &t.Products, &t.OutOfStock); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
 	}
-	return int(id), nil
+	return totals, rows.Err()
 }
 
-func (r *repository) Update(ctx context.Context, id int, p domain.Product) error {
-	stmt, err := r.db.Prepare(updateProductQuery)
-	if err != nil {
-		return err
+func (r *repository) GetByIds(ctx context.Context, ids []int) (map[int]domain.Product, error) {
+	products := make(map[int]domain.Product, len(ids))
+	for _, chunk := range chunks(len(ids)) {
+		args := make([]interface{}, 0, chunk.size()+1)
+		args = append(args, tenant.FromContext(ctx))
+		for _, id := range ids[chunk.from:chunk.to] {
+			args = append(args, id)
+		}
+		rows, err := r.conn(ctx, "GetByIds").QueryContext(ctx, fmt.Sprintf(getProductsByIdsQuery, placeholders(len(args)-1)), args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var p domain.Product
+			if err := rows.Scan(&p.ID, &p.ProductCode, &p.Name, &p.Description, &p.Price, &p.Stock); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			products[*p.ID] = p
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
 	}
-	res, err := stmt.Exec(&p.ProductCode, &p.Name, &p.Description, &p.Price, &p.Stock, id)
-	if err != nil {
-		return err
+	return products, nil
+}
+
+// CodesInUse returns the id of the product owning each of codes that
+// already exists.
+func (r *repository) CodesInUse(ctx context.Context, codes []string) (map[string]int, error) {
+	inUse := make(map[string]int, len(codes))
+	for _, chunk := range chunks(len(codes)) {
+		args := make([]interface{}, 0, chunk.size()+1)
+		args = append(args, tenant.FromContext(ctx))
+		for _, code := range codes[chunk.from:chunk.to] {
+			args = append(args, code)
+		}
+		rows, err := r.conn(ctx, "CodesInUse").QueryContext(ctx, fmt.Sprintf(codesInUseQuery, placeholders(len(args)-1)), args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			var code string
+			if err := rows.Scan(&id, &code); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			inUse[code] = id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
 	}
-	_, err = res.RowsAffected()
+	return inUse, nil
+}
+
+// SaveBatch inserts ps one row at a time and returns their ids in order,
+// each read from its own INSERT since the ids of a multi-row INSERT need
+// not be consecutive.
+func (r *repository) SaveBatch(ctx context.Context, ps []domain.Product) ([]int, error) {
+	ids := make([]int, 0, len(ps))
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		ids = ids[:0]
+		events := make([]domain.Event, 0, len(ps))
+		for _, p := range ps {
+			res, err := r.conn(ctx, "SaveBatch").ExecContext(ctx, createProductQuery, tenant.FromContext(ctx), p.ProductCode, p.Name, p.Description, p.Price, p.Stock)
+			if err != nil {
+				return err
+			}
+			lastID, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			id := int(lastID)
+			p.ID = &id
+			ids = append(ids, id)
+			events = append(events, outbox.NewProductCreated(p))
+		}
+		return r.outbox.Add(ctx, events...)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return ids, nil
+}
 
-	return nil
+// UpdateBatch updates every product in ps by its ID, adjusting new stocks
+// through the inventory.
+func (r *repository) UpdateBatch(ctx context.Context, ps []domain.Product) error {
+	if len(ps) == 0 {
+		return nil
+	}
+	return r.WithinTx(ctx, func(ctx context.Context) error {
+		ids := make([]int, len(ps))
+		for i, p := range ps {
+			ids[i] = *p.ID
+		}
+		before, err := r.lockByIds(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		var events []domain.Event
+		for _, p := range ps {
+			if _, err := r.conn(ctx, "UpdateBatch").ExecContext(ctx, updateProductQuery, p.ProductCode, p.Name, p.Description, p.Price, tenant.FromContext(ctx), p.ID); err != nil {
+				return err
+			}
+			if old, ok := before[*p.ID]; ok {
+				events = append(events, updateEvents(old, p)...)
+			}
+		}
+		if err := r.outbox.Add(ctx, events...); err != nil {
+			return err
+		}
+		for _, p := range ps {
+			if err := r.setStock(ctx, before[*p.ID], p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (r *repository) Delete(ctx context.Context, id int) error {
-	stmt, err := r.db.Prepare(deleteProductQuery)
-	if err != nil {
-		return err
+// DeleteBatch deletes the products of ids, recording ProductDeleted only
+// for the ones that existed.
+func (r *repository) DeleteBatch(ctx context.Context, ids []int) error {
+	return r.WithinTx(ctx, func(ctx context.Context) error {
+		existing, err := r.lockByIds(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		events := make([]domain.Event, 0, len(existing))
+		for _, chunk := range chunks(len(ids)) {
+			args := make([]interface{}, 0, chunk.size()+1)
+			args = append(args, tenant.FromContext(ctx))
+			for _, id := range ids[chunk.from:chunk.to] {
+				args = append(args, id)
+				if _, ok := existing[id]; ok {
+					delete(existing, id)
+					events = append(events, outbox.NewProductDeleted(id))
+				}
+			}
+			if _, err := r.conn(ctx, "DeleteBatch").ExecContext(ctx, fmt.Sprintf(deleteProductsQuery, placeholders(len(args)-1)), args...); err != nil {
+				return err
+			}
+		}
+		return r.outbox.Add(ctx, events...)
+	})
+}
+
+func (r *repository) lockByIds(ctx context.Context, ids []int) (map[int]domain.Product, error) {
+	products := make(map[int]domain.Product, len(ids))
+	for _, chunk := range chunks(len(ids)) {
+		args := make([]interface{}, 0, chunk.size()+1)
+		args = append(args, tenant.FromContext(ctx))
+		for _, id := range ids[chunk.from:chunk.to] {
+			args = append(args, id)
+		}
+		rows, err := r.conn(ctx, "lockByIds").QueryContext(ctx, fmt.Sprintf(lockProductsQuery, placeholders(len(args)-1)), args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			p, err := scanProduct(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			products[*p.ID] = p
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
 	}
-	res, err := stmt.Exec(id)
-	if err != nil {
-		return err
+	return products, nil
+}
+
+// updateEvents describes the change from before to after
+func updateEvents(before, after domain.Product) []domain.Event {
+	updated, ok := outbox.NewProductUpdated(before, after)
+	if !ok {
+		return nil
 	}
-	rows, err := res.RowsAffected()
-	if err != nil {
-		return err
+	return []domain.Event{updated}
+}
+
+// setStock adjusts the stock of before to the one of after, so the change
+// is recorded in the ledger and spread over the warehouse levels
+func (r *repository) setStock(ctx context.Context, before, after domain.Product) error {
+	if before.Stock == nil || after.Stock == nil || *before.Stock == *after.Stock {
+		return nil
 	}
-	if rows < 1 {
-		return ErrNotFound
+	_, err := r.inventory.Adjust(ctx, *after.ID, 0, *after.Stock-*before.Stock, inventory.ReasonProductUpdate, "")
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProduct(s scanner) (domain.Product, error) {
+	var p domain.Product
+	err := s.Scan(&p.ID, &p.ProductCode, &p.Name, &p.Description, &p.Price, &p.Stock)
+	return p, err
+}
+
+type chunk struct {
+	from, to int
+}
+
+func (c chunk) size() int {
+	return c.to - c.from
+}
+
+// chunks splits n items into ranges of at most batchSize
+func chunks(n int) []chunk {
+	var result []chunk
+	for from := 0; from < n; from += batchSize {
+		to := from + batchSize
+		if to > n {
+			to = n
+		}
+		result = append(result, chunk{from: from, to: to})
 	}
-	return nil
+	return result
 }
 
-func (r *repository) Exists(ctx context.Context, productCode string) bool {
-	row := r.db.QueryRow(existProductQuery, productCode)
-	err := row.Scan(&productCode)
-	return err == nil
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
 }
@@ -8,6 +8,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/tenant"
 )
 
 func puntInt(i int) *int {
@@ -48,8 +49,11 @@ func TestSaveOk(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectPrepare("INSERT INTO products")
-	mock.ExpectExec("").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO products").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").
+		WithArgs(tenant.Default, "product", 1, "ProductCreated", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	repository := NewRepository(db)
 	idResult, err := repository.Save(ctx, productMock[0])
@@ -66,8 +70,9 @@ func TestSaveErrCreated(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectPrepare("INSERT INTO products")
-	mock.ExpectExec("").WillReturnError(ErrCreatedProduct)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO products").WillReturnError(ErrCreatedProduct)
+	mock.ExpectRollback()
 
 	repository := NewRepository(db)
 	idResult, err := repository.Save(ctx, productMock[0])
@@ -131,7 +136,7 @@ func TestGetByIdOk(t *testing.T) {
 	rows := mock.NewRows(colums)
 	rows.AddRow(1, "PRO001", "Product 1", "Product 1 description", 1.99, 10)
 
-	mock.ExpectQuery("SELECT id, product_code, name, description, price, stock FROM products WHERE id = ?").WillReturnRows(rows).WithArgs(1)
+	mock.ExpectQuery("SELECT id, product_code, name, description, price, stock FROM products WHERE tenant_id = \\? AND id = \\?").WillReturnRows(rows).WithArgs("default", 1)
 
 	repository := NewRepository(db)
 	product, err := repository.GetById(ctx, *productMock[0].ID)
@@ -156,7 +161,7 @@ func TestGetByIdErrNotFount(t *testing.T) {
 	rows := mock.NewRows(colums)
 	rows.AddRow(1, "PRO001", "Product 1", "Product 1 description", 1.99, 10)
 
-	mock.ExpectQuery("SELECT id, product_code, name, description, price, stock FROM products WHERE id = ?").WillReturnError(ErrNotFound)
+	mock.ExpectQuery("SELECT id, product_code, name, description, price, stock FROM products WHERE tenant_id = \\? AND id = \\?").WillReturnError(ErrNotFound)
 
 	repository := NewRepository(db)
 	product, err := repository.GetById(ctx, *productMock[0].ID)
@@ -173,13 +178,36 @@ func TestUpdateOk(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectPrepare("UPDATE products")
-	mock.ExpectExec("").WillReturnResult(sqlmock.NewResult(1, 1))
+	colums := []string{"id", "product_code", "name", "description", "price", "stock"}
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").WithArgs("default", 1).
+		WillReturnRows(mock.NewRows(colums).AddRow(1, nil, "Product 1", "Product 1 description", 1.99, 4))
+	mock.ExpectExec("UPDATE products SET product_code").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").
+		WithArgs(tenant.Default, "product", 1, "ProductUpdated", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// The new stock is adjusted through the inventory ledger
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(4))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"warehouse_id", "quantity"}))
+	mock.ExpectExec("UPDATE products SET stock = stock \\+ \\?").
+		WithArgs(6, tenant.Default, 1, 6).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\?").
+		WithArgs(tenant.Default, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(10))
+	mock.ExpectExec("INSERT INTO inventory_ledger").WillReturnResult(sqlmock.NewResult(5, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").
+		WithArgs(tenant.Default, "product", 1, "StockChanged", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
 
 	repository := NewRepository(db)
 	err = repository.Update(ctx, 1, productMock[0])
 
 	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestUpdateErrNotFount(t *testing.T) {
@@ -190,8 +218,9 @@ func TestUpdateErrNotFount(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectPrepare("UPDATE products")
-	mock.ExpectExec("").WillReturnError(ErrNotFound)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").WithArgs("default", 1).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
 
 	repository := NewRepository(db)
 	err = repository.Update(ctx, 1, productMock[0])
@@ -211,7 +240,7 @@ func TestUpdateErrNotFount(t *testing.T) {
 	rows := mock.NewRows(colums)
 	rows.AddRow(1, "PRO001", "Product 1", "Product 1 description", 1.99, 10)
 
-	mock.ExpectQuery("SELECT id FROM products WHERE product_code = ?").WithArgs("PRO001").WillReturnRows(rows)
+	mock.ExpectQuery("SELECT id FROM products WHERE tenant_id = \\? AND product_code = \\?").WithArgs("default", "PRO001").WillReturnRows(rows)
 
 	repository := NewRepository(db)
 	result := repository.Exists(ctx, "PRO001")
@@ -227,8 +256,11 @@ func TestDeleteOk(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectPrepare("DELETE FROM products WHERE id = ?")
-	mock.ExpectExec("").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM products WHERE tenant_id = \\? AND id = \\?").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").
+		WithArgs(tenant.Default, "product", 1, "ProductDeleted", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	repository := NewRepository(db)
 	err = repository.Delete(ctx, 1)
@@ -244,11 +276,283 @@ func TestDeleteErrNoDeleted(t *testing.T) {
 	}
 	defer db.Close()
 
-	mock.ExpectPrepare("DELETE FROM products WHERE id = ?")
-	mock.ExpectExec("").WillReturnError(ErrNotFound)
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM products WHERE tenant_id = \\? AND id = \\?").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
 
 	repository := NewRepository(db)
 	err = repository.Delete(ctx, 1)
 
 	assert.EqualError(t, ErrNotFound, err.Error())
 }
+
+func TestSaveBatchOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	products := []domain.Product{productMock[0], productMock[1]}
+	mock.ExpectBegin()
+	// Ids of concurrent inserts interleave, each row reads back its own
+	mock.ExpectExec("INSERT INTO products \\(tenant_id, .+\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?\\)$").
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectExec("INSERT INTO products \\(tenant_id, .+\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?\\)$").
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").
+		WithArgs(tenant.Default, "product", 7, "ProductCreated", sqlmock.AnyArg(), sqlmock.AnyArg(), tenant.Default, "product", 9, "ProductCreated", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+
+	repository := NewRepository(db)
+	ids, err := repository.SaveBatch(ctx, products)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{7, 9}, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCodesInUseOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT id, product_code FROM products WHERE tenant_id = \\? AND product_code IN \\(\\?, \\?\\)").
+		WithArgs("default", "PRO001", "PRO002").
+		WillReturnRows(mock.NewRows([]string{"id", "product_code"}).AddRow(3, "PRO002"))
+
+	repository := NewRepository(db)
+	inUse, err := repository.CodesInUse(ctx, []string{"PRO001", "PRO002"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"PRO002": 3}, inUse)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteBatchOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id IN \\(\\?, \\?\\) FOR UPDATE").WithArgs("default", 1, 2).
+		WillReturnRows(mock.NewRows([]string{"id", "product_code", "name", "description", "price", "stock"}).AddRow(1, "PRO001", "Product 1", "", 1.99, 10))
+	mock.ExpectExec("DELETE FROM products WHERE tenant_id = \\? AND id IN \\(\\?, \\?\\)").WithArgs("default", 1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	// Product 2 never existed, so only product 1 is recorded as deleted
+	mock.ExpectExec("INSERT INTO outbox_events").WithArgs(tenant.Default, "product", 1, "ProductDeleted", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	repository := NewRepository(db)
+	err = repository.DeleteBatch(ctx, []int{1, 2})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStreamOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	rows := mock.NewRows([]string{"id", "product_code", "name", "description", "price", "stock"}).
+		AddRow(1, "PRO001", "Product 1", "", 1.99, 10).
+		AddRow(2, "PRO002", "Product 2", "", 2.99, 20)
+	mock.ExpectQuery("SELECT (.+) FROM products").WillReturnRows(rows)
+
+	repository := NewRepository(db)
+	var ids []int
+	err = repository.Stream(ctx, func(p domain.Product) error {
+		ids = append(ids, *p.ID)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Tenant isolation: every statement is bound to the tenant of the context,
+// so another tenant's rows are never matched
+
+func TestSaveTenantOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	p := productMock[0]
+	p.ProductCode = puntStr("PRO001")
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO products \\(tenant_id, ").WithArgs("acme", "PRO001", "Product 1", "Product 1 description", sqlmock.AnyArg(), 10).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	repository := NewRepository(db)
+	_, err = repository.Save(tenant.WithID(ctx, "acme"), p)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetByIdErrOtherTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	// Product 1 belongs to another tenant, so acme's query finds nothing
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id = \\?").WithArgs("acme", 1).
+		WillReturnRows(mock.NewRows([]string{"id", "product_code", "name", "description", "price", "stock"}))
+
+	repository := NewRepository(db)
+	_, err = repository.GetById(tenant.WithID(ctx, "acme"), 1)
+
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTenantOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	rows := mock.NewRows([]string{"id", "product_code", "name", "description", "price", "stock"}).
+		AddRow(4, "PRO001", "Acme mouse", "", 9.99, 3)
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\?$").WithArgs("acme").WillReturnRows(rows)
+
+	repository := NewRepository(db)
+	products, err := repository.Get(tenant.WithID(ctx, "acme"))
+
+	assert.NoError(t, err)
+	assert.Len(t, products, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateErrOtherTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").WithArgs("acme", 1).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	repository := NewRepository(db)
+	err = repository.Update(tenant.WithID(ctx, "acme"), 1, productMock[0])
+
+	// Nothing is written
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteErrOtherTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM products WHERE tenant_id = \\? AND id = \\?").WithArgs("acme", 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	repository := NewRepository(db)
+	err = repository.Delete(tenant.WithID(ctx, "acme"), 1)
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBatchTenantOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id IN \\(\\?\\) FOR UPDATE").WithArgs("acme", 2).
+		WillReturnRows(mock.NewRows([]string{"id", "product_code", "name", "description", "price", "stock"}))
+	mock.ExpectExec("UPDATE products SET (.+) WHERE tenant_id = \\? AND id = \\?").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "acme", 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	repository := NewRepository(db)
+	p := productMock[1]
+	p.ID = puntInt(2)
+	err = repository.UpdateBatch(tenant.WithID(ctx, "acme"), []domain.Product{p})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExistsPerTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	// PRO001 is taken in the default tenant but free in acme
+	mock.ExpectQuery("SELECT id FROM products WHERE tenant_id = \\? AND product_code = \\?").WithArgs("default", "PRO001").
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT id FROM products WHERE tenant_id = \\? AND product_code = \\?").WithArgs("acme", "PRO001").
+		WillReturnRows(mock.NewRows([]string{"id"}))
+
+	repository := NewRepository(db)
+
+	assert.True(t, repository.Exists(ctx, "PRO001"))
+	assert.False(t, repository.Exists(tenant.WithID(ctx, "acme"), "PRO001"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTotalsOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"tenant_id", "products", "out_of_stock"}).
+		AddRow("acme", 12, 2).
+		AddRow(tenant.Default, 3, 0)
+	mock.ExpectQuery("SELECT tenant_id, COUNT").WithArgs().WillReturnRows(rows)
+
+	repository := NewRepository(db)
+	totals, err := repository.Totals(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.ProductTotals{
+		{Tenant: "acme", Products: 12, OutOfStock: 2},
+		{Tenant: tenant.Default, Products: 3, OutOfStock: 0},
+	}, totals)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
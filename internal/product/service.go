@@ -3,24 +3,53 @@ package product
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/vincentconace/api-gin/internal/domain"
 )
 
 type Service interface {
 	Get(ctx context.Context) ([]domain.Product, error)
+	Stream(ctx context.Context, fn func(p domain.Product) error) error
 	GetById(ctx context.Context, id int) (domain.Product, error)
 	Create(ctx context.Context, p domain.Product) (domain.Product, error)
 	Update(ctx context.Context, id int, p domain.Product) (domain.Product, error)
 	Delete(ctx context.Context, id int) error
+	Batch(ctx context.Context, mode string, ops []domain.ProductBatchOperation) ([]domain.ProductBatchResult, error)
+	ValidateBatch(ctx context.Context, ops []domain.ProductBatchOperation) ([]domain.ProductBatchResult, error)
 }
 
+// Batch modes
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+// Batch operations and their result statuses
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+
+	StatusCreated = "created"
+	StatusUpdated = "updated"
+	StatusDeleted = "deleted"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+	StatusValid   = "valid"
+)
+
+const MaxBatchOperations = 5000
+
 var (
 	EmptyProduct          = domain.Product{}
 	ErrNotFound           = errors.New("product not found")
 	ErrInternal           = errors.New("internal error")
 	ErrProductAlredyExist = errors.New("product already exists")
 	ErrCreatedProduct     = errors.New("error creating product")
+	ErrInvalidBatchMode   = errors.New("mode must be atomic or best_effort")
+	ErrEmptyBatch         = errors.New("batch must have at least one operation")
+	ErrBatchTooLarge      = fmt.Errorf("batch must have at most %d operations", MaxBatchOperations)
 )
 
 type service struct {
@@ -35,6 +64,10 @@ func (s *service) Get(ctx context.Context) ([]domain.Product, error) {
 	return s.repo.Get(ctx)
 }
 
+func (s *service) Stream(ctx context.Context, fn func(p domain.Product) error) error {
+	return s.repo.Stream(ctx, fn)
+}
+
 func (s *service) GetById(ctx context.Context, id int) (domain.Product, error) {
 	return s.repo.GetById(ctx, id)
 }
@@ -78,3 +111,257 @@ func (s *service) Update(ctx context.Context, id int, p domain.Product) (domain.
 func (s *service) Delete(ctx context.Context, id int) error {
 	return s.repo.Delete(ctx, id)
 }
+
+// Batch runs create, update and delete operations using batched lookups
+// and deletes. Operations are validated up front; in atomic mode
+// any invalid operation skips the whole batch and writes run in a single
+// transaction, in best-effort mode valid operations are applied and
+// invalid ones reported.
+func (s *service) Batch(ctx context.Context, mode string, ops []domain.ProductBatchOperation) ([]domain.ProductBatchResult, error) {
+	if mode != BatchAtomic && mode != BatchBestEffort {
+		return nil, ErrInvalidBatchMode
+	}
+	results, err := s.validate(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == BatchBestEffort {
+		s.apply(ctx, ops, results, false)
+		return results, nil
+	}
+
+	for _, res := range results {
+		if len(res.Errors) > 0 {
+			markPending(results, StatusSkipped)
+			return results, nil
+		}
+	}
+	err = s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		return s.apply(ctx, ops, results, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ValidateBatch runs the checks of Batch without writing anything, marking
+// the operations that would succeed as valid.
+func (s *service) ValidateBatch(ctx context.Context, ops []domain.ProductBatchOperation) ([]domain.ProductBatchResult, error) {
+	results, err := s.validate(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+	markPending(results, StatusValid)
+	return results, nil
+}
+
+func (s *service) validate(ctx context.Context, ops []domain.ProductBatchOperation) ([]domain.ProductBatchResult, error) {
+	if len(ops) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	if len(ops) > MaxBatchOperations {
+		return nil, ErrBatchTooLarge
+	}
+
+	results := make([]domain.ProductBatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = domain.ProductBatchResult{Index: i, Op: op.Op, ID: op.ID, Errors: validateOperation(op)}
+	}
+	if err := s.checkConflicts(ctx, ops, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// checkConflicts looks up every referenced id and product code at once and
+// records missing products, codes already in use and operations touching
+// the same product or code twice.
+func (s *service) checkConflicts(ctx context.Context, ops []domain.ProductBatchOperation, results []domain.ProductBatchResult) error {
+	var ids []int
+	var codes []string
+	for i, op := range ops {
+		if len(results[i].Errors) > 0 {
+			continue
+		}
+		if op.Op != OpCreate {
+			ids = append(ids, *op.ID)
+		}
+		if op.Op != OpDelete {
+			codes = append(codes, *op.Product.ProductCode)
+		}
+	}
+
+	existing, err := s.repo.GetByIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+	inUse, err := s.repo.CodesInUse(ctx, codes)
+	if err != nil {
+		return err
+	}
+
+	seenIds := make(map[int]bool, len(ids))
+	seenCodes := make(map[string]bool, len(codes))
+	for i, op := range ops {
+		res := &results[i]
+		if len(res.Errors) > 0 {
+			continue
+		}
+		if op.Op != OpCreate {
+			if _, ok := existing[*op.ID]; !ok {
+				res.Errors = append(res.Errors, ErrNotFound.Error())
+			}
+			if seenIds[*op.ID] {
+				res.Errors = append(res.Errors, "product is already modified by another operation in the batch")
+			}
+			seenIds[*op.ID] = true
+		}
+		if op.Op != OpDelete {
+			code := *op.Product.ProductCode
+			if owner, ok := inUse[code]; ok && (op.Op == OpCreate || owner != *op.ID) {
+				res.Errors = append(res.Errors, ErrProductAlredyExist.Error())
+			}
+			if seenCodes[code] {
+				res.Errors = append(res.Errors, "product_code is repeated in the batch")
+			}
+			seenCodes[code] = true
+		}
+	}
+	return nil
+}
+
+// apply writes the valid operations grouped by kind. When atomic, the
+// first failure aborts; otherwise a failing group is reported on its
+// operations and the remaining groups still run.
+func (s *service) apply(ctx context.Context, ops []domain.ProductBatchOperation, results []domain.ProductBatchResult, atomic bool) error {
+	var creates, updates, deletes []int
+	for i, op := range ops {
+		if len(results[i].Errors) > 0 {
+			results[i].Status = StatusFailed
+			continue
+		}
+		switch op.Op {
+		case OpCreate:
+			creates = append(creates, i)
+		case OpUpdate:
+			updates = append(updates, i)
+		case OpDelete:
+			deletes = append(deletes, i)
+		}
+	}
+
+	fail := func(indexes []int, err error) error {
+		if atomic {
+			return err
+		}
+		for _, i := range indexes {
+			results[i].Status = StatusFailed
+			results[i].Errors = append(results[i].Errors, err.Error())
+		}
+		return nil
+	}
+
+	if len(creates) > 0 {
+		products := make([]domain.Product, len(creates))
+		for n, i := range creates {
+			products[n] = *ops[i].Product
+		}
+		ids, err := s.repo.SaveBatch(ctx, products)
+		if err != nil {
+			if err := fail(creates, err); err != nil {
+				return err
+			}
+		} else {
+			for n, i := range creates {
+				id := ids[n]
+				results[i].ID, results[i].Status = &id, StatusCreated
+			}
+		}
+	}
+
+	if len(updates) > 0 {
+		products := make([]domain.Product, len(updates))
+		for n, i := range updates {
+			products[n] = *ops[i].Product
+			products[n].ID = ops[i].ID
+		}
+		if err := s.repo.UpdateBatch(ctx, products); err != nil {
+			if err := fail(updates, err); err != nil {
+				return err
+			}
+		} else {
+			for _, i := range updates {
+				results[i].Status = StatusUpdated
+			}
+		}
+	}
+
+	if len(deletes) > 0 {
+		ids := make([]int, len(deletes))
+		for n, i := range deletes {
+			ids[n] = *ops[i].ID
+		}
+		if err := s.repo.DeleteBatch(ctx, ids); err != nil {
+			if err := fail(deletes, err); err != nil {
+				return err
+			}
+		} else {
+			for _, i := range deletes {
+				results[i].Status = StatusDeleted
+			}
+		}
+	}
+	return nil
+}
+
+func validateOperation(op domain.ProductBatchOperation) []string {
+	var errs []string
+	switch op.Op {
+	case OpCreate:
+		if op.ID != nil {
+			errs = append(errs, "id must not be set on create")
+		}
+	case OpUpdate, OpDelete:
+		if op.ID == nil {
+			errs = append(errs, "id is required")
+		}
+	default:
+		return []string{"op must be create, update or delete"}
+	}
+
+	if op.Op == OpDelete {
+		return errs
+	}
+	if op.Product == nil {
+		return append(errs, "product is required")
+	}
+	p := op.Product
+	if p.ProductCode == nil {
+		errs = append(errs, "product_code is required")
+	}
+	if p.Name == nil {
+		errs = append(errs, "name is required")
+	}
+	if p.Description == nil {
+		errs = append(errs, "description is required")
+	}
+	if p.Price == nil {
+		errs = append(errs, "price is required")
+	}
+	if p.Stock == nil {
+		errs = append(errs, "stock is required")
+	}
+	return errs
+}
+
+func markPending(results []domain.ProductBatchResult, status string) {
+	for i := range results {
+		if len(results[i].Errors) > 0 {
+			results[i].Status = StatusFailed
+		} else {
+			results[i].Status = status
+		}
+	}
+}
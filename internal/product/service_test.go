@@ -0,0 +1,139 @@
+package product
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+func newProductOp(op string, id *int, code string) domain.ProductBatchOperation {
+	return domain.ProductBatchOperation{
+		Op: op,
+		ID: id,
+		Product: &domain.Product{
+			ProductCode: puntStr(code),
+			Name:        puntStr("Product " + code),
+			Description: puntStr("description"),
+			Price:       puntFloat(1.5),
+			Stock:       puntInt(5),
+		},
+	}
+}
+
+func TestBatchAtomicOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	ops := []domain.ProductBatchOperation{
+		newProductOp(OpCreate, nil, "NEW001"),
+		newProductOp(OpUpdate, puntInt(2), "OLD002"),
+		{Op: OpDelete, ID: puntInt(3)},
+	}
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id IN \\(\\?, \\?\\)").WithArgs("default", 2, 3).
+		WillReturnRows(mock.NewRows([]string{"id", "product_code", "name", "description", "price", "stock"}).
+			AddRow(2, "OLD002", "Product 2", "", 1.5, 5).AddRow(3, "OLD003", "Product 3", "", 1.5, 5))
+	mock.ExpectQuery("SELECT id, product_code FROM products WHERE tenant_id = \\? AND product_code IN").WithArgs("default", "NEW001", "OLD002").
+		WillReturnRows(mock.NewRows([]string{"id", "product_code"}).AddRow(2, "OLD002"))
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO products").WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").WithArgs(tenant.Default, "product", 10, "ProductCreated", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id IN \\(\\?\\) FOR UPDATE").WithArgs("default", 2).
+		WillReturnRows(mock.NewRows([]string{"id", "product_code", "name", "description", "price", "stock"}).
+			AddRow(2, "OLD002", "Product 2", "", 1.5, 5))
+	mock.ExpectExec("UPDATE products").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").WithArgs(tenant.Default, "product", 2, "ProductUpdated", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id IN \\(\\?\\) FOR UPDATE").WithArgs("default", 3).
+		WillReturnRows(mock.NewRows([]string{"id", "product_code", "name", "description", "price", "stock"}).
+			AddRow(3, "OLD003", "Product 3", "", 1.5, 5))
+	mock.ExpectExec("DELETE FROM products WHERE tenant_id = \\? AND id IN").WithArgs("default", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").WithArgs(tenant.Default, "product", 3, "ProductDeleted", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	service := NewService(NewRepository(db))
+	results, err := service.Batch(ctx, BatchAtomic, ops)
+
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCreated, results[0].Status)
+	assert.Equal(t, 10, *results[0].ID)
+	assert.Equal(t, StatusUpdated, results[1].Status)
+	assert.Equal(t, StatusDeleted, results[2].Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBatchAtomicErrSkipsAll(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	ops := []domain.ProductBatchOperation{
+		newProductOp(OpCreate, nil, "NEW001"),
+		newProductOp(OpCreate, nil, "DUP001"),
+		{Op: OpDelete},
+	}
+	mock.ExpectQuery("SELECT id, product_code FROM products WHERE tenant_id = \\? AND product_code IN").
+		WillReturnRows(mock.NewRows([]string{"id", "product_code"}).AddRow(4, "DUP001"))
+
+	service := NewService(NewRepository(db))
+	results, err := service.Batch(ctx, BatchAtomic, ops)
+
+	assert.NoError(t, err)
+	assert.Equal(t, StatusSkipped, results[0].Status)
+	assert.Equal(t, StatusFailed, results[1].Status)
+	assert.Equal(t, []string{ErrProductAlredyExist.Error()}, results[1].Errors)
+	assert.Equal(t, StatusFailed, results[2].Status)
+	assert.Equal(t, []string{"id is required"}, results[2].Errors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBatchBestEffortOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	ops := []domain.ProductBatchOperation{
+		newProductOp(OpCreate, nil, "NEW001"),
+		newProductOp(OpCreate, nil, "NEW001"),
+		{Op: OpDelete, ID: puntInt(9)},
+	}
+	mock.ExpectQuery("SELECT (.+) FROM products WHERE tenant_id = \\? AND id IN").WithArgs("default", 9).
+		WillReturnRows(mock.NewRows([]string{"id", "product_code", "name", "description", "price", "stock"}))
+	mock.ExpectQuery("SELECT id, product_code FROM products WHERE tenant_id = \\? AND product_code IN").
+		WillReturnRows(mock.NewRows([]string{"id", "product_code"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO products").WillReturnResult(sqlmock.NewResult(10, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	service := NewService(NewRepository(db))
+	results, err := service.Batch(ctx, BatchBestEffort, ops)
+
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCreated, results[0].Status)
+	assert.Equal(t, StatusFailed, results[1].Status)
+	assert.Equal(t, []string{"product_code is repeated in the batch"}, results[1].Errors)
+	assert.Equal(t, StatusFailed, results[2].Status)
+	assert.Equal(t, []string{ErrNotFound.Error()}, results[2].Errors)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,79 @@
+package product
+
+import (
+	"context"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type tracedService struct {
+	next Service
+}
+
+// Traced wraps a Service with a span per method call
+func Traced(next Service) Service {
+	return &tracedService{next: next}
+}
+
+func (s *tracedService) Get(ctx context.Context) (products []domain.Product, err error) {
+	ctx, span := tracing.Start(ctx, "product.Service.Get")
+	defer func() {
+		span.SetAttributes(attribute.Int("product.count", len(products)))
+		tracing.End(span, err)
+	}()
+	return s.next.Get(ctx)
+}
+
+func (s *tracedService) Stream(ctx context.Context, fn func(p domain.Product) error) (err error) {
+	ctx, span := tracing.Start(ctx, "product.Service.Stream")
+	defer func() { tracing.End(span, err) }()
+	return s.next.Stream(ctx, fn)
+}
+
+func (s *tracedService) GetById(ctx context.Context, id int) (p domain.Product, err error) {
+	ctx, span := tracing.Start(ctx, "product.Service.GetById")
+	span.SetAttributes(attribute.Int("product.id", id))
+	defer func() { tracing.End(span, err) }()
+	return s.next.GetById(ctx, id)
+}
+
+func (s *tracedService) Create(ctx context.Context, p domain.Product) (created domain.Product, err error) {
+	ctx, span := tracing.Start(ctx, "product.Service.Create")
+	defer func() {
+		if created.ID != nil {
+			span.SetAttributes(attribute.Int("product.id", *created.ID))
+		}
+		tracing.End(span, err)
+	}()
+	return s.next.Create(ctx, p)
+}
+
+func (s *tracedService) Update(ctx context.Context, id int, p domain.Product) (updated domain.Product, err error) {
+	ctx, span := tracing.Start(ctx, "product.Service.Update")
+	span.SetAttributes(attribute.Int("product.id", id))
+	defer func() { tracing.End(span, err) }()
+	return s.next.Update(ctx, id, p)
+}
+
+func (s *tracedService) Delete(ctx context.Context, id int) (err error) {
+	ctx, span := tracing.Start(ctx, "product.Service.Delete")
+	span.SetAttributes(attribute.Int("product.id", id))
+	defer func() { tracing.End(span, err) }()
+	return s.next.Delete(ctx, id)
+}
+
+func (s *tracedService) Batch(ctx context.Context, mode string, ops []domain.ProductBatchOperation) (results []domain.ProductBatchResult, err error) {
+	ctx, span := tracing.Start(ctx, "product.Service.Batch")
+	span.SetAttributes(attribute.String("product.batch.mode", mode), attribute.Int("product.batch.size", len(ops)))
+	defer func() { tracing.End(span, err) }()
+	return s.next.Batch(ctx, mode, ops)
+}
+
+func (s *tracedService) ValidateBatch(ctx context.Context, ops []domain.ProductBatchOperation) (results []domain.ProductBatchResult, err error) {
+	ctx, span := tracing.Start(ctx, "product.Service.ValidateBatch")
+	span.SetAttributes(attribute.Int("product.batch.size", len(ops)))
+	defer func() { tracing.End(span, err) }()
+	return s.next.ValidateBatch(ctx, ops)
+}
@@ -0,0 +1,122 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/db"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+type Repository interface {
+	GetById(ctx context.Context, id int) (domain.User, error)
+	// GetByEmail finds the user in the tenant of ctx, emails are unique
+	// per tenant
+	GetByEmail(ctx context.Context, email string) (domain.User, error)
+	Save(ctx context.Context, u domain.User) (int, error)
+	SetRoles(ctx context.Context, id int, roles []string) error
+	// SetPassword also clears failed logins and any lockout
+	SetPassword(ctx context.Context, id int, hash string) error
+	// LoginFailed counts a failed login and locks the account until
+	// lockUntil once maxFailures have failed in a row
+	LoginFailed(ctx context.Context, id, maxFailures int, lockUntil time.Time) error
+	LoginSucceeded(ctx context.Context, id int) error
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// conn joins the transaction active in ctx, if any, labelling its
+// statements with the repository method op
+func (r *repository) conn(ctx context.Context, op string) db.Executor {
+	return db.Conn(ctx, r.db, "user", op)
+}
+
+// Query all users
+var (
+	userColumns         = `id, email, name, roles, tenant_id, password_hash, failed_logins, locked_until, created_at`
+	getUserByIdQuery    = `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+	getUserByEmailQuery = `SELECT ` + userColumns + ` FROM users WHERE tenant_id = ? AND email = ?`
+	// Emails are unique per tenant, the key is (tenant_id, email)
+	createUserQuery  = `INSERT INTO users (email, name, roles, tenant_id, password_hash, failed_logins, created_at) VALUES (?, ?, ?, ?, ?, 0, ?)`
+	setRolesQuery    = `UPDATE users SET roles = ? WHERE id = ?`
+	setPasswordQuery = `UPDATE users SET password_hash = ?, failed_logins = 0, locked_until = NULL WHERE id = ?`
+	// The count starts over once the account is locked
+	loginFailedQuery = `UPDATE users SET locked_until = IF(failed_logins + 1 >= ?, ?, locked_until),
+		failed_logins = IF(failed_logins + 1 >= ?, 0, failed_logins + 1) WHERE id = ?`
+	loginSucceededQuery = `UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ?`
+)
+
+func (r *repository) GetById(ctx context.Context, id int) (domain.User, error) {
+	u, err := scanUser(r.conn(ctx, "GetById").QueryRowContext(ctx, getUserByIdQuery, id))
+	if err == sql.ErrNoRows {
+		return u, ErrNotFound
+	}
+	return u, err
+}
+
+func (r *repository) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	u, err := scanUser(r.conn(ctx, "GetByEmail").QueryRowContext(ctx, getUserByEmailQuery, tenant.FromContext(ctx), email))
+	if err == sql.ErrNoRows {
+		return u, ErrNotFound
+	}
+	return u, err
+}
+
+func (r *repository) Save(ctx context.Context, u domain.User) (int, error) {
+	res, err := r.conn(ctx, "Save").ExecContext(ctx, createUserQuery, u.Email, u.Name, strings.Join(u.Roles, ","), u.Tenant, u.PasswordHash, u.CreatedAt)
+	if db.IsDuplicateKey(err) {
+		return 0, ErrEmailTaken
+	}
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *repository) SetRoles(ctx context.Context, id int, roles []string) error {
+	_, err := r.conn(ctx, "SetRoles").ExecContext(ctx, setRolesQuery, strings.Join(roles, ","), id)
+	return err
+}
+
+func (r *repository) SetPassword(ctx context.Context, id int, hash string) error {
+	_, err := r.conn(ctx, "SetPassword").ExecContext(ctx, setPasswordQuery, hash, id)
+	return err
+}
+
+func (r *repository) LoginFailed(ctx context.Context, id, maxFailures int, lockUntil time.Time) error {
+	_, err := r.conn(ctx, "LoginFailed").ExecContext(ctx, loginFailedQuery, maxFailures, lockUntil, maxFailures, id)
+	return err
+}
+
+func (r *repository) LoginSucceeded(ctx context.Context, id int) error {
+	_, err := r.conn(ctx, "LoginSucceeded").ExecContext(ctx, loginSucceededQuery, id)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(s scanner) (domain.User, error) {
+	var u domain.User
+	var roles string
+	err := s.Scan(&u.ID, &u.Email, &u.Name, &roles, &u.Tenant, &u.PasswordHash, &u.FailedLogins, &u.LockedUntil, &u.CreatedAt)
+	u.Roles = []string{}
+	if roles != "" {
+		u.Roles = strings.Split(roles, ",")
+	}
+	return u, err
+}
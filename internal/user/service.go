@@ -0,0 +1,275 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/notify"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Service interface {
+	Register(ctx context.Context, u domain.User, password string) (domain.User, error)
+	GetById(ctx context.Context, id int) (domain.User, error)
+	SetRoles(ctx context.Context, id int, roles []string) (domain.User, error)
+	Login(ctx context.Context, email, password string) (Tokens, error)
+	// Refresh rotates the refresh token, reloading the user's roles
+	Refresh(ctx context.Context, refreshToken string) (Tokens, error)
+	Logout(ctx context.Context, refreshToken string) error
+	// RequestPasswordReset mails a reset token when email belongs to a
+	// user, and answers the same either way
+	RequestPasswordReset(ctx context.Context, email string) error
+	// ResetPassword also ends every session of the user
+	ResetPassword(ctx context.Context, token, password string) error
+}
+
+// Tokens are returned by login and refresh
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+const (
+	// MaxFailedLogins failed logins in a row lock an account for
+	// LockoutDuration
+	MaxFailedLogins = 5
+	LockoutDuration = 15 * time.Minute
+	// SubjectPrefix precedes the user id in the subject of access tokens
+	SubjectPrefix     = "user:"
+	minPasswordLength = 8
+	// bcrypt ignores anything longer
+	maxPasswordBytes = 72
+)
+
+var (
+	ErrNotFound            = errors.New("user not found")
+	ErrEmailTaken          = errors.New("email already registered")
+	ErrInvalidEmail        = errors.New("invalid email")
+	ErrWeakPassword        = fmt.Errorf("password must have at least %d characters", minPasswordLength)
+	ErrPasswordTooLong     = fmt.Errorf("password can't be longer than %d bytes", maxPasswordBytes)
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrLocked              = errors.New("account locked after repeated failed logins, try again later")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token already used, session ended")
+	ErrInvalidResetToken   = errors.New("invalid or expired reset token")
+)
+
+// Compared against when the email is unknown, so both cases take as long
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+type service struct {
+	repo     Repository
+	sessions Sessions
+	issuer   auth.Issuer
+	mailer   notify.Notifier
+	resetURL string
+}
+
+// NewService mails reset tokens through mailer, appended to
+// PASSWORD_RESET_URL when it is set
+func NewService(repo Repository, sessions Sessions, issuer auth.Issuer, mailer notify.Notifier) Service {
+	return &service{repo: repo, sessions: sessions, issuer: issuer, mailer: mailer, resetURL: os.Getenv("PASSWORD_RESET_URL")}
+}
+
+func (s *service) Register(ctx context.Context, u domain.User, password string) (domain.User, error) {
+	email, err := normalizeEmail(u.Email)
+	if err != nil {
+		return u, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return u, err
+	}
+	if _, err := s.repo.GetByEmail(ctx, email); err == nil {
+		return u, ErrEmailTaken
+	} else if !errors.Is(err, ErrNotFound) {
+		return u, err
+	}
+
+	u.Email = email
+	u.Name = strings.TrimSpace(u.Name)
+	u.Roles = []string{}
+	u.Tenant = tenant.FromContext(ctx)
+	u.PasswordHash = hash
+	u.CreatedAt = time.Now().UTC()
+	id, err := s.repo.Save(ctx, u)
+	if err != nil {
+		return u, err
+	}
+	u.ID = id
+	return u, nil
+}
+
+// GetById only finds users of the tenant of ctx
+func (s *service) GetById(ctx context.Context, id int) (domain.User, error) {
+	u, err := s.repo.GetById(ctx, id)
+	if err == nil && u.Tenant != tenant.FromContext(ctx) {
+		return domain.User{}, ErrNotFound
+	}
+	return u, err
+}
+
+func (s *service) SetRoles(ctx context.Context, id int, roles []string) (domain.User, error) {
+	u, err := s.GetById(ctx, id)
+	if err != nil {
+		return u, err
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+	if err := s.repo.SetRoles(ctx, id, roles); err != nil {
+		return u, err
+	}
+	u.Roles = roles
+	return u, nil
+}
+
+func (s *service) Login(ctx context.Context, email, password string) (Tokens, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return Tokens{}, ErrInvalidCredentials
+	}
+	u, err := s.repo.GetByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return Tokens{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	now := time.Now().UTC()
+	if u.LockedUntil != nil && u.LockedUntil.After(now) {
+		return Tokens{}, ErrLocked
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		if err := s.repo.LoginFailed(ctx, u.ID, MaxFailedLogins, now.Add(LockoutDuration)); err != nil {
+			return Tokens{}, err
+		}
+		return Tokens{}, ErrInvalidCredentials
+	}
+	if u.FailedLogins > 0 || u.LockedUntil != nil {
+		if err := s.repo.LoginSucceeded(ctx, u.ID); err != nil {
+			return Tokens{}, err
+		}
+	}
+
+	refresh, err := s.sessions.Create(ctx, u.ID)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return s.tokens(u, refresh)
+}
+
+func (s *service) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	id, next, err := s.sessions.Rotate(ctx, refreshToken)
+	if err != nil {
+		return Tokens{}, err
+	}
+	u, err := s.repo.GetById(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	return s.tokens(u, next)
+}
+
+func (s *service) Logout(ctx context.Context, refreshToken string) error {
+	return s.sessions.Revoke(ctx, refreshToken)
+}
+
+func (s *service) RequestPasswordReset(ctx context.Context, email string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil
+	}
+	u, err := s.repo.GetByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := s.sessions.CreateReset(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Notify(ctx, notify.Message{
+		To:      []string{u.Email},
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use this to choose a new password within %d minutes: %s%s\n\nIf you didn't ask for it, ignore this email.",
+			int(ResetTTL.Minutes()), s.resetURL, token),
+	})
+}
+
+func (s *service) ResetPassword(ctx context.Context, token, password string) error {
+	// Validate first so a rejected password doesn't use up the token
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	id, err := s.sessions.ConsumeReset(ctx, token)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetPassword(ctx, id, hash); err != nil {
+		return err
+	}
+	return s.sessions.RevokeAll(ctx, id)
+}
+
+func (s *service) tokens(u domain.User, refresh string) (Tokens, error) {
+	access, expiresAt, err := s.issuer.Issue(auth.Principal{Subject: SubjectPrefix + strconv.Itoa(u.ID), Roles: u.Roles, Tenant: u.Tenant})
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(expiresAt).Round(time.Second).Seconds()),
+		RefreshToken: refresh,
+	}, nil
+}
+
+// UserID returns the id of the user p stands for, if it is one
+func UserID(p auth.Principal) (int, bool) {
+	if !strings.HasPrefix(p.Subject, SubjectPrefix) {
+		return 0, false
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(p.Subject, SubjectPrefix))
+	return id, err == nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Name != "" {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+func hashPassword(password string) (string, error) {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return "", ErrWeakPassword
+	}
+	if len(password) > maxPasswordBytes {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
@@ -0,0 +1,278 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/notify"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+var ctx = context.Background()
+
+var authConfig = auth.Config{HS256Secret: []byte("test-secret")}
+
+// repoStub keeps users in memory, applying lockouts like the query does
+type repoStub struct {
+	Repository
+	users map[int]domain.User
+}
+
+func (r *repoStub) GetById(ctx context.Context, id int) (domain.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return u, ErrNotFound
+	}
+	return u, nil
+}
+
+func (r *repoStub) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	for _, u := range r.users {
+		if u.Tenant == tenant.FromContext(ctx) && u.Email == email {
+			return u, nil
+		}
+	}
+	return domain.User{}, ErrNotFound
+}
+
+func (r *repoStub) Save(ctx context.Context, u domain.User) (int, error) {
+	u.ID = len(r.users) + 1
+	r.users[u.ID] = u
+	return u.ID, nil
+}
+
+func (r *repoStub) SetRoles(ctx context.Context, id int, roles []string) error {
+	u := r.users[id]
+	u.Roles = roles
+	r.users[id] = u
+	return nil
+}
+
+func (r *repoStub) SetPassword(ctx context.Context, id int, hash string) error {
+	u := r.users[id]
+	u.PasswordHash, u.FailedLogins, u.LockedUntil = hash, 0, nil
+	r.users[id] = u
+	return nil
+}
+
+func (r *repoStub) LoginFailed(ctx context.Context, id, maxFailures int, lockUntil time.Time) error {
+	u := r.users[id]
+	u.FailedLogins++
+	if u.FailedLogins >= maxFailures {
+		u.FailedLogins, u.LockedUntil = 0, &lockUntil
+	}
+	r.users[id] = u
+	return nil
+}
+
+func (r *repoStub) LoginSucceeded(ctx context.Context, id int) error {
+	u := r.users[id]
+	u.FailedLogins, u.LockedUntil = 0, nil
+	r.users[id] = u
+	return nil
+}
+
+// sessionsStub tracks tokens in memory without rotation history
+type sessionsStub struct {
+	refresh map[string]int
+	resets  map[string]int
+}
+
+func (s *sessionsStub) Create(ctx context.Context, userID int) (string, error) {
+	token := newToken()
+	s.refresh[token] = userID
+	return token, nil
+}
+
+func (s *sessionsStub) Rotate(ctx context.Context, token string) (int, string, error) {
+	id, ok := s.refresh[token]
+	if !ok {
+		return 0, "", ErrInvalidRefreshToken
+	}
+	delete(s.refresh, token)
+	next, _ := s.Create(ctx, id)
+	return id, next, nil
+}
+
+func (s *sessionsStub) Revoke(ctx context.Context, token string) error {
+	delete(s.refresh, token)
+	return nil
+}
+
+func (s *sessionsStub) RevokeAll(ctx context.Context, userID int) error {
+	for token, id := range s.refresh {
+		if id == userID {
+			delete(s.refresh, token)
+		}
+	}
+	return nil
+}
+
+func (s *sessionsStub) CreateReset(ctx context.Context, userID int) (string, error) {
+	token := newToken()
+	s.resets[token] = userID
+	return token, nil
+}
+
+func (s *sessionsStub) ConsumeReset(ctx context.Context, token string) (int, error) {
+	id, ok := s.resets[token]
+	if !ok {
+		return 0, ErrInvalidResetToken
+	}
+	delete(s.resets, token)
+	return id, nil
+}
+
+// mailerStub keeps the messages sent
+type mailerStub struct {
+	sent []notify.Message
+}
+
+func (m *mailerStub) Notify(ctx context.Context, msg notify.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newTestService() (Service, *repoStub, *sessionsStub, *mailerStub) {
+	repo := &repoStub{users: map[int]domain.User{}}
+	sessions := &sessionsStub{refresh: map[string]int{}, resets: map[string]int{}}
+	mailer := &mailerStub{}
+	return NewService(repo, sessions, auth.NewIssuer(authConfig, time.Minute), mailer), repo, sessions, mailer
+}
+
+func TestRegisterOk(t *testing.T) {
+	s, repo, _, _ := newTestService()
+
+	u, err := s.Register(ctx, domain.User{Email: " Ana@Example.com ", Name: "Ana"}, "correct horse")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, u.ID)
+	assert.Equal(t, "ana@example.com", u.Email)
+	assert.NotContains(t, repo.users[1].PasswordHash, "correct horse")
+}
+
+func TestRegisterErr(t *testing.T) {
+	s, _, _, _ := newTestService()
+	_, err := s.Register(ctx, domain.User{Email: "ana@example.com"}, "correct horse")
+	assert.NoError(t, err)
+
+	_, err = s.Register(ctx, domain.User{Email: "ANA@example.com"}, "correct horse")
+	assert.ErrorIs(t, err, ErrEmailTaken)
+	_, err = s.Register(ctx, domain.User{Email: "not an email"}, "correct horse")
+	assert.ErrorIs(t, err, ErrInvalidEmail)
+	_, err = s.Register(ctx, domain.User{Email: "bob@example.com"}, "short")
+	assert.ErrorIs(t, err, ErrWeakPassword)
+}
+
+func TestLoginOk(t *testing.T) {
+	s, _, _, _ := newTestService()
+	u, _ := s.Register(ctx, domain.User{Email: "ana@example.com"}, "correct horse")
+	s.SetRoles(ctx, u.ID, []string{"orders:read"})
+
+	tokens, err := s.Login(ctx, "ana@example.com", "correct horse")
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.NotEmpty(t, tokens.RefreshToken)
+
+	p, err := auth.NewVerifier(authConfig).Verify(tokens.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, auth.Principal{Subject: "user:1", Roles: []string{"orders:read"}, Tenant: tenant.Default}, p)
+}
+
+func TestGetByIdErrOtherTenant(t *testing.T) {
+	s, _, _, _ := newTestService()
+	acme := tenant.WithID(ctx, "acme")
+	u, _ := s.Register(acme, domain.User{Email: "ana@example.com"}, "correct horse")
+
+	_, err := s.GetById(acme, u.ID)
+	assert.NoError(t, err)
+	_, err = s.GetById(ctx, u.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = s.SetRoles(ctx, u.ID, []string{auth.RoleAdmin})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Tokens carry the tenant the user registered in
+	tokens, _ := s.Login(acme, "ana@example.com", "correct horse")
+	p, _ := auth.NewVerifier(authConfig).Verify(tokens.AccessToken)
+	assert.Equal(t, "acme", p.Tenant)
+}
+
+func TestRegisterOkSameEmailOtherTenant(t *testing.T) {
+	s, _, _, _ := newTestService()
+	acme := tenant.WithID(ctx, "acme")
+	_, err := s.Register(acme, domain.User{Email: "ana@example.com"}, "correct horse")
+	assert.NoError(t, err)
+
+	_, err = s.Login(ctx, "ana@example.com", "correct horse")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = s.Register(ctx, domain.User{Email: "ana@example.com"}, "battery staple")
+	assert.NoError(t, err)
+	_, err = s.Register(acme, domain.User{Email: "ana@example.com"}, "battery staple")
+	assert.ErrorIs(t, err, ErrEmailTaken)
+}
+
+func TestLoginErrLocked(t *testing.T) {
+	s, repo, _, _ := newTestService()
+	s.Register(ctx, domain.User{Email: "ana@example.com"}, "correct horse")
+
+	_, err := s.Login(ctx, "nobody@example.com", "correct horse")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	for i := 0; i < MaxFailedLogins; i++ {
+		_, err = s.Login(ctx, "ana@example.com", "wrong horse")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+	assert.NotNil(t, repo.users[1].LockedUntil)
+
+	// Even the right password is refused while locked
+	_, err = s.Login(ctx, "ana@example.com", "correct horse")
+	assert.ErrorIs(t, err, ErrLocked)
+}
+
+func TestRefreshOk(t *testing.T) {
+	s, _, _, _ := newTestService()
+	u, _ := s.Register(ctx, domain.User{Email: "ana@example.com"}, "correct horse")
+	tokens, _ := s.Login(ctx, "ana@example.com", "correct horse")
+	s.SetRoles(ctx, u.ID, []string{"products:write"})
+
+	next, err := s.Refresh(ctx, tokens.RefreshToken)
+	assert.NoError(t, err)
+	assert.NotEqual(t, tokens.RefreshToken, next.RefreshToken)
+
+	// Roles granted since login show up in the new access token
+	p, _ := auth.NewVerifier(authConfig).Verify(next.AccessToken)
+	assert.Equal(t, []string{"products:write"}, p.Roles)
+
+	_, err = s.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestResetPasswordOk(t *testing.T) {
+	s, _, sessions, mailer := newTestService()
+	s.Register(ctx, domain.User{Email: "ana@example.com"}, "correct horse")
+	tokens, _ := s.Login(ctx, "ana@example.com", "correct horse")
+
+	assert.NoError(t, s.RequestPasswordReset(ctx, "nobody@example.com"))
+	assert.Empty(t, mailer.sent)
+	assert.NoError(t, s.RequestPasswordReset(ctx, "ana@example.com"))
+	assert.Len(t, mailer.sent, 1)
+	assert.Equal(t, []string{"ana@example.com"}, mailer.sent[0].To)
+
+	var token string
+	for k := range sessions.resets {
+		token = k
+	}
+	assert.Contains(t, mailer.sent[0].Body, token)
+	assert.ErrorIs(t, s.ResetPassword(ctx, token, "short"), ErrWeakPassword)
+	assert.NoError(t, s.ResetPassword(ctx, token, "battery staple"))
+	assert.ErrorIs(t, s.ResetPassword(ctx, token, "battery staple"), ErrInvalidResetToken)
+
+	// Sessions started with the old password are over
+	_, err := s.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, err = s.Login(ctx, "ana@example.com", "battery staple")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,191 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// RefreshTTL is how long a session lasts without being refreshed
+	RefreshTTL = 30 * 24 * time.Hour
+	// ResetTTL is how long a password reset token can be used
+	ResetTTL = 30 * time.Minute
+)
+
+// Sessions keeps refresh and password reset tokens. Tokens are stored by
+// hash, so reading Redis doesn't hand out working tokens.
+type Sessions interface {
+	// Create starts a session for userID and returns its first refresh token
+	Create(ctx context.Context, userID int) (string, error)
+	// Rotate exchanges a refresh token for the next one of its session.
+	// Presenting a token twice ends the session, as it was likely stolen.
+	Rotate(ctx context.Context, token string) (userID int, next string, err error)
+	// Revoke ends the session of token
+	Revoke(ctx context.Context, token string) error
+	RevokeAll(ctx context.Context, userID int) error
+	CreateReset(ctx context.Context, userID int) (string, error)
+	// ConsumeReset returns the user of a reset token, which works once
+	ConsumeReset(ctx context.Context, token string) (int, error)
+}
+
+type redisSessions struct {
+	rd *redis.Client
+}
+
+func NewRedisSessions(rd *redis.Client) Sessions {
+	return &redisSessions{rd: rd}
+}
+
+// refreshToken is stored under the hash of each issued token
+type refreshToken struct {
+	UserID  int    `json:"user_id"`
+	Session string `json:"session"`
+}
+
+func (s *redisSessions) Create(ctx context.Context, userID int) (string, error) {
+	session := newToken()
+	_, err := s.rd.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Set(ctx, sessionKey(session), userID, RefreshTTL)
+		p.SAdd(ctx, userSessionsKey(userID), session)
+		p.Expire(ctx, userSessionsKey(userID), RefreshTTL)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return s.issue(ctx, refreshToken{UserID: userID, Session: session})
+}
+
+func (s *redisSessions) Rotate(ctx context.Context, token string) (int, string, error) {
+	hash := hashToken(token)
+	data, err := s.rd.Get(ctx, refreshKey(hash)).Bytes()
+	if err == redis.Nil {
+		return 0, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	var rt refreshToken
+	if err := json.Unmarshal(data, &rt); err != nil {
+		return 0, "", err
+	}
+
+	alive, err := s.rd.Exists(ctx, sessionKey(rt.Session)).Result()
+	if err != nil {
+		return 0, "", err
+	}
+	if alive == 0 {
+		return 0, "", ErrInvalidRefreshToken
+	}
+	// Only the first exchange of a token wins
+	first, err := s.rd.SetNX(ctx, usedKey(hash), 1, RefreshTTL).Result()
+	if err != nil {
+		return 0, "", err
+	}
+	if !first {
+		s.rd.Del(ctx, sessionKey(rt.Session))
+		return 0, "", ErrRefreshTokenReused
+	}
+
+	if err := s.rd.Expire(ctx, sessionKey(rt.Session), RefreshTTL).Err(); err != nil {
+		return 0, "", err
+	}
+	next, err := s.issue(ctx, rt)
+	return rt.UserID, next, err
+}
+
+func (s *redisSessions) Revoke(ctx context.Context, token string) error {
+	data, err := s.rd.Get(ctx, refreshKey(hashToken(token))).Bytes()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var rt refreshToken
+	if err := json.Unmarshal(data, &rt); err != nil {
+		return err
+	}
+	return s.rd.Del(ctx, sessionKey(rt.Session)).Err()
+}
+
+func (s *redisSessions) RevokeAll(ctx context.Context, userID int) error {
+	sessions, err := s.rd.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{userSessionsKey(userID)}
+	for _, session := range sessions {
+		keys = append(keys, sessionKey(session))
+	}
+	return s.rd.Del(ctx, keys...).Err()
+}
+
+func (s *redisSessions) CreateReset(ctx context.Context, userID int) (string, error) {
+	token := newToken()
+	return token, s.rd.Set(ctx, resetKey(hashToken(token)), userID, ResetTTL).Err()
+}
+
+func (s *redisSessions) ConsumeReset(ctx context.Context, token string) (int, error) {
+	key := resetKey(hashToken(token))
+	var get *redis.StringCmd
+	_, err := s.rd.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		get = p.Get(ctx, key)
+		p.Del(ctx, key)
+		return nil
+	})
+	if err == redis.Nil {
+		return 0, ErrInvalidResetToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	return get.Int()
+}
+
+func (s *redisSessions) issue(ctx context.Context, rt refreshToken) (string, error) {
+	data, err := json.Marshal(rt)
+	if err != nil {
+		return "", err
+	}
+	token := newToken()
+	return token, s.rd.Set(ctx, refreshKey(hashToken(token)), data, RefreshTTL).Err()
+}
+
+func newToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func refreshKey(hash string) string {
+	return "refresh[" + hash + "]"
+}
+
+func usedKey(hash string) string {
+	return "refresh:used[" + hash + "]"
+}
+
+func sessionKey(session string) string {
+	return "session[" + session + "]"
+}
+
+func userSessionsKey(userID int) string {
+	return "sessions:user[" + strconv.Itoa(userID) + "]"
+}
+
+func resetKey(hash string) string {
+	return "password_reset[" + hash + "]"
+}
@@ -0,0 +1,214 @@
+package warehouse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/inventory"
+	"github.com/vincentconace/api-gin/pkg/db"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+type Repository interface {
+	Get(ctx context.Context) ([]domain.Warehouse, error)
+	GetById(ctx context.Context, id int) (domain.Warehouse, error)
+	Save(ctx context.Context, w domain.Warehouse) (int, error)
+	Update(ctx context.Context, id int, w domain.Warehouse) error
+	Delete(ctx context.Context, id int) error
+	Exists(ctx context.Context, code string) bool
+	Levels(ctx context.Context, productID int) ([]domain.StockLevel, error)
+	Reserved(ctx context.Context, productID int) (int, error)
+	SetLevel(ctx context.Context, warehouseID, productID, quantity int) error
+	Transfer(ctx context.Context, t domain.Transfer) (domain.Transfer, error)
+}
+
+type repository struct {
+	db        *sql.DB
+	txm       db.TxManager
+	inventory inventory.Repository
+}
+
+func NewRepository(conn *sql.DB) Repository {
+	return &repository{db: conn, txm: db.NewTxManager(conn), inventory: inventory.NewRepository(conn)}
+}
+
+// conn joins the transaction active in ctx, if any, labelling its
+// statements with the repository method op
+func (r *repository) conn(ctx context.Context, op string) db.Executor {
+	return db.Conn(ctx, r.db, "warehouse", op)
+}
+
+// Query all warehouses. Every query is scoped to the tenant of the context,
+// whose id is their first argument.
+var (
+	getWarehousesQuery    = `SELECT id, code, name, address FROM warehouses WHERE tenant_id = ?`
+	getWarehouseByIdQuery = `SELECT id, code, name, address FROM warehouses WHERE tenant_id = ? AND id = ?`
+	createWarehouseQuery  = `INSERT INTO warehouses (tenant_id, code, name, address) VALUES (?, ?, ?, ?)`
+	updateWarehouseQuery  = `UPDATE warehouses SET code = ?, name = ?, address = ? WHERE tenant_id = ? AND id = ?`
+	deleteWarehouseQuery  = `DELETE FROM warehouses WHERE tenant_id = ? AND id = ?`
+	existWarehouseQuery   = `SELECT id FROM warehouses WHERE tenant_id = ? AND code = ?`
+	warehouseOnHandQuery  = `SELECT COALESCE(SUM(s.quantity), 0) FROM warehouse_stock s JOIN warehouses w ON w.id = s.warehouse_id WHERE w.tenant_id = ? AND s.warehouse_id = ?`
+	getStockLevelsQuery   = `SELECT w.id, w.code, w.name, s.quantity FROM warehouse_stock s JOIN warehouses w ON w.id = s.warehouse_id AND w.tenant_id = ? JOIN products p ON p.id = s.product_id AND p.tenant_id = w.tenant_id WHERE s.product_id = ? ORDER BY w.id`
+	getReservedQuery      = `SELECT COALESCE(SUM(quantity), 0) FROM stock_reservations WHERE tenant_id = ? AND product_id = ? AND status = 'pending'`
+	createTransferQuery   = `INSERT INTO warehouse_transfers (tenant_id, product_id, from_warehouse_id, to_warehouse_id, quantity, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+)
+
+func (r *repository) Get(ctx context.Context) ([]domain.Warehouse, error) {
+	rows, err := r.conn(ctx, "Get").QueryContext(ctx, getWarehousesQuery, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var warehouses []domain.Warehouse
+	for rows.Next() {
+		var w domain.Warehouse
+		if err := rows.Scan(&w.ID, &w.Code, &w.Name, &w.Address); err != nil {
+			return nil, err
+		}
+		warehouses = append(warehouses, w)
+	}
+	return warehouses, rows.Err()
+}
+
+func (r *repository) GetById(ctx context.Context, id int) (domain.Warehouse, error) {
+	var w domain.Warehouse
+	err := r.conn(ctx, "GetById").QueryRowContext(ctx, getWarehouseByIdQuery, tenant.FromContext(ctx), id).Scan(&w.ID, &w.Code, &w.Name, &w.Address)
+	if err == sql.ErrNoRows {
+		return w, ErrNotFound
+	}
+	return w, err
+}
+
+func (r *repository) Save(ctx context.Context, w domain.Warehouse) (int, error) {
+	res, err := r.conn(ctx, "Save").ExecContext(ctx, createWarehouseQuery, tenant.FromContext(ctx), w.Code, w.Name, w.Address)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *repository) Update(ctx context.Context, id int, w domain.Warehouse) error {
+	_, err := r.conn(ctx, "Update").ExecContext(ctx, updateWarehouseQuery, w.Code, w.Name, w.Address, tenant.FromContext(ctx), id)
+	return err
+}
+
+func (r *repository) Delete(ctx context.Context, id int) error {
+	var onHand int
+	if err := r.conn(ctx, "Delete").QueryRowContext(ctx, warehouseOnHandQuery, tenant.FromContext(ctx), id).Scan(&onHand); err != nil {
+		return err
+	}
+	if onHand > 0 {
+		return ErrWarehouseNotEmpty
+	}
+
+	res, err := r.conn(ctx, "Delete").ExecContext(ctx, deleteWarehouseQuery, tenant.FromContext(ctx), id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *repository) Exists(ctx context.Context, code string) bool {
+	row := r.conn(ctx, "Exists").QueryRowContext(ctx, existWarehouseQuery, tenant.FromContext(ctx), code)
+	var id int
+	return row.Scan(&id) == nil
+}
+
+func (r *repository) Levels(ctx context.Context, productID int) ([]domain.StockLevel, error) {
+	rows, err := r.conn(ctx, "Levels").QueryContext(ctx, getStockLevelsQuery, tenant.FromContext(ctx), productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	levels := []domain.StockLevel{}
+	for rows.Next() {
+		var l domain.StockLevel
+		if err := rows.Scan(&l.WarehouseID, &l.WarehouseCode, &l.WarehouseName, &l.Quantity); err != nil {
+			return nil, err
+		}
+		levels = append(levels, l)
+	}
+	return levels, rows.Err()
+}
+
+func (r *repository) Reserved(ctx context.Context, productID int) (int, error) {
+	var reserved int
+	err := r.conn(ctx, "Reserved").QueryRowContext(ctx, getReservedQuery, tenant.FromContext(ctx), productID).Scan(&reserved)
+	return reserved, err
+}
+
+func (r *repository) SetLevel(ctx context.Context, warehouseID, productID, quantity int) error {
+	if err := checkExists(ctx, r.conn(ctx, "SetLevel"), getWarehouseByIdQuery, ErrNotFound, tenant.FromContext(ctx), warehouseID); err != nil {
+		return err
+	}
+	return stockError(r.inventory.SetLevel(ctx, warehouseID, productID, quantity))
+}
+
+func (r *repository) Transfer(ctx context.Context, t domain.Transfer) (domain.Transfer, error) {
+	err := r.txm.WithinTx(ctx, func(ctx context.Context) error {
+		for _, id := range []int{t.FromWarehouseID, t.ToWarehouseID} {
+			if err := checkExists(ctx, r.conn(ctx, "Transfer"), getWarehouseByIdQuery, ErrNotFound, tenant.FromContext(ctx), id); err != nil {
+				return err
+			}
+		}
+
+		res, err := r.conn(ctx, "Transfer").ExecContext(ctx, createTransferQuery, tenant.FromContext(ctx), t.ProductID, t.FromWarehouseID, t.ToWarehouseID, t.Quantity, t.CreatedAt)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		t.ID = int(id)
+
+		err = r.inventory.Transfer(ctx, t.ProductID, t.FromWarehouseID, t.ToWarehouseID, t.Quantity, fmt.Sprintf("transfer:%d", t.ID))
+		return stockError(err)
+	})
+	return t, err
+}
+
+// stockError maps inventory errors to the ones of this package
+func stockError(err error) error {
+	switch {
+	case errors.Is(err, inventory.ErrProductNotFound):
+		return ErrProductNotFound
+	case errors.Is(err, inventory.ErrWarehouseNotFound):
+		return ErrNotFound
+	case errors.Is(err, inventory.ErrInsufficientStock):
+		return ErrInsufficientStock
+	}
+	return err
+}
+
+// checkExists runs query with args and maps a missing row to notFound
+func checkExists(ctx context.Context, ex db.Executor, query string, notFound error, args ...interface{}) error {
+	rows, err := ex.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package warehouse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+var ctx = context.Background()
+
+var transferMock = domain.Transfer{
+	ProductID:       1,
+	FromWarehouseID: 1,
+	ToWarehouseID:   2,
+	Quantity:        5,
+	CreatedAt:       time.Now(),
+}
+
+func TestTransferOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	colums := []string{"id", "code", "name", "address"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, code, name, address FROM warehouses WHERE tenant_id = \\? AND id = \\?").
+		WithArgs(tenant.Default, 1).WillReturnRows(mock.NewRows(colums).AddRow(1, "WH1", "Main", ""))
+	mock.ExpectQuery("SELECT id, code, name, address FROM warehouses WHERE tenant_id = \\? AND id = \\?").
+		WithArgs(tenant.Default, 2).WillReturnRows(mock.NewRows(colums).AddRow(2, "WH2", "North", ""))
+	mock.ExpectExec("INSERT INTO warehouse_transfers").WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs(tenant.Default, 1).WillReturnRows(mock.NewRows([]string{"stock"}).AddRow(8))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").
+		WithArgs(tenant.Default, 1).WillReturnRows(mock.NewRows([]string{"warehouse_id", "quantity"}).AddRow(1, 8))
+	for _, move := range []struct{ warehouseID, delta int }{{1, -5}, {2, 5}} {
+		mock.ExpectExec("INSERT INTO warehouse_stock").
+			WithArgs(move.warehouseID, 1, move.delta).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE products SET stock = GREATEST").WithArgs(1, 1, tenant.Default, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\?").
+			WithArgs(tenant.Default, 1).WillReturnRows(mock.NewRows([]string{"stock"}).AddRow(8))
+		mock.ExpectExec("INSERT INTO inventory_ledger").
+			WithArgs(tenant.Default, 1, move.warehouseID, move.delta, "transfer", "transfer:7", 8, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO outbox_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	repository := NewRepository(db)
+	transfer, err := repository.Transfer(ctx, transferMock)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 7, transfer.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransferErrInsufficientStock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	colums := []string{"id", "code", "name", "address"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, code, name, address FROM warehouses WHERE tenant_id = \\? AND id = \\?").
+		WithArgs(tenant.Default, 1).WillReturnRows(mock.NewRows(colums).AddRow(1, "WH1", "Main", ""))
+	mock.ExpectQuery("SELECT id, code, name, address FROM warehouses WHERE tenant_id = \\? AND id = \\?").
+		WithArgs(tenant.Default, 2).WillReturnRows(mock.NewRows(colums).AddRow(2, "WH2", "North", ""))
+	mock.ExpectExec("INSERT INTO warehouse_transfers").WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs(tenant.Default, 1).WillReturnRows(mock.NewRows([]string{"stock"}).AddRow(3))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").
+		WithArgs(tenant.Default, 1).WillReturnRows(mock.NewRows([]string{"warehouse_id", "quantity"}).AddRow(1, 3))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	repository := NewRepository(db)
+	_, err = repository.Transfer(ctx, transferMock)
+
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransferErrSourceOfOtherTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, code, name, address FROM warehouses WHERE tenant_id = \\? AND id = \\?").
+		WithArgs("acme", 1).WillReturnRows(mock.NewRows([]string{"id", "code", "name", "address"}))
+	mock.ExpectRollback()
+
+	repository := NewRepository(db)
+	_, err = repository.Transfer(tenant.WithID(ctx, "acme"), transferMock)
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteErrOtherTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT COALESCE\\(SUM\\(s.quantity\\), 0\\) FROM warehouse_stock s JOIN warehouses w").
+		WithArgs("acme", 1).WillReturnRows(mock.NewRows([]string{"on_hand"}).AddRow(0))
+	mock.ExpectExec("DELETE FROM warehouses WHERE tenant_id = \\? AND id = \\?").
+		WithArgs("acme", 1).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repository := NewRepository(db)
+	err = repository.Delete(tenant.WithID(ctx, "acme"), 1)
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetLevelOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT id, code, name, address FROM warehouses WHERE tenant_id = \\? AND id = \\?").
+		WithArgs(tenant.Default, 1).WillReturnRows(mock.NewRows([]string{"id", "code", "name", "address"}).AddRow(1, "WH1", "Main", ""))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\? FOR UPDATE").
+		WithArgs(tenant.Default, 3).WillReturnRows(mock.NewRows([]string{"stock"}).AddRow(10))
+	mock.ExpectQuery("SELECT s.warehouse_id, s.quantity FROM warehouse_stock").
+		WithArgs(tenant.Default, 3).WillReturnRows(mock.NewRows([]string{"warehouse_id", "quantity"}).AddRow(1, 10))
+	mock.ExpectExec("INSERT INTO warehouse_stock").WithArgs(1, 3, 30).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE products SET stock = GREATEST").WithArgs(3, 3, tenant.Default, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT stock FROM products WHERE tenant_id = \\? AND id = \\?").
+		WithArgs(tenant.Default, 3).WillReturnRows(mock.NewRows([]string{"stock"}).AddRow(40))
+	mock.ExpectExec("INSERT INTO inventory_ledger").
+		WithArgs(tenant.Default, 3, 1, 30, "warehouse_level", "", 40, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO outbox_events").
+		WithArgs(tenant.Default, "product", 3, "StockChanged", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	repository := NewRepository(db)
+	err = repository.SetLevel(ctx, 1, 3, 40)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
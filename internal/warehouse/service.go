@@ -0,0 +1,116 @@
+package warehouse
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+)
+
+type Service interface {
+	Get(ctx context.Context) ([]domain.Warehouse, error)
+	GetById(ctx context.Context, id int) (domain.Warehouse, error)
+	Create(ctx context.Context, w domain.Warehouse) (domain.Warehouse, error)
+	Update(ctx context.Context, id int, w domain.Warehouse) (domain.Warehouse, error)
+	Delete(ctx context.Context, id int) error
+	SetStock(ctx context.Context, warehouseID, productID, quantity int) error
+	Transfer(ctx context.Context, t domain.Transfer) (domain.Transfer, error)
+	ProductInventory(ctx context.Context, productID int) (domain.ProductInventory, error)
+}
+
+var (
+	ErrNotFound             = errors.New("warehouse not found")
+	ErrProductNotFound      = errors.New("product not found")
+	ErrWarehouseAlredyExist = errors.New("warehouse already exists")
+	ErrWarehouseNotEmpty    = errors.New("warehouse still holds stock")
+	ErrInsufficientStock    = errors.New("insufficient stock in source warehouse")
+	ErrInvalidQuantity      = errors.New("invalid quantity")
+	ErrSameWarehouse        = errors.New("source and destination warehouse must differ")
+)
+
+type service struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &service{repo: repo}
+}
+
+func (s *service) Get(ctx context.Context) ([]domain.Warehouse, error) {
+	return s.repo.Get(ctx)
+}
+
+func (s *service) GetById(ctx context.Context, id int) (domain.Warehouse, error) {
+	return s.repo.GetById(ctx, id)
+}
+
+func (s *service) Create(ctx context.Context, w domain.Warehouse) (domain.Warehouse, error) {
+	if s.repo.Exists(ctx, w.Code) {
+		return domain.Warehouse{}, ErrWarehouseAlredyExist
+	}
+	id, err := s.repo.Save(ctx, w)
+	if err != nil {
+		return domain.Warehouse{}, err
+	}
+	w.ID = id
+	return w, nil
+}
+
+func (s *service) Update(ctx context.Context, id int, w domain.Warehouse) (domain.Warehouse, error) {
+	persisted, err := s.repo.GetById(ctx, id)
+	if err != nil {
+		return domain.Warehouse{}, err
+	}
+	if w.Code != persisted.Code && s.repo.Exists(ctx, w.Code) {
+		return domain.Warehouse{}, ErrWarehouseAlredyExist
+	}
+	if err := s.repo.Update(ctx, id, w); err != nil {
+		return domain.Warehouse{}, err
+	}
+	w.ID = id
+	return w, nil
+}
+
+func (s *service) Delete(ctx context.Context, id int) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *service) SetStock(ctx context.Context, warehouseID, productID, quantity int) error {
+	if quantity < 0 {
+		return ErrInvalidQuantity
+	}
+	return s.repo.SetLevel(ctx, warehouseID, productID, quantity)
+}
+
+func (s *service) Transfer(ctx context.Context, t domain.Transfer) (domain.Transfer, error) {
+	if t.Quantity <= 0 {
+		return domain.Transfer{}, ErrInvalidQuantity
+	}
+	if t.FromWarehouseID == t.ToWarehouseID {
+		return domain.Transfer{}, ErrSameWarehouse
+	}
+	t.CreatedAt = time.Now().UTC()
+	return s.repo.Transfer(ctx, t)
+}
+
+func (s *service) ProductInventory(ctx context.Context, productID int) (domain.ProductInventory, error) {
+	levels, err := s.repo.Levels(ctx, productID)
+	if err != nil {
+		return domain.ProductInventory{}, err
+	}
+	reserved, err := s.repo.Reserved(ctx, productID)
+	if err != nil {
+		return domain.ProductInventory{}, err
+	}
+
+	inv := domain.ProductInventory{ProductID: productID, Reserved: reserved, Locations: levels}
+	for _, l := range levels {
+		inv.OnHand += l.Quantity
+	}
+	inv.Available = inv.OnHand - inv.Reserved
+	if inv.Available < 0 {
+		inv.Available = 0
+	}
+	return inv, nil
+}
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// allowPrivate lets tests deliver to receivers on the loopback interface
+var allowPrivate = false
+
+// public reports whether ip may receive deliveries. Private, loopback and
+// link-local addresses reach the network of the API itself.
+func public(ip net.IP) bool {
+	if allowPrivate {
+		return true
+	}
+	return !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsUnspecified()
+}
+
+// checkHost fails unless every address host resolves to is public
+func checkHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if !public(ip) {
+			return ErrPrivateURL
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	for _, addr := range addrs {
+		if !public(addr.IP) {
+			return ErrPrivateURL
+		}
+	}
+	return nil
+}
+
+// newTransport dials public addresses only. The check runs on the address
+// actually dialed, so hosts that resolve differently after registration
+// and redirects are covered too.
+func newTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   deliveryTimeout,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !public(ip) {
+				return ErrPrivateURL
+			}
+			return nil
+		},
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would dial on our behalf, past the check
+	t.Proxy = nil
+	t.DialContext = dialer.DialContext
+	return t
+}
@@ -0,0 +1,32 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/job"
+)
+
+const JobType = "webhook_delivery"
+
+type JobPayload struct {
+	WebhookID int             `json:"webhook_id"`
+	EventID   int64           `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Body      json.RawMessage `json:"body"`
+	// Manual deliveries go out even when the webhook is disabled
+	Manual bool `json:"manual,omitempty"`
+}
+
+// JobHandler delivers one event to one webhook. Failed attempts are retried
+// by the job queue with exponential backoff.
+func JobHandler(s Service) job.Handler {
+	return func(ctx context.Context, j domain.Job, progress func(int)) (string, error) {
+		var payload JobPayload
+		if err := json.Unmarshal(j.Payload, &payload); err != nil {
+			return "", job.Permanent(job.ErrInvalidPayload)
+		}
+		return "", s.Deliver(ctx, payload, j.Attempts)
+	}
+}
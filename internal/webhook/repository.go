@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/pkg/db"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+type Repository interface {
+	Get(ctx context.Context) ([]domain.Webhook, error)
+	GetById(ctx context.Context, id int) (domain.Webhook, error)
+	Save(ctx context.Context, w domain.Webhook) (int, error)
+	Delete(ctx context.Context, id int) error
+	Active(ctx context.Context) ([]domain.Webhook, error)
+	// Succeeded clears the failure count and turns the webhook back on
+	Succeeded(ctx context.Context, id int) error
+	// Failed counts a failure and disables the webhook once maxFailures
+	// consecutive attempts have failed
+	Failed(ctx context.Context, id, maxFailures int, at time.Time) error
+	SaveDelivery(ctx context.Context, d domain.WebhookDelivery) (int, error)
+	GetDelivery(ctx context.Context, id int) (domain.WebhookDelivery, error)
+	Deliveries(ctx context.Context, webhookID, limit int) ([]domain.WebhookDelivery, error)
+}
+
+type repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &repository{db: db}
+}
+
+// conn joins the transaction active in ctx, if any, labelling its
+// statements with the repository method op
+func (r *repository) conn(ctx context.Context, op string) db.Executor {
+	return db.Conn(ctx, r.db, "webhook", op)
+}
+
+// Query all webhooks and deliveries. Webhooks are scoped to the tenant of
+// the context, deliveries follow their webhook.
+var (
+	webhookColumns      = `id, url, events, secret, active, consecutive_failures, disabled_at, created_at`
+	getWebhooksQuery    = `SELECT ` + webhookColumns + ` FROM webhooks WHERE tenant_id = ? ORDER BY id`
+	getWebhookByIdQuery = `SELECT ` + webhookColumns + ` FROM webhooks WHERE tenant_id = ? AND id = ?`
+	activeWebhooksQuery = `SELECT ` + webhookColumns + ` FROM webhooks WHERE tenant_id = ? AND active = 1 ORDER BY id`
+	createWebhookQuery  = `INSERT INTO webhooks (tenant_id, url, events, secret, active, consecutive_failures, created_at) VALUES (?, ?, ?, ?, 1, 0, ?)`
+	deleteWebhookQuery  = `DELETE FROM webhooks WHERE tenant_id = ? AND id = ?`
+	succeededQuery      = `UPDATE webhooks SET consecutive_failures = 0, active = 1, disabled_at = NULL WHERE tenant_id = ? AND id = ?`
+	// MySQL applies assignments left to right, so the checks below see the
+	// incremented count
+	failedQuery = `UPDATE webhooks SET consecutive_failures = consecutive_failures + 1,
+		disabled_at = IF(active = 1 AND consecutive_failures >= ?, ?, disabled_at),
+		active = IF(consecutive_failures >= ?, 0, active) WHERE tenant_id = ? AND id = ?`
+	deliveryColumns     = `id, webhook_id, event_id, event_type, attempt, status_code, error, duration_ms, payload, created_at`
+	createDeliveryQuery = `INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, attempt, status_code, error, duration_ms, payload, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	getDeliveryQuery    = `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE id = ?`
+	listDeliveriesQuery = `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`
+)
+
+func (r *repository) Get(ctx context.Context) ([]domain.Webhook, error) {
+	return r.list(ctx, getWebhooksQuery)
+}
+
+func (r *repository) GetById(ctx context.Context, id int) (domain.Webhook, error) {
+	w, err := scanWebhook(r.conn(ctx, "GetById").QueryRowContext(ctx, getWebhookByIdQuery, tenant.FromContext(ctx), id))
+	if err == sql.ErrNoRows {
+		return w, ErrNotFound
+	}
+	return w, err
+}
+
+func (r *repository) Save(ctx context.Context, w domain.Webhook) (int, error) {
+	res, err := r.conn(ctx, "Save").ExecContext(ctx, createWebhookQuery, tenant.FromContext(ctx), w.URL, strings.Join(w.Events, ","), w.Secret, w.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *repository) Delete(ctx context.Context, id int) error {
+	res, err := r.conn(ctx, "Delete").ExecContext(ctx, deleteWebhookQuery, tenant.FromContext(ctx), id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *repository) Active(ctx context.Context) ([]domain.Webhook, error) {
+	return r.list(ctx, activeWebhooksQuery)
+}
+
+func (r *repository) Succeeded(ctx context.Context, id int) error {
+	_, err := r.conn(ctx, "Succeeded").ExecContext(ctx, succeededQuery, tenant.FromContext(ctx), id)
+	return err
+}
+
+func (r *repository) Failed(ctx context.Context, id, maxFailures int, at time.Time) error {
+	_, err := r.conn(ctx, "Failed").ExecContext(ctx, failedQuery, maxFailures, at, maxFailures, tenant.FromContext(ctx), id)
+	return err
+}
+
+func (r *repository) SaveDelivery(ctx context.Context, d domain.WebhookDelivery) (int, error) {
+	res, err := r.conn(ctx, "SaveDelivery").ExecContext(ctx, createDeliveryQuery, d.WebhookID, d.EventID, d.EventType, d.Attempt,
+		d.StatusCode, d.Error, d.DurationMs, []byte(d.Payload), d.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *repository) GetDelivery(ctx context.Context, id int) (domain.WebhookDelivery, error) {
+	d, err := scanDelivery(r.conn(ctx, "GetDelivery").QueryRowContext(ctx, getDeliveryQuery, id))
+	if err == sql.ErrNoRows {
+		return d, ErrDeliveryNotFound
+	}
+	return d, err
+}
+
+func (r *repository) Deliveries(ctx context.Context, webhookID, limit int) ([]domain.WebhookDelivery, error) {
+	rows, err := r.conn(ctx, "Deliveries").QueryContext(ctx, listDeliveriesQuery, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []domain.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *repository) list(ctx context.Context, query string) ([]domain.Webhook, error) {
+	rows, err := r.conn(ctx, "list").QueryContext(ctx, query, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []domain.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhook(s scanner) (domain.Webhook, error) {
+	var w domain.Webhook
+	var events string
+	err := s.Scan(&w.ID, &w.URL, &events, &w.Secret, &w.Active, &w.Failures, &w.DisabledAt, &w.CreatedAt)
+	if events != "" {
+		w.Events = strings.Split(events, ",")
+	}
+	return w, err
+}
+
+func scanDelivery(s scanner) (domain.WebhookDelivery, error) {
+	var d domain.WebhookDelivery
+	var payload []byte
+	err := s.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Attempt, &d.StatusCode, &d.Error, &d.DurationMs, &payload, &d.CreatedAt)
+	d.Payload = payload
+	return d, err
+}
@@ -0,0 +1,305 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/job"
+	"github.com/vincentconace/api-gin/internal/outbox"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+	"github.com/vincentconace/api-gin/pkg/tracing"
+)
+
+type Service interface {
+	Get(ctx context.Context) ([]domain.Webhook, error)
+	GetById(ctx context.Context, id int) (domain.Webhook, error)
+	// Create subscribes w.URL to w.Events, generating a secret when none is
+	// given. The secret is only returned here.
+	Create(ctx context.Context, w domain.Webhook) (domain.Webhook, error)
+	Delete(ctx context.Context, id int) error
+	Deliveries(ctx context.Context, id int) ([]domain.WebhookDelivery, error)
+	// Redeliver sends the payload of a logged delivery again, even when the
+	// webhook was disabled. A successful redelivery enables it again.
+	Redeliver(ctx context.Context, id, deliveryID int) (domain.Job, error)
+	// Publish queues a delivery of e for every active webhook of its tenant
+	// subscribed to its type, so the service can back an outbox relay
+	Publish(ctx context.Context, e domain.Event) error
+	// Deliver posts one signed delivery and logs its outcome
+	Deliver(ctx context.Context, p JobPayload, attempt int) error
+}
+
+// Delivery headers
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderEventID   = "X-Webhook-Event-Id"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// AllEvents subscribes a webhook to every event type
+const AllEvents = "*"
+
+const (
+	// MaxConsecutiveFailures failed attempts in a row disable a webhook
+	MaxConsecutiveFailures = 15
+	deliveryTimeout        = 10 * time.Second
+	deliveriesLimit        = 100
+)
+
+var eventTypes = map[string]bool{
+	AllEvents:             true,
+	outbox.ProductCreated: true,
+	outbox.ProductUpdated: true,
+	outbox.ProductDeleted: true,
+	outbox.StockChanged:   true,
+}
+
+var (
+	ErrNotFound         = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+	ErrInvalidURL       = errors.New("url must be an absolute http or https URL")
+	ErrPrivateURL       = errors.New("url must not point to a private, loopback or link-local address")
+	ErrInvalidEvent     = errors.New("unknown event type")
+	ErrDisabled         = errors.New("webhook is disabled")
+	ErrUnexpectedStatus = errors.New("receiver answered with a non 2xx status")
+)
+
+type service struct {
+	repo   Repository
+	jobs   job.Service
+	log    *slog.Logger
+	client *http.Client
+}
+
+func NewService(repo Repository, jobs job.Service, log *slog.Logger) Service {
+	return &service{repo: repo, jobs: jobs, log: log, client: &http.Client{Timeout: deliveryTimeout, Transport: tracing.Transport(newTransport())}}
+}
+
+// envelope is the body posted to receivers
+type envelope struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int             `json:"aggregate_id"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+func (s *service) Get(ctx context.Context) ([]domain.Webhook, error) {
+	webhooks, err := s.repo.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+func (s *service) GetById(ctx context.Context, id int) (domain.Webhook, error) {
+	w, err := s.repo.GetById(ctx, id)
+	w.Secret = ""
+	return w, err
+}
+
+func (s *service) Create(ctx context.Context, w domain.Webhook) (domain.Webhook, error) {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return w, ErrInvalidURL
+	}
+	if len(w.Events) == 0 {
+		w.Events = []string{AllEvents}
+	}
+	for _, e := range w.Events {
+		if !eventTypes[e] {
+			return w, fmt.Errorf("%w: %s", ErrInvalidEvent, e)
+		}
+	}
+	if err := checkHost(ctx, u.Hostname()); err != nil {
+		return w, err
+	}
+	if w.Secret == "" {
+		w.Secret = newSecret()
+	}
+
+	w.Active, w.Failures, w.CreatedAt = true, 0, time.Now().UTC()
+	id, err := s.repo.Save(ctx, w)
+	if err != nil {
+		return w, err
+	}
+	w.ID = id
+	return w, nil
+}
+
+func (s *service) Delete(ctx context.Context, id int) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *service) Deliveries(ctx context.Context, id int) ([]domain.WebhookDelivery, error) {
+	if _, err := s.repo.GetById(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.Deliveries(ctx, id, deliveriesLimit)
+}
+
+func (s *service) Redeliver(ctx context.Context, id, deliveryID int) (domain.Job, error) {
+	if _, err := s.repo.GetById(ctx, id); err != nil {
+		return domain.Job{}, err
+	}
+	d, err := s.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	if d.WebhookID != id {
+		return domain.Job{}, ErrDeliveryNotFound
+	}
+	return s.jobs.Enqueue(ctx, JobType, JobPayload{
+		WebhookID: id,
+		EventID:   d.EventID,
+		EventType: d.EventType,
+		Body:      d.Payload,
+		Manual:    true,
+	})
+}
+
+func (s *service) Publish(ctx context.Context, e domain.Event) error {
+	// Deliveries are queued as jobs of the tenant, so they run in it too
+	ctx = tenant.WithID(ctx, e.Tenant)
+	webhooks, err := s.repo.Active(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(envelope{
+		ID:            e.ID,
+		Type:          e.Type,
+		AggregateType: e.AggregateType,
+		AggregateID:   e.AggregateID,
+		CreatedAt:     e.CreatedAt,
+		Data:          e.Payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, w := range webhooks {
+		if !subscribed(w, e.Type) {
+			continue
+		}
+		payload := JobPayload{WebhookID: w.ID, EventID: e.ID, EventType: e.Type, Body: body}
+		if _, err := s.jobs.Enqueue(ctx, JobType, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) Deliver(ctx context.Context, p JobPayload, attempt int) error {
+	w, err := s.repo.GetById(ctx, p.WebhookID)
+	if errors.Is(err, ErrNotFound) {
+		return job.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	if !w.Active && !p.Manual {
+		return job.Permanent(ErrDisabled)
+	}
+
+	start := time.Now()
+	status, sendErr := s.send(ctx, w, p)
+	// Interrupted by shutdown, the job is requeued without counting it
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	d := domain.WebhookDelivery{
+		WebhookID:  w.ID,
+		EventID:    p.EventID,
+		EventType:  p.EventType,
+		Attempt:    attempt,
+		StatusCode: status,
+		DurationMs: time.Since(start).Milliseconds(),
+		Payload:    p.Body,
+		CreatedAt:  start.UTC(),
+	}
+	if sendErr != nil {
+		d.Error = sendErr.Error()
+	}
+	if _, err := s.repo.SaveDelivery(ctx, d); err != nil {
+		s.log.ErrorContext(ctx, "save webhook delivery", "webhook_id", w.ID, "error", err)
+	}
+
+	if sendErr == nil {
+		return s.repo.Succeeded(ctx, w.ID)
+	}
+	if err := s.repo.Failed(ctx, w.ID, MaxConsecutiveFailures, time.Now().UTC()); err != nil {
+		s.log.ErrorContext(ctx, "count webhook failure", "webhook_id", w.ID, "error", err)
+	}
+	return sendErr
+}
+
+// send posts the payload and returns the response status, if any
+func (s *service) send(ctx context.Context, w domain.Webhook, p JobPayload) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(p.Body))
+	if err != nil {
+		return 0, job.Permanent(err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, p.EventType)
+	req.Header.Set(HeaderEventID, strconv.FormatInt(p.EventID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(w.Secret, timestamp, p.Body))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// Drain a bounded amount so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("%w: %d", ErrUnexpectedStatus, res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// Sign returns the signature header value for body sent at timestamp.
+// Receivers recompute the HMAC-SHA256 of "<timestamp>.<body>" with the
+// webhook secret and reject stale timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func subscribed(w domain.Webhook, eventType string) bool {
+	for _, e := range w.Events {
+		if e == AllEvents || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func newSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
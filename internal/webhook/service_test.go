@@ -0,0 +1,218 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/internal/domain"
+	"github.com/vincentconace/api-gin/internal/job"
+	"github.com/vincentconace/api-gin/internal/outbox"
+	"github.com/vincentconace/api-gin/pkg/logging"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+)
+
+var ctx = context.Background()
+
+func init() {
+	// Receivers of the tests listen on the loopback interface
+	allowPrivate = true
+}
+
+// repoStub keeps the webhooks of one tenant, the default one unless set,
+// in memory and records delivery outcomes
+type repoStub struct {
+	Repository
+	tenant     string
+	webhooks   map[int]domain.Webhook
+	deliveries []domain.WebhookDelivery
+	failed     int
+	succeeded  int
+}
+
+func (r *repoStub) owns(ctx context.Context) bool {
+	if r.tenant == "" {
+		return tenant.FromContext(ctx) == tenant.Default
+	}
+	return tenant.FromContext(ctx) == r.tenant
+}
+
+func (r *repoStub) GetById(ctx context.Context, id int) (domain.Webhook, error) {
+	w, ok := r.webhooks[id]
+	if !ok || !r.owns(ctx) {
+		return w, ErrNotFound
+	}
+	return w, nil
+}
+
+func (r *repoStub) Active(ctx context.Context) ([]domain.Webhook, error) {
+	var active []domain.Webhook
+	if !r.owns(ctx) {
+		return nil, nil
+	}
+	for id := 1; id <= len(r.webhooks); id++ {
+		if w := r.webhooks[id]; w.Active {
+			active = append(active, w)
+		}
+	}
+	return active, nil
+}
+
+func (r *repoStub) SaveDelivery(ctx context.Context, d domain.WebhookDelivery) (int, error) {
+	r.deliveries = append(r.deliveries, d)
+	return len(r.deliveries), nil
+}
+
+func (r *repoStub) Succeeded(ctx context.Context, id int) error {
+	r.succeeded++
+	return nil
+}
+
+func (r *repoStub) Failed(ctx context.Context, id, maxFailures int, at time.Time) error {
+	r.failed++
+	return nil
+}
+
+func newTestService(repo Repository) (Service, job.Repository) {
+	jobRepo := job.NewMemoryRepository()
+	jobs := job.NewService(jobRepo, logging.Discard())
+	s := NewService(repo, jobs, logging.Discard())
+	jobs.Register(JobType, JobHandler(s))
+	return s, jobRepo
+}
+
+func TestDeliverOk(t *testing.T) {
+	body := []byte(`{"id":7,"type":"ProductDeleted"}`)
+	var signature, timestamp string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ := io.ReadAll(r.Body)
+		assert.Equal(t, body, received)
+		assert.Equal(t, outbox.ProductDeleted, r.Header.Get(HeaderEvent))
+		signature, timestamp = r.Header.Get(HeaderSignature), r.Header.Get(HeaderTimestamp)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	repo := &repoStub{webhooks: map[int]domain.Webhook{1: {ID: 1, URL: receiver.URL, Secret: "s3cret", Active: true}}}
+	service, _ := newTestService(repo)
+	err := service.Deliver(ctx, JobPayload{WebhookID: 1, EventID: 7, EventType: outbox.ProductDeleted, Body: body}, 1)
+
+	assert.NoError(t, err)
+	ts, _ := strconv.ParseInt(timestamp, 10, 64)
+	assert.Equal(t, Sign("s3cret", ts, body), signature)
+	assert.Equal(t, http.StatusNoContent, repo.deliveries[0].StatusCode)
+	assert.Equal(t, 1, repo.succeeded)
+}
+
+func TestDeliverErrStatusCountsFailure(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	repo := &repoStub{webhooks: map[int]domain.Webhook{1: {ID: 1, URL: receiver.URL, Active: true}}}
+	service, _ := newTestService(repo)
+	err := service.Deliver(ctx, JobPayload{WebhookID: 1, EventID: 7, Body: []byte(`{}`)}, 3)
+
+	assert.ErrorIs(t, err, ErrUnexpectedStatus)
+	assert.Equal(t, http.StatusBadGateway, repo.deliveries[0].StatusCode)
+	assert.Equal(t, 3, repo.deliveries[0].Attempt)
+	assert.Equal(t, 1, repo.failed)
+}
+
+func TestDeliverErrDisabled(t *testing.T) {
+	repo := &repoStub{webhooks: map[int]domain.Webhook{1: {ID: 1, URL: "http://localhost", Active: false}}}
+	service, _ := newTestService(repo)
+	err := service.Deliver(ctx, JobPayload{WebhookID: 1, Body: []byte(`{}`)}, 1)
+
+	assert.ErrorIs(t, err, ErrDisabled)
+	assert.Empty(t, repo.deliveries)
+}
+
+func TestPublishOk(t *testing.T) {
+	repo := &repoStub{webhooks: map[int]domain.Webhook{
+		1: {ID: 1, URL: "http://localhost/all", Events: []string{AllEvents}, Active: true},
+		2: {ID: 2, URL: "http://localhost/stock", Events: []string{outbox.StockChanged}, Active: true},
+		3: {ID: 3, URL: "http://localhost/off", Events: []string{AllEvents}, Active: false},
+	}}
+	service, jobRepo := newTestService(repo)
+	err := service.Publish(ctx, outbox.NewProductDeleted(5))
+
+	assert.NoError(t, err)
+	_, err = jobRepo.Pop(ctx, 10*time.Millisecond, time.Minute)
+	assert.NoError(t, err)
+	_, err = jobRepo.Pop(ctx, 10*time.Millisecond, time.Minute)
+	assert.ErrorIs(t, err, job.ErrEmpty)
+}
+
+func TestPublishOkSkipsWebhooksOfOtherTenants(t *testing.T) {
+	repo := &repoStub{tenant: "acme", webhooks: map[int]domain.Webhook{
+		1: {ID: 1, URL: "http://localhost/all", Events: []string{AllEvents}, Active: true},
+	}}
+	service, jobRepo := newTestService(repo)
+	e := outbox.NewProductDeleted(5)
+
+	e.Tenant = "globex"
+	assert.NoError(t, service.Publish(ctx, e))
+	_, err := jobRepo.Pop(ctx, 10*time.Millisecond, time.Minute)
+	assert.ErrorIs(t, err, job.ErrEmpty)
+
+	e.Tenant = "acme"
+	assert.NoError(t, service.Publish(ctx, e))
+	id, err := jobRepo.Pop(ctx, 10*time.Millisecond, time.Minute)
+	assert.NoError(t, err)
+	j, err := jobRepo.Get(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", j.Tenant)
+}
+
+func TestRedeliverErrOtherTenant(t *testing.T) {
+	repo := &repoStub{tenant: "acme", webhooks: map[int]domain.Webhook{1: {ID: 1, URL: "http://localhost", Active: true}}}
+	service, _ := newTestService(repo)
+
+	_, err := service.Redeliver(tenant.WithID(ctx, "globex"), 1, 1)
+
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCreateErrInvalid(t *testing.T) {
+	service, _ := newTestService(&repoStub{})
+
+	_, err := service.Create(ctx, domain.Webhook{URL: "ftp://example.com"})
+	assert.ErrorIs(t, err, ErrInvalidURL)
+
+	_, err = service.Create(ctx, domain.Webhook{URL: "https://example.com", Events: []string{"OrderShipped"}})
+	assert.ErrorIs(t, err, ErrInvalidEvent)
+}
+
+func TestCreateErrPrivateURL(t *testing.T) {
+	allowPrivate = false
+	defer func() { allowPrivate = true }()
+	service, _ := newTestService(&repoStub{})
+
+	for _, u := range []string{"http://127.0.0.1:8080/hook", "http://10.0.0.7/hook", "http://169.254.169.254/latest", "http://[::1]/hook", "http://0.0.0.0/hook"} {
+		_, err := service.Create(ctx, domain.Webhook{URL: u})
+		assert.ErrorIs(t, err, ErrPrivateURL, u)
+	}
+}
+
+func TestDeliverErrPrivateAddress(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("delivered to a loopback address")
+	}))
+	defer receiver.Close()
+	allowPrivate = false
+	defer func() { allowPrivate = true }()
+
+	repo := &repoStub{webhooks: map[int]domain.Webhook{1: {ID: 1, URL: receiver.URL, Active: true}}}
+	service, _ := newTestService(repo)
+	err := service.Deliver(ctx, JobPayload{WebhookID: 1, EventID: 7, Body: []byte(`{}`)}, 1)
+
+	assert.ErrorIs(t, err, ErrPrivateURL)
+	assert.Equal(t, 1, repo.failed)
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+// RoleAdmin satisfies every policy
+const RoleAdmin = "admin"
+
+// Key of the authenticated Principal in the gin context
+const principalKey = "auth.principal"
+
+// Principal is the caller identified by a verified token
+type Principal struct {
+	Subject string   `json:"sub"`
+	Roles   []string `json:"roles"`
+	// Tenant the caller belongs to, empty for the default one
+	Tenant string `json:"tenant,omitempty"`
+}
+
+func (p Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role || r == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// HeaderAPIKey carries an API key, as does "Authorization: ApiKey <key>"
+const HeaderAPIKey = "X-API-Key"
+
+// KeyVerifier identifies callers presenting an API key
+type KeyVerifier interface {
+	VerifyKey(ctx context.Context, key string) (Principal, error)
+}
+
+// Authenticate verifies the bearer token or API key of requests that send
+// one and stores the caller in the context. Requests without credentials
+// go through anonymous, so public routes keep working; Require guards the
+// rest. keys may be nil to accept tokens only.
+func Authenticate(v Verifier, keys KeyVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		key := c.GetHeader(HeaderAPIKey)
+		if k, ok := apiKey(header); ok {
+			key = k
+		}
+
+		var p Principal
+		var err error
+		switch {
+		case key != "":
+			if keys == nil {
+				unauthorized(c, ErrInvalidKey.Error())
+				return
+			}
+			if p, err = keys.VerifyKey(c.Request.Context(), key); err != nil {
+				unauthorized(c, ErrInvalidKey.Error())
+				return
+			}
+		case header != "":
+			token, ok := bearer(header)
+			if !ok {
+				unauthorized(c, ErrMissingToken.Error())
+				return
+			}
+			if p, err = v.Verify(token); err != nil {
+				unauthorized(c, ErrInvalidToken.Error())
+				return
+			}
+		default:
+			c.Next()
+			return
+		}
+		c.Set(principalKey, p)
+		c.Next()
+	}
+}
+
+// Require declares the role a route needs: 401 without a valid token, 403
+// when the caller lacks the role
+func Require(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := FromContext(c)
+		if !ok {
+			unauthorized(c, ErrMissingToken.Error())
+			return
+		}
+		if !p.HasRole(role) {
+			web.Error(c, http.StatusForbidden, "missing role %s", role)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Authenticated lets any identified caller through, whatever its roles
+func Authenticated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := FromContext(c); !ok {
+			unauthorized(c, ErrMissingToken.Error())
+			return
+		}
+		c.Next()
+	}
+}
+
+func FromContext(c *gin.Context) (Principal, bool) {
+	v, ok := c.Get(principalKey)
+	if !ok {
+		return Principal{}, false
+	}
+	p, ok := v.(Principal)
+	return p, ok
+}
+
+// apiKey extracts the key from an Authorization header
+func apiKey(header string) (string, bool) {
+	const prefix = "ApiKey "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="api"`)
+	web.Error(c, http.StatusUnauthorized, message)
+	c.Abort()
+}
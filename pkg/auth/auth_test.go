@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+var secret = []byte("test-secret")
+
+func signHS256(t *testing.T, sub string, roles []string, exp time.Time) string {
+	claims := Claims{Roles: roles, RegisteredClaims: jwt.RegisteredClaims{Subject: sub, ExpiresAt: jwt.NewNumericDate(exp)}}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when signing a token", err)
+	}
+	return token
+}
+
+func TestVerifyHS256Ok(t *testing.T) {
+	v := NewVerifier(Config{HS256Secret: secret})
+
+	p, err := v.Verify(signHS256(t, "user-1", []string{"products:write"}, time.Now().Add(time.Hour)))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Principal{Subject: "user-1", Roles: []string{"products:write"}}, p)
+}
+
+func TestIssueOk(t *testing.T) {
+	cfg := Config{HS256Secret: secret, Issuer: "api-gin", Audience: "shop"}
+	token, expiresAt, err := NewIssuer(cfg, time.Minute).Issue(Principal{Subject: "user:1", Roles: []string{"orders:read"}})
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, time.Second)
+
+	p, err := NewVerifier(cfg).Verify(token)
+	assert.NoError(t, err)
+	assert.Equal(t, Principal{Subject: "user:1", Roles: []string{"orders:read"}}, p)
+}
+
+func TestIssueErrNoSecret(t *testing.T) {
+	_, _, err := NewIssuer(Config{}, time.Minute).Issue(Principal{Subject: "user:1"})
+
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestVerifyErrExpired(t *testing.T) {
+	v := NewVerifier(Config{HS256Secret: secret})
+
+	_, err := v.Verify(signHS256(t, "user-1", nil, time.Now().Add(-time.Hour)))
+
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerifyRS256JWKSOk(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when generating a key", err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject: "device-7", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}})
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when signing a token", err)
+	}
+
+	v := NewVerifier(Config{JWKS: NewRemoteKeySet(jwks.URL, jwks.Client())})
+	p, err := v.Verify(signed)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "device-7", p.Subject)
+
+	// HS256 is refused when no secret is configured
+	_, err = v.Verify(signHS256(t, "user-1", nil, time.Now().Add(time.Hour)))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRequirePolicies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	keys := keyVerifier{"ak_good": {Subject: "apikey:1", Roles: []string{"products:write"}}, "ak_read": {Subject: "apikey:2", Roles: []string{"orders:read"}}}
+	r.Use(Authenticate(NewVerifier(Config{HS256Secret: secret}), keys))
+	r.DELETE("/products/:id", Require("products:write"), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	cases := []struct {
+		name   string
+		header string
+		apiKey string
+		status int
+	}{
+		{"anonymous", "", "", http.StatusUnauthorized},
+		{"invalid token", "Bearer nope", "", http.StatusUnauthorized},
+		{"missing role", "Bearer " + signHS256(t, "user-1", []string{"orders:read"}, time.Now().Add(time.Hour)), "", http.StatusForbidden},
+		{"role", "Bearer " + signHS256(t, "user-1", []string{"products:write"}, time.Now().Add(time.Hour)), "", http.StatusNoContent},
+		{"admin", "Bearer " + signHS256(t, "user-1", []string{RoleAdmin}, time.Now().Add(time.Hour)), "", http.StatusNoContent},
+		{"api key header", "ApiKey ak_good", "", http.StatusNoContent},
+		{"x-api-key", "", "ak_good", http.StatusNoContent},
+		{"api key missing scope", "", "ak_read", http.StatusForbidden},
+		{"invalid api key", "ApiKey ak_nope", "", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/products/1", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			if tc.apiKey != "" {
+				req.Header.Set(HeaderAPIKey, tc.apiKey)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tc.status, w.Code)
+		})
+	}
+}
+
+type keyVerifier map[string]Principal
+
+func (k keyVerifier) VerifyKey(_ context.Context, key string) (Principal, error) {
+	p, ok := k[key]
+	if !ok {
+		return Principal{}, ErrInvalidKey
+	}
+	return p, nil
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Lifetime of access tokens issued without JWT_ACCESS_TTL
+const defaultAccessTTL = 15 * time.Minute
+
+// Issuer signs access tokens the Verifier built from the same Config
+// accepts
+type Issuer interface {
+	Issue(p Principal) (token string, expiresAt time.Time, err error)
+}
+
+type issuer struct {
+	cfg Config
+	ttl time.Duration
+}
+
+func NewIssuer(cfg Config, ttl time.Duration) Issuer {
+	return &issuer{cfg: cfg, ttl: ttl}
+}
+
+// InitIssuer signs HS256 tokens with JWT_HS256_SECRET for JWT_ISSUER and
+// JWT_AUDIENCE, valid for JWT_ACCESS_TTL. Without a secret nothing can be
+// issued.
+func InitIssuer() Issuer {
+	cfg := Config{
+		HS256Secret: []byte(os.Getenv("JWT_HS256_SECRET")),
+		Issuer:      os.Getenv("JWT_ISSUER"),
+		Audience:    os.Getenv("JWT_AUDIENCE"),
+	}
+	ttl, err := time.ParseDuration(os.Getenv("JWT_ACCESS_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = defaultAccessTTL
+	}
+	return NewIssuer(cfg, ttl)
+}
+
+func (i *issuer) Issue(p Principal) (string, time.Time, error) {
+	if len(i.cfg.HS256Secret) == 0 {
+		return "", time.Time{}, ErrUnknownKey
+	}
+	now := time.Now()
+	expiresAt := now.Add(i.ttl)
+	claims := Claims{
+		Roles:  p.Roles,
+		Tenant: p.Tenant,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID(),
+			Subject:   p.Subject,
+			Issuer:    i.cfg.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	if i.cfg.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{i.cfg.Audience}
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(i.cfg.HS256Secret)
+	return token, expiresAt, err
+}
+
+func tokenID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrUnknownKey   = errors.New("unknown signing key")
+	ErrInvalidKey   = errors.New("invalid api key")
+)
+
+// Clock skew tolerated on exp, nbf and iat
+const leeway = 30 * time.Second
+
+type Config struct {
+	// HS256Secret enables HS256 tokens
+	HS256Secret []byte
+	// JWKS enables RS256 tokens signed by its keys
+	JWKS     *KeySet
+	Issuer   string
+	Audience string
+}
+
+type Claims struct {
+	Roles  []string `json:"roles"`
+	Tenant string   `json:"tenant,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type Verifier interface {
+	// Verify checks the signature and standard claims of token
+	Verify(token string) (Principal, error)
+}
+
+type verifier struct {
+	cfg    Config
+	parser *jwt.Parser
+}
+
+func NewVerifier(cfg Config) Verifier {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}),
+		jwt.WithLeeway(leeway),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	return &verifier{cfg: cfg, parser: jwt.NewParser(opts...)}
+}
+
+// Init configures the verifier from JWT_HS256_SECRET, JWT_JWKS_URL or
+// JWT_JWKS_FILE, JWT_ISSUER and JWT_AUDIENCE. Without keys every token is
+// rejected, so only public routes answer.
+func Init() (Verifier, error) {
+	cfg := Config{
+		Issuer:   os.Getenv("JWT_ISSUER"),
+		Audience: os.Getenv("JWT_AUDIENCE"),
+	}
+	if secret := os.Getenv("JWT_HS256_SECRET"); secret != "" {
+		cfg.HS256Secret = []byte(secret)
+	}
+	switch {
+	case os.Getenv("JWT_JWKS_URL") != "":
+		cfg.JWKS = NewRemoteKeySet(os.Getenv("JWT_JWKS_URL"), http.DefaultClient)
+	case os.Getenv("JWT_JWKS_FILE") != "":
+		keys, err := LoadKeySetFile(os.Getenv("JWT_JWKS_FILE"))
+		if err != nil {
+			return nil, err
+		}
+		cfg.JWKS = keys
+	}
+	return NewVerifier(cfg), nil
+}
+
+func (v *verifier) Verify(token string) (Principal, error) {
+	var claims Claims
+	_, err := v.parser.ParseWithClaims(token, &claims, v.key)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return Principal{}, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	return Principal{Subject: claims.Subject, Roles: claims.Roles, Tenant: claims.Tenant}, nil
+}
+
+// key picks the verification key for the token's algorithm
+func (v *verifier) key(t *jwt.Token) (interface{}, error) {
+	switch t.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(v.cfg.HS256Secret) == 0 {
+			return nil, ErrUnknownKey
+		}
+		return v.cfg.HS256Secret, nil
+	case *jwt.SigningMethodRSA:
+		if v.cfg.JWKS == nil {
+			return nil, ErrUnknownKey
+		}
+		kid, _ := t.Header["kid"].(string)
+		return v.cfg.JWKS.Key(kid)
+	}
+	return nil, ErrUnknownKey
+}
+
+// bearer extracts the token from an Authorization header
+func bearer(header string) (string, bool) {
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
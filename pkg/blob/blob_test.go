@@ -0,0 +1,98 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+// fakeS3 is a minimal in-memory stand-in for an S3-compatible server
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.Path] = body
+	case http.MethodGet:
+		body, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestLocalStoreOk(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8080/media/")
+	assert.NoError(t, err)
+
+	err = store.Put(ctx, "products/1/image.png", strings.NewReader("content"), "image/png")
+	assert.NoError(t, err)
+
+	r, err := store.Get(ctx, "products/1/image.png")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, "content", string(body))
+	assert.Equal(t, "http://localhost:8080/media/products/1/image.png", store.URL("products/1/image.png"))
+
+	assert.NoError(t, store.Delete(ctx, "products/1/image.png"))
+	_, err = store.Get(ctx, "products/1/image.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalStoreErrInvalidKey(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "")
+	assert.NoError(t, err)
+
+	err = store.Put(ctx, "../outside.png", strings.NewReader("content"), "image/png")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestS3StoreOk(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{objects: map[string][]byte{}})
+	defer server.Close()
+
+	store := NewS3Store(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "media",
+		AccessKey: "access",
+		SecretKey: "secret",
+	}, server.Client())
+
+	err := store.Put(ctx, "products/1/image.png", strings.NewReader("content"), "image/png")
+	assert.NoError(t, err)
+
+	r, err := store.Get(ctx, "products/1/image.png")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, "content", string(body))
+	assert.Equal(t, server.URL+"/media/products/1/image.png", store.URL("products/1/image.png"))
+
+	assert.NoError(t, store.Delete(ctx, "products/1/image.png"))
+	_, err = store.Get(ctx, "products/1/image.png")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
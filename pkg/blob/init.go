@@ -0,0 +1,33 @@
+package blob
+
+import (
+	"net/http"
+	"os"
+)
+
+// Init builds the media store selected by BLOB_DRIVER ("local" by default or "s3")
+func Init() (Store, error) {
+	if os.Getenv("BLOB_DRIVER") == "s3" {
+		return NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PublicURL: os.Getenv("S3_PUBLIC_URL"),
+		}, http.DefaultClient), nil
+	}
+	return NewLocalStore(LocalDir(), getEnv("MEDIA_BASE_URL", "/media"))
+}
+
+// LocalDir is the directory used by the local store, served under /media
+func LocalDir() string {
+	return getEnv("MEDIA_DIR", "./media")
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
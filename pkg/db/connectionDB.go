@@ -14,10 +14,8 @@ func Init() (*sql.DB, error) {
 	password := os.Getenv("PASSWORD")
 	host := os.Getenv("HOST")
 	dbName := os.Getenv("DB_NAME")
-	connectionString := fmt.Sprintf("%s:%s@tcp(%s)/%s", user, password, host, dbName)
-	fmt.Println(connectionString)
+	connectionString := fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true", user, password, host, dbName)
 	// Init database connection
-	// db, err := sql.Open("mysql", "root:21032991@tcp(localhost:3306)/products")
 	db, err := sql.Open("mysql", connectionString)
 	if err != nil {
 		return nil, err
@@ -29,7 +27,5 @@ func Init() (*sql.DB, error) {
 		return nil, err
 	}
 
-	fmt.Println("Connection database success")
-
 	return db, nil
 }
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/vincentconace/api-gin/pkg/metrics"
+	"github.com/vincentconace/api-gin/pkg/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumented times and traces the statements of one repository method
+type instrumented struct {
+	next       sqlExecutor
+	repository string
+	method     string
+}
+
+func instrument(next sqlExecutor, repository, method string) Executor {
+	return instrumented{next: next, repository: repository, method: method}
+}
+
+func (e instrumented) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := e.start(ctx, query)
+	res, err := e.next.ExecContext(ctx, query, args...)
+	done(err)
+	return res, err
+}
+
+func (e instrumented) QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	ctx, done := e.start(ctx, query)
+	rows, err := e.next.QueryContext(ctx, query, args...)
+	if err != nil {
+		done(err)
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, done: done}, nil
+}
+
+func (e instrumented) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, done := e.start(ctx, query)
+	row := e.next.QueryRowContext(ctx, query, args...)
+	done(row.Err())
+	return row
+}
+
+// instrumentedRows keeps the span of a query open until its rows are
+// read and closed
+type instrumentedRows struct {
+	*sql.Rows
+	done func(err error)
+	once sync.Once
+}
+
+func (r *instrumentedRows) Close() error {
+	err := r.Rows.Close()
+	r.once.Do(func() { r.done(errors.Join(r.Rows.Err(), err)) })
+	return err
+}
+
+// start opens the span of a statement, done closes it and records the
+// latency
+func (e instrumented) start(ctx context.Context, query string) (context.Context, func(err error)) {
+	start := time.Now()
+	op := tracing.SQLOperation(query)
+	ctx, span := tracing.Start(ctx, op+" "+e.repository+"."+e.method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMySQL,
+			semconv.DBOperationName(op),
+			semconv.DBQueryText(tracing.SanitizeSQL(query)),
+			semconv.CodeNamespace(e.repository),
+			semconv.CodeFunction(e.method),
+		))
+	return ctx, func(err error) {
+		metrics.ObserveQuery(e.repository, e.method, time.Since(start), err)
+		tracing.End(span, err)
+	}
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestQueryContextOkEndsSpanWhenRowsClose(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	mock.ExpectQuery("SELECT id FROM products").
+		WillReturnRows(mock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+	rows, err := Conn(ctx, db, "product", "Get").QueryContext(ctx, "SELECT id FROM products")
+	assert.NoError(t, err)
+	assert.Empty(t, recorder.Ended())
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		assert.NoError(t, rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	assert.Empty(t, recorder.Ended())
+
+	assert.NoError(t, rows.Close())
+	assert.NoError(t, rows.Close())
+	assert.Equal(t, []int{1, 2}, ids)
+	assert.Len(t, recorder.Ended(), 1)
+	assert.Equal(t, "SELECT product.Get", recorder.Ended()[0].Name())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
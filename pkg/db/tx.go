@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Executor runs the statements of a repository on *sql.DB or on the
+// transaction of the context
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Rows is the part of *sql.Rows repositories read a result set with
+type Rows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close() error
+}
+
+// sqlExecutor is satisfied by both *sql.DB and *sql.Tx
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type TxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// MySQL error raised when InnoDB picks the transaction as a deadlock victim
+const errDeadlock = 1213
+
+// MySQL error raised when an insert or update violates a unique key
+const errDuplicateKey = 1062
+
+const (
+	maxAttempts = 3
+	baseBackoff = 20 * time.Millisecond
+)
+
+type txKey struct{}
+
+type txState struct {
+	tx    *sql.Tx
+	depth int
+}
+
+type txManager struct {
+	db *sql.DB
+}
+
+func NewTxManager(db *sql.DB) TxManager {
+	return &txManager{db: db}
+}
+
+// Conn returns the transaction stored in ctx by WithinTx, or db when
+// there is none, so repositories join an active transaction transparently.
+// Statements are timed and traced as method of repository.
+func Conn(ctx context.Context, db *sql.DB, repository, method string) Executor {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return instrument(state.tx, repository, method)
+	}
+	return instrument(db, repository, method)
+}
+
+// WithinTx runs fn in a transaction carried by the context passed to it.
+// Nested calls create a savepoint instead of a new transaction, and the
+// outermost call retries fn with backoff when MySQL reports a deadlock.
+func (m *txManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return m.withinSavepoint(ctx, state, fn)
+	}
+
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			backoff := baseBackoff << (attempt - 1)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff + time.Duration(rand.Int63n(int64(backoff)))):
+			}
+		}
+		err = m.run(ctx, fn)
+		if !IsDeadlock(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (m *txManager) run(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(context.WithValue(ctx, txKey{}, &txState{tx: tx})); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *txManager) withinSavepoint(ctx context.Context, parent *txState, fn func(ctx context.Context) error) error {
+	state := &txState{tx: parent.tx, depth: parent.depth + 1}
+	name := fmt.Sprintf("sp_%d", state.depth)
+
+	if _, err := state.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	if err := fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+		// A deadlock already rolled back the whole transaction, let the
+		// outermost call retry it
+		if !IsDeadlock(err) {
+			state.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+		}
+		return err
+	}
+	_, err := state.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
+
+func IsDeadlock(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errDeadlock
+}
+
+func IsDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateKey
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func TestWithinTxOk(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE products").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = NewTxManager(db).WithinTx(ctx, func(ctx context.Context) error {
+		_, err := Conn(ctx, db, "product", "Update").ExecContext(ctx, "UPDATE products SET stock = 1")
+		return err
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithinTxErrRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	errFn := errors.New("boom")
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err = NewTxManager(db).WithinTx(ctx, func(ctx context.Context) error {
+		return errFn
+	})
+
+	assert.ErrorIs(t, err, errFn)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithinTxNestedSavepoint(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	errInner := errors.New("inner failed")
+	mock.ExpectBegin()
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RELEASE SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	txm := NewTxManager(db)
+	err = txm.WithinTx(ctx, func(ctx context.Context) error {
+		err := txm.WithinTx(ctx, func(ctx context.Context) error {
+			return errInner
+		})
+		assert.ErrorIs(t, err, errInner)
+		return txm.WithinTx(ctx, func(ctx context.Context) error {
+			return nil
+		})
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithinTxRetryOnDeadlock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	deadlock := &mysql.MySQLError{Number: errDeadlock, Message: "Deadlock found when trying to get lock"}
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE products").WillReturnError(deadlock)
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE products").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	attempts := 0
+	err = NewTxManager(db).WithinTx(ctx, func(ctx context.Context) error {
+		attempts++
+		_, err := Conn(ctx, db, "product", "Update").ExecContext(ctx, "UPDATE products SET stock = 1")
+		return err
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithinTxErrDeadlockExhausted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		return
+	}
+	defer db.Close()
+
+	deadlock := &mysql.MySQLError{Number: errDeadlock}
+	for i := 0; i < maxAttempts; i++ {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+	}
+
+	err = NewTxManager(db).WithinTx(ctx, func(ctx context.Context) error {
+		return deadlock
+	})
+
+	assert.True(t, IsDeadlock(err))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,186 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+const (
+	Header = "Idempotency-Key"
+	// HeaderReplayed marks responses served from a previous request
+	HeaderReplayed = "Idempotent-Replayed"
+	maxKeyLength   = 255
+	// Bodies are read whole to fingerprint them, the ones larger than
+	// maxMemoryBytes are spooled to a temporary file
+	maxBodyBytes   = 128 << 20
+	maxMemoryBytes = 1 << 20
+)
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// Headers kept with a response to replay it
+var replayedHeaders = []string{"Content-Type", "Location"}
+
+// Middleware makes requests sending an Idempotency-Key safe to retry: the
+// first response for a key is stored and replayed to later requests with
+// the same key from the same caller. It must run after auth.Authenticate.
+// Server errors aren't stored, so those requests can be retried for real.
+// Store failures are logged to log.
+func Middleware(s Store, log *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(Header)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			web.Error(c, http.StatusBadRequest, "%s can't be longer than %d characters", Header, maxKeyLength)
+			c.Abort()
+			return
+		}
+
+		h := sha256.New()
+		io.WriteString(h, c.Request.Method+" "+c.Request.URL.Path+"\n")
+		cleanup, err := spool(c.Request, h)
+		if err != nil {
+			if !errors.Is(err, errBodyTooLarge) {
+				log.WarnContext(c.Request.Context(), "read idempotent request body", "error", err)
+			}
+			web.Error(c, http.StatusRequestEntityTooLarge, errBodyTooLarge.Error())
+			c.Abort()
+			return
+		}
+		defer cleanup()
+
+		key = tenant.Key(c, caller(c)+":"+key)
+		fingerprint := hex.EncodeToString(h.Sum(nil))
+		record, claimed, err := s.Begin(c.Request.Context(), key, fingerprint)
+		if err != nil {
+			// Without the store requests still go through, just unprotected
+			log.WarnContext(c.Request.Context(), "idempotency store unavailable", "error", err)
+			c.Next()
+			return
+		}
+		if !claimed {
+			replay(c, record, fingerprint)
+			return
+		}
+
+		w := &recorder{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			// A panic is answered with a 500 further up, so don't store it
+			if p := recover(); p != nil {
+				s.Release(c.Request.Context(), key)
+				panic(p)
+			}
+		}()
+		c.Next()
+
+		if w.Status() >= http.StatusInternalServerError {
+			s.Release(c.Request.Context(), key)
+			return
+		}
+		r := Record{Fingerprint: fingerprint, Status: w.Status(), Header: map[string][]string{}, Body: w.body.Bytes()}
+		for _, h := range replayedHeaders {
+			if v := w.Header().Values(h); len(v) > 0 {
+				r.Header[h] = v
+			}
+		}
+		if err := s.Complete(c.Request.Context(), key, r); err != nil {
+			log.ErrorContext(c.Request.Context(), "store idempotent response", "error", err)
+		}
+	}
+}
+
+func replay(c *gin.Context, r Record, fingerprint string) {
+	defer c.Abort()
+	if r.Fingerprint != fingerprint {
+		web.Error(c, http.StatusUnprocessableEntity, "%s was already used for a different request", Header)
+		return
+	}
+	if !r.Done {
+		web.Error(c, http.StatusConflict, "a request with this %s is still in progress", Header)
+		return
+	}
+	for h, values := range r.Header {
+		for _, v := range values {
+			c.Writer.Header().Add(h, v)
+		}
+	}
+	c.Header(HeaderReplayed, "true")
+	c.Status(r.Status)
+	c.Writer.Write(r.Body)
+}
+
+func caller(c *gin.Context) string {
+	if p, ok := auth.FromContext(c); ok {
+		return p.Subject
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// spool replaces the body of r with a copy while hashing it into h, so
+// the request is fingerprinted by route and body. Small bodies are kept in
+// memory, larger ones in a temporary file that cleanup removes.
+func spool(r *http.Request, h hash.Hash) (cleanup func(), err error) {
+	body := io.TeeReader(io.LimitReader(r.Body, maxBodyBytes+1), h)
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, body, maxMemoryBytes+1); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if buf.Len() <= maxMemoryBytes {
+		r.Body = io.NopCloser(&buf)
+		return func() {}, nil
+	}
+
+	f, err := os.CreateTemp("", "idempotency-*")
+	if err != nil {
+		return nil, err
+	}
+	cleanup = func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	n, err := io.Copy(f, io.MultiReader(&buf, body))
+	if err == nil && n > maxBodyBytes {
+		err = errBodyTooLarge
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	r.Body = io.NopCloser(f)
+	return cleanup, nil
+}
+
+// recorder keeps a copy of the response body
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
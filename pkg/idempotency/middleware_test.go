@@ -0,0 +1,148 @@
+package idempotency
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/pkg/logging"
+)
+
+// storeStub is an in-memory Store
+type storeStub struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func (s *storeStub) Begin(ctx context.Context, key, fingerprint string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.records[key]; ok {
+		return r, false, nil
+	}
+	s.records[key] = Record{Fingerprint: fingerprint}
+	return Record{}, true, nil
+}
+
+func (s *storeStub) Complete(ctx context.Context, key string, r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.Done = true
+	s.records[key] = r
+	return nil
+}
+
+func (s *storeStub) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func newTestRouter(s Store, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/products", Middleware(s, logging.Discard()), handler)
+	return r
+}
+
+func post(r *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareReplayOk(t *testing.T) {
+	calls := 0
+	r := newTestRouter(&storeStub{records: map[string]Record{}}, func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusCreated, gin.H{"id": calls})
+	})
+
+	first := post(r, "k1", `{"name":"mouse"}`)
+	second := post(r, "k1", `{"name":"mouse"}`)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", second.Header().Get("Content-Type"))
+	assert.Equal(t, "true", second.Header().Get(HeaderReplayed))
+
+	// Without a key every request runs
+	post(r, "", `{"name":"mouse"}`)
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddlewareErrMismatch(t *testing.T) {
+	r := newTestRouter(&storeStub{records: map[string]Record{}}, func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	post(r, "k1", `{"name":"mouse"}`)
+	w := post(r, "k1", `{"name":"keyboard"}`)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestMiddlewareOkSpoolsLargeBody(t *testing.T) {
+	var sizes []int
+	r := newTestRouter(&storeStub{records: map[string]Record{}}, func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		assert.NoError(t, err)
+		sizes = append(sizes, len(body))
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+	upload := strings.Repeat("a", maxMemoryBytes*2)
+
+	post(r, "k1", upload)
+	replayed := post(r, "k1", upload)
+	mismatch := post(r, "k1", upload+"b")
+
+	assert.Equal(t, []int{len(upload)}, sizes)
+	assert.Equal(t, "true", replayed.Header().Get(HeaderReplayed))
+	assert.Equal(t, http.StatusUnprocessableEntity, mismatch.Code)
+}
+
+func TestMiddlewareErrInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	r := newTestRouter(&storeStub{records: map[string]Record{}}, func(c *gin.Context) {
+		close(started)
+		<-release
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post(r, "k1", `{}`) }()
+	<-started
+	w := post(r, "k1", `{}`)
+	close(release)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, http.StatusCreated, (<-done).Code)
+}
+
+func TestMiddlewareServerErrorNotStored(t *testing.T) {
+	calls := 0
+	r := newTestRouter(&storeStub{records: map[string]Record{}}, func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, post(r, "k1", `{}`).Code)
+	assert.Equal(t, http.StatusCreated, post(r, "k1", `{}`).Code)
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,84 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// ResponseTTL is how long a response can be replayed
+	ResponseTTL = 24 * time.Hour
+	// A request still in flight after this long is considered lost
+	lockTTL = 5 * time.Minute
+)
+
+// Record is what is kept for a key: the request it was first used with and,
+// once it finished, the response
+type Record struct {
+	Fingerprint string              `json:"fingerprint"`
+	Done        bool                `json:"done"`
+	Status      int                 `json:"status,omitempty"`
+	Header      map[string][]string `json:"header,omitempty"`
+	Body        []byte              `json:"body,omitempty"`
+}
+
+type Store interface {
+	// Begin claims key for a request with fingerprint. When the key was
+	// already used it returns the existing record and false.
+	Begin(ctx context.Context, key, fingerprint string) (Record, bool, error)
+	// Complete stores the response of a claimed key
+	Complete(ctx context.Context, key string, r Record) error
+	// Release forgets a claimed key, so the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+type redisStore struct {
+	rd *redis.Client
+}
+
+func NewRedisStore(rd *redis.Client) Store {
+	return &redisStore{rd: rd}
+}
+
+func (s *redisStore) Begin(ctx context.Context, key, fingerprint string) (Record, bool, error) {
+	data, err := json.Marshal(Record{Fingerprint: fingerprint})
+	if err != nil {
+		return Record{}, false, err
+	}
+	claimed, err := s.rd.SetNX(ctx, redisKey(key), data, lockTTL).Result()
+	if err != nil || claimed {
+		return Record{}, claimed, err
+	}
+
+	var r Record
+	data, err = s.rd.Get(ctx, redisKey(key)).Bytes()
+	if err == redis.Nil {
+		// Released or expired in between, try again
+		return s.Begin(ctx, key, fingerprint)
+	}
+	if err != nil {
+		return r, false, err
+	}
+	err = json.Unmarshal(data, &r)
+	return r, false, err
+}
+
+func (s *redisStore) Complete(ctx context.Context, key string, r Record) error {
+	r.Done = true
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.rd.Set(ctx, redisKey(key), data, ResponseTTL).Err()
+}
+
+func (s *redisStore) Release(ctx context.Context, key string) error {
+	return s.rd.Del(ctx, redisKey(key)).Err()
+}
+
+func redisKey(key string) string {
+	return "idempotency[" + key + "]"
+}
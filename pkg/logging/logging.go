@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Key of the attributes of a context, like the request or job ID. It is a
+// plain string like the other context keys of the repo.
+const contextKey = "logging.attrs"
+
+// New returns a JSON logger writing to w at the level of lv, with secrets
+// redacted. Records logged with a context carry its attributes.
+func New(w io.Writer, lv *slog.LevelVar) *slog.Logger {
+	return slog.New(contextHandler{next: Redact(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lv}))})
+}
+
+// Init logs to stdout at LOG_LEVEL, info by default. The returned level can
+// be changed while running.
+func Init() (*slog.Logger, *slog.LevelVar) {
+	lv := new(slog.LevelVar)
+	if level, err := ParseLevel(os.Getenv("LOG_LEVEL")); err == nil {
+		lv.Set(level)
+	}
+	return New(os.Stdout, lv), lv
+}
+
+// ParseLevel accepts debug, info, warn and error in any case
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(strings.TrimSpace(s)))
+	return level, err
+}
+
+// Discard returns a logger that drops everything, for tests
+func Discard() *slog.Logger {
+	return slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+// WithAttrs returns ctx with attrs added to those it carries, so every
+// record logged with it ties back to the request or job it belongs to
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev, _ := ctx.Value(contextKey).([]slog.Attr)
+	all := make([]slog.Attr, 0, len(prev)+len(attrs))
+	return context.WithValue(ctx, contextKey, append(append(all, prev...), attrs...))
+}
+
+type contextHandler struct {
+	next slog.Handler
+}
+
+func (h contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(contextKey).([]slog.Attr); ok {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{next: h.next.WithGroup(name)}
+}
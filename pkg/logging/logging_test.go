@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// lines decodes the JSON log lines written to buf
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &m))
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestRedactOk(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, new(slog.LevelVar)).With("api_key", "ak_0123abcd_secret")
+
+	l.Info("connect root:hunter2@tcp(db:3306)/products",
+		"password", "hunter2",
+		"Authorization", "Bearer abc.def",
+		"error", errors.New("invalid header ApiKey ak_0123abcd_xyz"),
+		slog.Group("smtp", "username", "mailer", "smtp_password", "pw"),
+		"user", "ana",
+	)
+
+	out := buf.String()
+	for _, secret := range []string{"hunter2", "abc.def", "ak_0123abcd", "pw\""} {
+		assert.NotContains(t, out, secret)
+	}
+	line := lines(t, &buf)[0]
+	assert.Equal(t, "connect root:[REDACTED]@tcp(db:3306)/products", line["msg"])
+	assert.Equal(t, redacted, line["api_key"])
+	assert.Equal(t, "invalid header ApiKey [REDACTED]", line["error"])
+	assert.Equal(t, "mailer", line["smtp"].(map[string]interface{})["username"])
+	assert.Equal(t, "ana", line["user"])
+}
+
+func TestParseLevelOk(t *testing.T) {
+	level, err := ParseLevel(" WARN ")
+	assert.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, level)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestLevelVarOk(t *testing.T) {
+	var buf bytes.Buffer
+	lv := new(slog.LevelVar)
+	l := New(&buf, lv)
+
+	l.Debug("hidden")
+	lv.Set(slog.LevelDebug)
+	l.Debug("shown")
+
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), "shown")
+}
+
+func TestMiddlewareOk(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name   string
+		sent   string
+		status int
+		level  string
+	}{
+		{"propagated", "req-123", http.StatusOK, "INFO"},
+		{"generated", "", http.StatusNotFound, "WARN"},
+		{"invalid replaced", "bad id\n", http.StatusInternalServerError, "ERROR"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			var seen string
+			l := New(&buf, new(slog.LevelVar))
+			r := gin.New()
+			r.Use(Middleware(l))
+			r.GET("/products/:id", func(c *gin.Context) {
+				seen = RequestID(c)
+				l.InfoContext(c.Request.Context(), "handled")
+				c.Status(tc.status)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/products/7", nil)
+			if tc.sent != "" {
+				req.Header.Set(HeaderRequestID, tc.sent)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			id := w.Header().Get(HeaderRequestID)
+			assert.Equal(t, seen, id)
+			if tc.name == "propagated" {
+				assert.Equal(t, tc.sent, id)
+			} else {
+				assert.Len(t, id, 32)
+			}
+
+			logged := lines(t, &buf)
+			assert.Len(t, logged, 2)
+			assert.Equal(t, id, logged[0]["request_id"])
+			access := logged[1]
+			assert.Equal(t, "request", access["msg"])
+			assert.Equal(t, tc.level, access["level"])
+			assert.Equal(t, id, access["request_id"])
+			assert.Equal(t, "/products/:id", access["route"])
+			assert.Equal(t, float64(tc.status), access["status"])
+			assert.Contains(t, access, "latency_ms")
+		})
+	}
+}
+
+func TestRecoveryOk(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	l := New(&buf, new(slog.LevelVar))
+	r := gin.New()
+	r.Use(Middleware(l), Recovery(l))
+	r.GET("/boom", func(c *gin.Context) { panic("boom") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	logged := lines(t, &buf)
+	assert.Equal(t, "panic recovered", logged[0]["msg"])
+	assert.Equal(t, float64(http.StatusInternalServerError), logged[1]["status"])
+}
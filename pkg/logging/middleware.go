@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/tenant"
+	"github.com/vincentconace/api-gin/pkg/tracing"
+)
+
+// HeaderRequestID carries the ID that ties the logs of a request together.
+// Callers may send one, otherwise it is generated, and it is always echoed.
+const HeaderRequestID = "X-Request-ID"
+
+const requestIDKey = "logging.request_id"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Middleware gives each request an ID, added to the records logged with its
+// context, then writes one access log line when the request is done. It should run first so the
+// line covers every other middleware, after tracing.Middleware so lines
+// carry the trace ID.
+func Middleware(l *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := c.GetHeader(HeaderRequestID)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Header(HeaderRequestID, id)
+
+		ctx := WithAttrs(c.Request.Context(), slog.String("request_id", id))
+		if traceID := tracing.TraceID(ctx); traceID != "" {
+			ctx = WithAttrs(ctx, slog.String("trace_id", traceID))
+		}
+		c.Set(requestIDKey, id)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", size),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("tenant", tenant.FromContext(c)),
+		}
+		if p, ok := auth.FromContext(c); ok {
+			attrs = append(attrs, slog.String("principal", p.Subject))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		l.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// Recovery turns panics into 500 responses, logged to l with the request
+// ID instead of printed to stderr. It must run after Middleware.
+func Recovery(l *slog.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err interface{}) {
+		l.ErrorContext(c.Request.Context(), "panic recovered", "panic", err, "stack", string(debug.Stack()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
+
+// RequestID returns the ID of the request c belongs to, if any
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
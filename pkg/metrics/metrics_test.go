@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareOk(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware())
+	r.GET("/products/:id", func(c *gin.Context) { c.Status(http.StatusNotFound) })
+	r.GET("/metrics", Handler())
+
+	for _, path := range []string{"/products/1", "/products/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Paths are grouped by route template
+	assert.Equal(t, 2, testutil.CollectAndCount(httpDuration))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `http_request_duration_seconds_count{method="GET",route="/products/:id",status="404"} 2`)
+	assert.Contains(t, w.Body.String(), `http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`)
+}
+
+func TestCacheResultOk(t *testing.T) {
+	CacheResult("product", CacheHit)
+	CacheResult("product", CacheHit)
+	CacheResult("product", CacheMiss)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(cacheRequests.WithLabelValues("product", CacheHit)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(cacheRequests.WithLabelValues("product", CacheMiss)))
+}
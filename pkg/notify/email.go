@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+var headerSanitizer = strings.NewReplacer("\r", "", "\n", " ")
+
+type EmailConfig struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+type emailNotifier struct {
+	cfg EmailConfig
+}
+
+func NewEmailNotifier(cfg EmailConfig) Notifier {
+	return &emailNotifier{cfg: cfg}
+}
+
+func (n *emailNotifier) Notify(ctx context.Context, m Message) error {
+	var auth smtp.Auth
+	if n.cfg.Username != "" {
+		host, _, _ := net.SplitHostPort(n.cfg.Addr)
+		auth = smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, host)
+	}
+
+	to := n.cfg.To
+	if len(m.To) > 0 {
+		to = m.To
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		n.cfg.From, headerSanitizer.Replace(strings.Join(to, ", ")), headerSanitizer.Replace(m.Subject), m.Body)
+	return smtp.SendMail(n.cfg.Addr, auth, n.cfg.From, to, []byte(msg))
+}
@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type Message struct {
+	// To overrides the configured recipients of notifiers that address
+	// someone, like email
+	To      []string    `json:"to,omitempty"`
+	Subject string      `json:"subject"`
+	Body    string      `json:"body"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, m Message) error
+}
+
+type multi []Notifier
+
+// Multi delivers every message to all notifiers, returning the joined
+// errors of the ones that failed.
+func Multi(notifiers ...Notifier) Notifier {
+	return multi(notifiers)
+}
+
+func (m multi) Notify(ctx context.Context, msg Message) error {
+	var errs []string
+	for _, n := range m {
+		if err := n.Notify(ctx, msg); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+type logNotifier struct {
+	log *slog.Logger
+}
+
+func NewLogNotifier(log *slog.Logger) Notifier {
+	return logNotifier{log: log}
+}
+
+func (n logNotifier) Notify(ctx context.Context, m Message) error {
+	n.log.InfoContext(ctx, "notification", "subject", m.Subject, "body", m.Body)
+	return nil
+}
+
+// Init builds the notifier from the environment: messages are always
+// logged, and also sent to NOTIFY_WEBHOOK_URL and by email through
+// SMTP_ADDR when those are set.
+func Init(log *slog.Logger) Notifier {
+	notifiers := []Notifier{NewLogNotifier(log)}
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, NewWebhookNotifier(url, nil))
+	}
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		notifiers = append(notifiers, NewEmailNotifier(EmailConfig{
+			Addr:     addr,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("NOTIFY_EMAIL_FROM"),
+			To:       strings.Split(os.Getenv("NOTIFY_EMAIL_TO"), ","),
+		}))
+	}
+	return Multi(notifiers...)
+}
+
+// InitMail builds the notifier for mail meant for one user, like password
+// resets: email through SMTP_ADDR, or the log when that isn't set, which
+// only suits development.
+func InitMail(log *slog.Logger) Notifier {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		return NewLogNotifier(log)
+	}
+	return NewEmailNotifier(EmailConfig{
+		Addr:     addr,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("NOTIFY_EMAIL_FROM"),
+	})
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+var messageMock = Message{Subject: "Low stock: Product 1", Body: "Stock is 2"}
+
+// fakeSMTP accepts a single message and returns its DATA section
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestWebhookNotifierOk(t *testing.T) {
+	var got Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL, server.Client()).Notify(ctx, messageMock)
+
+	assert.NoError(t, err)
+	assert.Equal(t, messageMock.Subject, got.Subject)
+}
+
+func TestWebhookNotifierErrStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL, server.Client()).Notify(ctx, messageMock)
+
+	assert.Error(t, err)
+}
+
+func TestEmailNotifierOk(t *testing.T) {
+	addr, received := fakeSMTP(t)
+
+	err := NewEmailNotifier(EmailConfig{
+		Addr: addr,
+		From: "alerts@example.com",
+		To:   []string{"buyer@example.com"},
+	}).Notify(ctx, messageMock)
+
+	assert.NoError(t, err)
+	data := <-received
+	assert.Contains(t, data, "Subject: Low stock: Product 1")
+	assert.Contains(t, data, "Stock is 2")
+}
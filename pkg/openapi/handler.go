@@ -0,0 +1,21 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/swaggest/swgui/v5emb"
+)
+
+// Handler serves doc as JSON
+func Handler(doc *Document) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+// UI serves Swagger UI under basePath for the document at specPath. Its
+// assets are embedded in the binary, so it works offline.
+func UI(title, specPath, basePath string) gin.HandlerFunc {
+	return gin.WrapH(v5emb.New(title, specPath, basePath))
+}
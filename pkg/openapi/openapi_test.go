@@ -0,0 +1,61 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testItem struct {
+	ID    int     `json:"id"`
+	Price *string `json:"price"`
+}
+
+type testOrder struct {
+	ID        int               `json:"id"`
+	Items     []testItem        `json:"items"`
+	Notes     string            `json:"notes,omitempty"`
+	Meta      map[string]string `json:"meta"`
+	Payload   json.RawMessage   `json:"payload"`
+	CreatedAt time.Time         `json:"created_at"`
+	Parent    *testOrder        `json:"parent"`
+	Secret    string            `json:"-"`
+	internal  string
+}
+
+func TestSchemaOk(t *testing.T) {
+	doc := New("test", "1.0.0", "")
+
+	s := doc.Schema([]testOrder{})
+
+	assert.Equal(t, "array", s.Type)
+	assert.Equal(t, "#/components/schemas/TestOrder", s.Items.Ref)
+	order := doc.Components.Schemas["TestOrder"]
+	assert.Equal(t, []string{"id", "items", "meta", "payload", "created_at"}, order.Required)
+	assert.Equal(t, "#/components/schemas/TestItem", order.Properties["items"].Items.Ref)
+	assert.Equal(t, "date-time", order.Properties["created_at"].Format)
+	assert.Equal(t, "string", order.Properties["meta"].AdditionalProperties.Type)
+	assert.Nil(t, order.Properties["payload"].Type)
+	assert.Equal(t, "#/components/schemas/TestOrder", order.Properties["parent"].Ref)
+	assert.NotContains(t, order.Properties, "Secret")
+	assert.NotContains(t, order.Properties, "internal")
+	assert.Equal(t, []string{"string", "null"}, doc.Components.Schemas["TestItem"].Properties["price"].Type)
+}
+
+func TestAddOk(t *testing.T) {
+	doc := New("test", "1.0.0", "")
+
+	doc.Add(http.MethodGet, "/items/{id}", &Operation{Summary: "Get an item"})
+	doc.Add(http.MethodDelete, "/items/{id}", &Operation{Summary: "Delete an item"})
+
+	assert.True(t, doc.Has(http.MethodGet, "/items/{id}"))
+	assert.True(t, doc.Has(http.MethodDelete, "/items/{id}"))
+	assert.False(t, doc.Has(http.MethodPost, "/items/{id}"))
+	assert.False(t, doc.Has(http.MethodGet, "/items"))
+	b, err := json.Marshal(doc)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"delete":{"summary":"Delete an item"`)
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Full buckets are dropped this often, so idle clients don't pile up
+const sweepInterval = time.Minute
+
+type memoryLimiter struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryLimiter counts requests in this process only, so with several
+// replicas each one allows the full limit
+func NewMemoryLimiter() Limiter {
+	return &memoryLimiter{tats: map[string]time.Time{}, now: time.Now}
+}
+
+func (m *memoryLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) > sweepInterval {
+		for k, tat := range m.tats {
+			if tat.Before(now) {
+				delete(m.tats, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	tat, res := gcra(m.tats[key], now, limit)
+	m.tats[key] = tat
+	return res, nil
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+// Middleware limits each caller of the routes it guards to limit, counted
+// under name so route groups don't share budgets. Callers are told apart
+// by API key or user when authenticated, by IP otherwise, so it must run
+// after auth.Authenticate.
+func Middleware(l Limiter, name string, limit Limit) gin.HandlerFunc {
+	return middleware(l, name, limit, caller)
+}
+
+// IPMiddleware limits each client IP to limit whoever the caller claims to
+// be. Running before auth.Authenticate, it also bounds attempts with bad
+// credentials. The client IP is only as good as the trusted proxies set on
+// the engine.
+func IPMiddleware(l Limiter, name string, limit Limit) gin.HandlerFunc {
+	return middleware(l, name, limit, clientIP)
+}
+
+func middleware(l Limiter, name string, limit Limit, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := l.Allow(c.Request.Context(), name+":"+key(c), limit)
+		if err != nil {
+			// Letting requests through beats failing them all
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", seconds(res.ResetAfter))
+		if !res.Allowed {
+			c.Header("Retry-After", seconds(res.RetryAfter))
+			web.Error(c, http.StatusTooManyRequests, "rate limit exceeded, retry in %s seconds", seconds(res.RetryAfter))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func caller(c *gin.Context) string {
+	if p, ok := auth.FromContext(c); ok {
+		return p.Subject
+	}
+	return clientIP(c)
+}
+
+func clientIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// seconds rounds up, so clients that wait as told aren't rejected again
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Window, spread evenly: a client that stayed
+// idle may burst up to Requests at once, then gets one more every
+// Window/Requests
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// interval is the time between two requests, never less than the
+// millisecond the Redis script counts in
+func (l Limit) interval() time.Duration {
+	if interval := l.Window / time.Duration(l.Requests); interval > time.Millisecond {
+		return interval
+	}
+	return time.Millisecond
+}
+
+// Result of counting one request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long a rejected client must wait
+	RetryAfter time.Duration
+	// ResetAfter is how long until the full limit is available again
+	ResetAfter time.Duration
+}
+
+type Limiter interface {
+	// Allow counts one request of key against limit
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// ParseLimit reads limits written like "100/1m", allowing at most one
+// request per millisecond
+func ParseLimit(s string) (Limit, error) {
+	requests, window, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q must look like 100/1m", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("rate limit %q: invalid request count", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: invalid window", s)
+	}
+	// Requests are spaced in whole milliseconds, as the Redis script keeps them
+	if d/time.Duration(n) < time.Millisecond {
+		return Limit{}, fmt.Errorf("rate limit %q: more than one request per millisecond", s)
+	}
+	return Limit{Requests: n, Window: d}, nil
+}
+
+// FromEnv reads the limit of a route group from RATE_LIMIT_<NAME>, falling
+// back to def when it is unset or invalid, which is logged to log
+func FromEnv(name string, def Limit, log *slog.Logger) Limit {
+	v := os.Getenv("RATE_LIMIT_" + strings.ToUpper(name))
+	if v == "" {
+		return def
+	}
+	l, err := ParseLimit(v)
+	if err != nil {
+		log.Warn("ignore invalid rate limit", "group", name, "error", err)
+		return def
+	}
+	return l
+}
+
+// gcra applies the generic cell rate algorithm, a token bucket kept as a
+// single timestamp: tat is when the bucket will be full again. The Redis
+// script mirrors it.
+func gcra(tat, now time.Time, limit Limit) (time.Time, Result) {
+	interval := limit.interval()
+	if tat.Before(now) {
+		tat = now
+	}
+	res := Result{Limit: limit.Requests}
+	allowAt := tat.Add(interval - limit.Window)
+	if now.Before(allowAt) {
+		res.RetryAfter = allowAt.Sub(now)
+		res.ResetAfter = tat.Sub(now)
+		return tat, res
+	}
+	tat = tat.Add(interval)
+	res.Allowed = true
+	res.Remaining = int(now.Add(limit.Window).Sub(tat) / interval)
+	res.ResetAfter = tat.Sub(now)
+	return tat, res
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/pkg/logging"
+)
+
+var ctx = context.Background()
+
+func TestParseLimitOk(t *testing.T) {
+	l, err := ParseLimit("100/1m")
+
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 100, Window: time.Minute}, l)
+}
+
+func TestParseLimitErr(t *testing.T) {
+	for _, s := range []string{"", "100", "0/1m", "x/1m", "10/soon", "10/-1s", "1001/1s", "10/1ns"} {
+		_, err := ParseLimit(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestMemoryLimiterOk(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := &memoryLimiter{tats: map[string]time.Time{}, now: func() time.Time { return now }}
+	limit := Limit{Requests: 3, Window: 3 * time.Second}
+
+	for i := 2; i >= 0; i-- {
+		res, _ := l.Allow(ctx, "a", limit)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+	res, _ := l.Allow(ctx, "a", limit)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.ResetAfter)
+
+	// Other keys have their own budget
+	res, _ = l.Allow(ctx, "b", limit)
+	assert.True(t, res.Allowed)
+
+	// One request comes back every Window/Requests
+	now = now.Add(time.Second)
+	res, _ = l.Allow(ctx, "a", limit)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func TestFallbackLimiterOk(t *testing.T) {
+	l := NewFallbackLimiter(failingLimiter{}, NewMemoryLimiter(), logging.Discard())
+	limit := Limit{Requests: 1, Window: time.Minute}
+
+	res, err := l.Allow(ctx, "a", limit)
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed)
+	res, err = l.Allow(ctx, "a", limit)
+	assert.NoError(t, err)
+	assert.False(t, res.Allowed)
+}
+
+func TestMiddlewareOk(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/products", Middleware(NewMemoryLimiter(), "products", Limit{Requests: 2, Window: time.Minute}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	get := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/products", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+
+	get("10.0.0.1")
+	w = get("10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	assert.Equal(t, http.StatusOK, get("10.0.0.2").Code)
+}
+
+func TestIPMiddlewareOkIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.SetTrustedProxies(nil)
+	r.GET("/products", IPMiddleware(NewMemoryLimiter(), "ip", Limit{Requests: 1, Window: time.Minute}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	get := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/products", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("203.0.113.1"))
+	assert.Equal(t, http.StatusTooManyRequests, get("203.0.113.2"))
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// gcraScript is gcra on millisecond timestamps. The caller's clock is used,
+// as scripts that read the server time can't write on older Redis.
+var gcraScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local window = tonumber(ARGV[3])
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+local allow_at = tat + interval - window
+if now < allow_at then
+	return {0, tat, allow_at - now}
+end
+tat = tat + interval
+redis.call("SET", KEYS[1], tat, "PX", tat - now)
+return {1, tat, 0}
+`)
+
+type redisLimiter struct {
+	rd *redis.Client
+}
+
+// NewRedisLimiter shares counts between every replica using rd
+func NewRedisLimiter(rd *redis.Client) Limiter {
+	return &redisLimiter{rd: rd}
+}
+
+func (r *redisLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	interval := limit.interval()
+	values, err := gcraScript.Run(ctx, r.rd, []string{"ratelimit[" + key + "]"},
+		now.UnixMilli(), interval.Milliseconds(), limit.Window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	tat := time.UnixMilli(values[1])
+	res := Result{Allowed: values[0] == 1, Limit: limit.Requests, ResetAfter: tat.Sub(now)}
+	if res.Allowed {
+		res.Remaining = int(now.Add(limit.Window).Sub(tat) / interval)
+	} else {
+		res.RetryAfter = time.Duration(values[2]) * time.Millisecond
+	}
+	return res, nil
+}
+
+type fallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+	log      *slog.Logger
+	degraded int32
+}
+
+// NewFallbackLimiter uses fallback while primary fails, so losing Redis
+// loosens limits instead of failing requests
+func NewFallbackLimiter(primary, fallback Limiter, log *slog.Logger) Limiter {
+	return &fallbackLimiter{primary: primary, fallback: fallback, log: log}
+}
+
+func (f *fallbackLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	res, err := f.primary.Allow(ctx, key, limit)
+	if err == nil {
+		if atomic.CompareAndSwapInt32(&f.degraded, 1, 0) {
+			f.log.InfoContext(ctx, "rate limiter recovered")
+		}
+		return res, nil
+	}
+	if atomic.CompareAndSwapInt32(&f.degraded, 0, 1) {
+		f.log.WarnContext(ctx, "rate limiter falling back to memory", "error", err)
+	}
+	return f.fallback.Allow(ctx, key, limit)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/vincentconace/api-gin/pkg/tracing"
 )
 
 var ctx = context.Background()
@@ -14,6 +15,7 @@ func RedisClient() *redis.Client {
 		Password: "", // no password set
 		DB:       0,  // use default DB
 	})
+	rdb.AddHook(tracing.RedisHook())
 
 	return rdb
 }
@@ -0,0 +1,104 @@
+package tenant
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vincentconace/api-gin/pkg/auth"
+	"github.com/vincentconace/api-gin/pkg/web"
+)
+
+// Default serves requests that name no tenant, so single storefront
+// deployments keep working unchanged
+const Default = "default"
+
+// Header names the tenant of anonymous requests
+const Header = "X-Tenant-ID"
+
+// Key of the tenant in both the gin and the request context. It is a plain
+// string because gin.Context only looks up string keys.
+const contextKey = "tenant.id"
+
+var validID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey, id)
+}
+
+// FromContext returns the tenant of ctx, Default when none was resolved
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey).(string); ok && id != "" {
+		return id
+	}
+	return Default
+}
+
+// Key prefixes a cache key with the tenant of ctx
+func Key(ctx context.Context, key string) string {
+	return "tenant[" + FromContext(ctx) + "]:" + key
+}
+
+// Resolve picks the tenant of each request. Authenticated callers act in
+// the tenant of their token, or Default when it has none, and naming a
+// different one is forbidden; only admins without a tenant may choose. The
+// others name it with the X-Tenant-ID header or a subdomain of baseDomain.
+// It must run after auth.Authenticate.
+func Resolve(baseDomain string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requested := strings.ToLower(strings.TrimSpace(c.GetHeader(Header)))
+		if requested == "" {
+			requested = subdomain(c.Request.Host, baseDomain)
+		}
+		if requested != "" && !validID.MatchString(requested) {
+			web.Error(c, http.StatusBadRequest, "invalid tenant")
+			c.Abort()
+			return
+		}
+
+		id := requested
+		if p, ok := auth.FromContext(c); ok && (p.Tenant != "" || !p.HasRole(auth.RoleAdmin)) {
+			owner := p.Tenant
+			if owner == "" {
+				owner = Default
+			}
+			if requested != "" && requested != owner {
+				web.Error(c, http.StatusForbidden, "credentials belong to another tenant")
+				c.Abort()
+				return
+			}
+			id = owner
+		}
+		if id == "" {
+			id = Default
+		}
+
+		c.Set(contextKey, id)
+		c.Request = c.Request.WithContext(WithID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// Init resolves subdomains of TENANT_BASE_DOMAIN, like acme.shop.example.com
+// for TENANT_BASE_DOMAIN=shop.example.com
+func Init() gin.HandlerFunc {
+	return Resolve(strings.ToLower(os.Getenv("TENANT_BASE_DOMAIN")))
+}
+
+func subdomain(host, baseDomain string) string {
+	if baseDomain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	label := strings.TrimSuffix(strings.ToLower(host), "."+baseDomain)
+	if label == host || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
@@ -0,0 +1,76 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/vincentconace/api-gin/pkg/auth"
+)
+
+func TestResolve(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name      string
+		host      string
+		header    string
+		principal *auth.Principal
+		status    int
+		tenant    string
+	}{
+		{"default", "api.example.com", "", nil, http.StatusOK, Default},
+		{"header", "api.example.com", "acme", nil, http.StatusOK, "acme"},
+		{"subdomain", "acme.shop.example.com:8080", "", nil, http.StatusOK, "acme"},
+		{"nested subdomain ignored", "a.acme.shop.example.com", "", nil, http.StatusOK, Default},
+		{"invalid", "api.example.com", "../acme", nil, http.StatusBadRequest, ""},
+		{"token tenant", "api.example.com", "", &auth.Principal{Subject: "u", Tenant: "acme"}, http.StatusOK, "acme"},
+		{"token of another tenant", "globex.shop.example.com", "", &auth.Principal{Subject: "u", Tenant: "acme"}, http.StatusForbidden, ""},
+		{"token without tenant", "api.example.com", "acme", &auth.Principal{Subject: "u"}, http.StatusForbidden, ""},
+		{"admin chooses", "api.example.com", "acme", &auth.Principal{Subject: "u", Roles: []string{auth.RoleAdmin}}, http.StatusOK, "acme"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var resolved string
+			r := gin.New()
+			r.Use(auth.Authenticate(nil, keyVerifier{p: tc.principal}), Resolve("shop.example.com"))
+			r.GET("/products", func(c *gin.Context) {
+				// Both the gin and the request context carry it
+				assert.Equal(t, FromContext(c), FromContext(c.Request.Context()))
+				resolved = FromContext(c)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			req.Host = tc.host
+			if tc.header != "" {
+				req.Header.Set(Header, tc.header)
+			}
+			if tc.principal != nil {
+				req.Header.Set(auth.HeaderAPIKey, "key")
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.status, w.Code)
+			assert.Equal(t, tc.tenant, resolved)
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	ctx := WithID(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "acme")
+
+	assert.Equal(t, "tenant[acme]:product[1]", Key(ctx, "product[1]"))
+}
+
+// keyVerifier identifies every API key as p
+type keyVerifier struct {
+	p *auth.Principal
+}
+
+func (k keyVerifier) VerifyKey(ctx context.Context, key string) (auth.Principal, error) {
+	return *k.p, nil
+}
@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Longest query text recorded on a span
+const maxQueryText = 2048
+
+var (
+	sqlStrings      = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	sqlNumbers      = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	sqlSpaces       = regexp.MustCompile(`\s+`)
+	sqlPlaceholders = regexp.MustCompile(`\?(?:, \?){2,}`)
+	sqlTuples       = regexp.MustCompile(`(\([^()]*\))(?:, \([^()]*\))+`)
+)
+
+// SanitizeSQL makes query safe and short enough to record: literals become
+// placeholders and the long placeholder lists of batch statements collapse.
+func SanitizeSQL(query string) string {
+	query = sqlStrings.ReplaceAllString(query, "?")
+	query = sqlNumbers.ReplaceAllString(query, "?")
+	query = strings.TrimSpace(sqlSpaces.ReplaceAllString(query, " "))
+	query = sqlPlaceholders.ReplaceAllString(query, "?, ...")
+	query = sqlTuples.ReplaceAllString(query, "$1, ...")
+	if len(query) > maxQueryText {
+		query = query[:maxQueryText] + "..."
+	}
+	return query
+}
+
+// SQLOperation returns the statement keyword of query, like SELECT
+func SQLOperation(query string) string {
+	op, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	return strings.ToUpper(op)
+}
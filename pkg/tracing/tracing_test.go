@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// record installs a tracer provider keeping spans in memory
+func record() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return recorder
+}
+
+func TestMiddlewareOk(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := record()
+
+	r := gin.New()
+	r.ContextWithFallback = true
+	r.Use(Middleware())
+	r.GET("/products/:id", func(c *gin.Context) {
+		// Handlers pass the gin context to services
+		_, span := Start(c, "product.Service.GetById")
+		span.End()
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/products/7", nil)
+	req.Header.Set("traceparent", traceparent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	child, server := spans[0], spans[1]
+	assert.Equal(t, "GET /products/:id", server.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Equal(t, codes.Error, server.Status().Code)
+	assert.Equal(t, server.SpanContext().SpanID(), child.Parent().SpanID())
+}
+
+func TestTransportOk(t *testing.T) {
+	recorder := record()
+
+	var received string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+	}))
+	defer receiver.Close()
+
+	ctx, parent := Start(context.Background(), "webhook.Deliver")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, receiver.URL, nil)
+	res, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	parent.End()
+
+	client := recorder.Ended()[0]
+	assert.Equal(t, "POST", client.Name())
+	assert.Contains(t, received, parent.SpanContext().TraceID().String())
+	assert.Contains(t, received, client.SpanContext().SpanID().String())
+}
+
+func TestRedisHookOk(t *testing.T) {
+	recorder := record()
+	hook := RedisHook()
+
+	miss := redis.NewStringCmd(context.Background(), "get", "product[1]")
+	miss.SetErr(redis.Nil)
+	ctx, _ := hook.BeforeProcess(context.Background(), miss)
+	assert.NoError(t, hook.AfterProcess(ctx, miss))
+
+	failed := redis.NewStatusCmd(context.Background(), "set", "product[1]", "{}")
+	failed.SetErr(errors.New("connection refused"))
+	ctx, _ = hook.BeforeProcess(context.Background(), failed)
+	assert.NoError(t, hook.AfterProcess(ctx, failed))
+
+	spans := recorder.Ended()
+	assert.Equal(t, "redis get", spans[0].Name())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, "redis set", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestSanitizeSQLOk(t *testing.T) {
+	cases := map[string]string{
+		"SELECT id FROM products\n\tWHERE tenant_id = ? AND id = ?":        "SELECT id FROM products WHERE tenant_id = ? AND id = ?",
+		"SELECT id FROM users WHERE email = 'ana@example.com' AND id = 42": "SELECT id FROM users WHERE email = ? AND id = ?",
+		"DELETE FROM products WHERE tenant_id = ? AND id IN (?, ?, ?, ?)":  "DELETE FROM products WHERE tenant_id = ? AND id IN (?, ...)",
+		"INSERT INTO products (a, b) VALUES (?, ?), (?, ?), (?, ?)":        "INSERT INTO products (a, b) VALUES (?, ?), ...",
+		"SAVEPOINT sp_1": "SAVEPOINT sp_1",
+	}
+	for query, want := range cases {
+		assert.Equal(t, want, SanitizeSQL(query), query)
+	}
+	assert.Equal(t, "SELECT", SQLOperation(" select 1"))
+}